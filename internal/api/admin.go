@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/auth"
+)
+
+// defaultLogLines is how many lines /admin/logs returns without ?lines=.
+const defaultLogLines = 100
+
+// handleLogs serves a model's llama-server output as plain text:
+//
+//	GET /admin/logs?model=<id>&lines=<n>&follow=1
+//
+// The model may be omitted when only one is served. With follow, new lines
+// are streamed until the client disconnects or the gateway shuts down.
+//
+// Logs can show prompts, so without authentication (no keys, or -no-auth)
+// they are only served to clients on the same machine.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, r, http.StatusMethodNotAllowed, "method not allowed", "invalid_request_error", "")
+		return
+	}
+	if auth.FromContext(r.Context()) == nil && !isLoopback(r.RemoteAddr) {
+		s.writeError(w, r, http.StatusForbidden,
+			"/admin/logs needs an API key when called from another machine; create one with llmgw keys create",
+			"invalid_request_error", "invalid_api_key")
+		return
+	}
+
+	q := r.URL.Query()
+	name := q.Get("model")
+	id := s.resolveModel(name)
+	if id == "" {
+		msg := fmt.Sprintf("The model `%s` does not exist", name)
+		if name == "" {
+			msg = "model is required; one of: " + strings.Join(s.pool.Models(), ", ")
+		}
+		s.writeError(w, r, http.StatusNotFound, msg, "invalid_request_error", "model_not_found")
+		return
+	}
+	if key := auth.FromContext(r.Context()); key != nil && !key.AllowsModel(id) {
+		s.writeError(w, r, http.StatusForbidden,
+			fmt.Sprintf("This API key is not permitted to use model `%s`", id),
+			"invalid_request_error", "model_not_allowed")
+		return
+	}
+
+	n := defaultLogLines
+	if v := q.Get("lines"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			s.writeError(w, r, http.StatusBadRequest, "lines must be a non-negative integer", "invalid_request_error", "")
+			return
+		}
+	}
+
+	log := s.pool.Get(id).Log()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	follow, _ := strconv.ParseBool(q.Get("follow"))
+	if !follow {
+		for _, line := range log.Tail(n) {
+			fmt.Fprintln(w, line)
+		}
+		return
+	}
+
+	// Following outlives the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	tail, lines, cancel := log.Follow(n)
+	defer cancel()
+	flusher, _ := w.(http.Flusher)
+	for _, line := range tail {
+		fmt.Fprintln(w, line)
+	}
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing.Done():
+			return
+		case line := <-lines:
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// isLoopback reports whether addr, a request's RemoteAddr, is a loopback
+// address.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/auth"
+	"github.com/llmgw/llmgw/internal/backend"
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+func TestLogsFollowEndsOnShutdown(t *testing.T) {
+	t.Setenv("LLMGW_HOME", t.TempDir())
+	cfg := config.New()
+	cfg.NoAuth = true
+	s := NewServer(cfg, backend.NewPool(cfg))
+	s.pool.Add("org/tiny-GGUF", "/models/tiny.gguf", 1<<20)
+	s.pool.Get("org/tiny-GGUF").Log().Write([]byte("loading model\n"))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.http.Handler = http.HandlerFunc(s.handleLogs)
+	go s.http.Serve(ln)
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/admin/logs?follow=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "loading model\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v, want the follower to end and let it finish", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Shutdown took %v with a follower open", d)
+	}
+}
+
+func TestLogsAccess(t *testing.T) {
+	s := testServer(t, "org/tiny-GGUF", "org/other-GGUF")
+	s.cfg.NoAuth = true
+	scoped := &auth.Key{Name: "ci", Models: []string{"org/tiny-GGUF"}}
+
+	for _, tc := range []struct {
+		name   string
+		remote string
+		key    *auth.Key
+		model  string
+		status int
+		code   string
+	}{
+		{"no auth, loopback", "127.0.0.1:5000", nil, "org/tiny-GGUF", http.StatusOK, ""},
+		{"no auth, IPv6 loopback", "[::1]:5000", nil, "org/tiny-GGUF", http.StatusOK, ""},
+		{"no auth, remote", "192.0.2.1:5000", nil, "org/tiny-GGUF", http.StatusForbidden, "invalid_api_key"},
+		{"key, remote", "192.0.2.1:5000", scoped, "org/tiny-GGUF", http.StatusOK, ""},
+		{"key, other model", "127.0.0.1:5000", scoped, "org/other-GGUF", http.StatusForbidden, "model_not_allowed"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/logs?model="+tc.model, nil)
+		req.RemoteAddr = tc.remote
+		if tc.key != nil {
+			req = req.WithContext(auth.WithKey(req.Context(), tc.key))
+		}
+		w := httptest.NewRecorder()
+		s.handleLogs(w, req)
+		if w.Code != tc.status || !strings.Contains(w.Body.String(), tc.code) {
+			t.Errorf("%s: %d %s, want %d %s", tc.name, w.Code, w.Body.String(), tc.status, tc.code)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// handleMessages serves the Anthropic Messages API by translating requests
+// into llama-server chat completions and translating the results back.
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req MessagesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "request body is not valid JSON")
+		return
+	}
+	if req.MaxTokens <= 0 {
+		writeAnthropicError(w, http.StatusBadRequest, "max_tokens: field required and must be positive")
+		return
+	}
+
+	chat, err := toChatRequest(&req)
+	if err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lease := s.admit(w, r, req.Model, body)
+	if lease == nil {
+		return
+	}
+	defer s.release(r, lease)
+
+	// With stop sequences, the reply is streamed from the backend even for
+	// a non-streaming request, so that it can be cut off at one.
+	var stops *stopMatcher
+	if len(req.StopSequences) > 0 {
+		stops = &stopMatcher{stops: req.StopSequences}
+		chat["stream"] = true
+		chat["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	var inputTokens int
+	if req.Stream || stops != nil {
+		// Usage only arrives at the end of a stream, too late for
+		// message_start, and not at all from a stream cut off early.
+		inputTokens, _ = promptTokens(r, lease, body)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	resp, err := postBackend(r.WithContext(ctx), lease, "/v1/chat/completions", chat)
+	if err != nil {
+		s.writeBackendFailure(w, r, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		writeAnthropicError(w, resp.StatusCode, backendError(resp))
+		return
+	}
+
+	call := callFromContext(r.Context())
+	reply := &messageReply{call: call, stops: stops, cancel: cancel, inputTokens: inputTokens}
+	if req.Stream {
+		s.streamMessages(w, r, resp, reply, req.Model)
+		return
+	}
+
+	var text string
+	if stops != nil {
+		var sb strings.Builder
+		err = reply.read(resp.Body, func(t string) { sb.WriteString(t) })
+		text = sb.String()
+	} else {
+		var out *backendChunk
+		if out, err = readChunk(resp.Body, call); err == nil {
+			text = out.text()
+		}
+	}
+	if err != nil {
+		s.writeBackendFailure(w, r, err)
+		return
+	}
+
+	msg := MessagesResponse{
+		ID:           newMessageID(),
+		Type:         "message",
+		Role:         "assistant",
+		Model:        req.Model,
+		Content:      []ContentBlock{{Type: "text", Text: text}},
+		StopReason:   reply.stopReason(),
+		StopSequence: reply.stopSequence(),
+	}
+	if call.usage != nil {
+		msg.Usage = AnthropicUsage{InputTokens: call.usage.PromptTokens, OutputTokens: call.usage.CompletionTokens}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// streamMessages re-emits a llama-server SSE stream as Messages API events.
+func (s *Server) streamMessages(w http.ResponseWriter, r *http.Request, resp *http.Response, reply *messageReply, model string) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	emit := func(event string, data interface{}) {
+		b, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	emit("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": MessagesResponse{
+			ID:      newMessageID(),
+			Type:    "message",
+			Role:    "assistant",
+			Model:   model,
+			Content: []ContentBlock{},
+			Usage:   AnthropicUsage{InputTokens: reply.inputTokens},
+		},
+	})
+	emit("content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": ContentBlock{Type: "text"},
+	})
+	emit("ping", map[string]string{"type": "ping"})
+
+	err := reply.read(resp.Body, func(text string) {
+		emit("content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]string{"type": "text_delta", "text": text},
+		})
+	})
+	if err != nil {
+		msg, _ := backendFailure(r, err)
+		emit("error", AnthropicError{
+			Type:  "error",
+			Error: AnthropicErrorDetail{Type: "api_error", Message: msg},
+		})
+		return
+	}
+
+	call := reply.call
+	usage := AnthropicUsage{InputTokens: reply.inputTokens}
+	if call.usage != nil {
+		usage = AnthropicUsage{InputTokens: call.usage.PromptTokens, OutputTokens: call.usage.CompletionTokens}
+	}
+	emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": 0})
+	emit("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": reply.stopReason(), "stop_sequence": reply.stopSequence()},
+		"usage": usage,
+	})
+	emit("message_stop", map[string]string{"type": "message_stop"})
+}
+
+// messageReply reads the backend's reply to a Messages request.
+type messageReply struct {
+	call        *proxyCall
+	stops       *stopMatcher // nil without stop sequences
+	cancel      func()       // cancels the backend request
+	inputTokens int          // counted before the request, for streams
+}
+
+// read reads a streamed reply, passing its text to fn. With stop sequences
+// the text ends before the first one found, and the rest of the reply is
+// not generated.
+func (m *messageReply) read(body io.Reader, fn func(string)) error {
+	chunks := 0
+	err := readStream(body, m.call, func(chunk *backendChunk) {
+		text := chunk.text()
+		if text == "" || (m.stops != nil && m.stops.matched != "") {
+			return
+		}
+		chunks++
+		if m.stops != nil {
+			text = m.stops.feed(text)
+			if m.stops.matched != "" {
+				m.cancel()
+			}
+		}
+		if text != "" {
+			fn(text)
+		}
+	})
+	if m.stops == nil {
+		return err
+	}
+	if m.stops.matched == "" {
+		if rest := m.stops.flush(); rest != "" {
+			fn(rest)
+		}
+		return err
+	}
+
+	// The error is the cancellation. The reply ended without usage, so
+	// count about one token per chunk.
+	m.call.finishReason = "stop"
+	if m.call.usage == nil {
+		m.call.usage = &Usage{
+			PromptTokens:     m.inputTokens,
+			CompletionTokens: chunks,
+			TotalTokens:      m.inputTokens + chunks,
+		}
+	}
+	return nil
+}
+
+// stopReason returns the Messages API stop_reason of the reply.
+func (m *messageReply) stopReason() *string {
+	if m.stops != nil && m.stops.matched != "" {
+		reason := "stop_sequence"
+		return &reason
+	}
+	return stopReason(m.call.finishReason)
+}
+
+// stopSequence returns the stop sequence that ended the reply, or nil.
+func (m *messageReply) stopSequence() *string {
+	if m.stops == nil || m.stops.matched == "" {
+		return nil
+	}
+	return &m.stops.matched
+}
+
+// stopMatcher finds stop sequences in generated text. llama-server can stop
+// at them itself, but does not say which one it hit, so the gateway looks
+// for them instead. Text that may be the start of a stop sequence is held
+// back until the text after it settles whether it is.
+type stopMatcher struct {
+	stops   []string
+	pending string
+	matched string // the stop sequence found, once there is one
+}
+
+// feed adds generated text and returns the part of it that can be passed
+// on. Once a stop sequence is found, it returns the text before it and sets
+// matched.
+func (m *stopMatcher) feed(text string) string {
+	m.pending += text
+	at := -1
+	for _, stop := range m.stops {
+		if stop == "" {
+			continue
+		}
+		if i := strings.Index(m.pending, stop); i >= 0 && (at < 0 || i < at) {
+			at, m.matched = i, stop
+		}
+	}
+	if at >= 0 {
+		out := m.pending[:at]
+		m.pending = ""
+		return out
+	}
+
+	// Hold back the longest end of the text that starts a stop sequence.
+	keep := 0
+	for _, stop := range m.stops {
+		for n := min(len(stop)-1, len(m.pending)); n > keep; n-- {
+			if strings.HasSuffix(m.pending, stop[:n]) {
+				keep = n
+				break
+			}
+		}
+	}
+	out := m.pending[:len(m.pending)-keep]
+	m.pending = m.pending[len(m.pending)-keep:]
+	return out
+}
+
+// flush returns the text held back at the end of the reply.
+func (m *stopMatcher) flush() string {
+	out := m.pending
+	m.pending = ""
+	return out
+}
+
+// ------- translation helpers -------
+
+// toChatRequest converts a Messages request into an OpenAI chat request body.
+// Only text content is supported; other block types are rejected.
+func toChatRequest(req *MessagesRequest) (map[string]interface{}, error) {
+	var messages []ChatMessage
+
+	if len(req.System) > 0 {
+		system, err := flattenContent(req.System)
+		if err != nil {
+			return nil, fmt.Errorf("system: %w", err)
+		}
+		if system != "" {
+			messages = append(messages, ChatMessage{Role: "system", Content: system})
+		}
+	}
+
+	for i, m := range req.Messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			return nil, fmt.Errorf("messages.%d.role: must be \"user\" or \"assistant\"", i)
+		}
+		text, err := flattenContent(m.Content)
+		if err != nil {
+			return nil, fmt.Errorf("messages.%d.content: %w", i, err)
+		}
+		messages = append(messages, ChatMessage{Role: m.Role, Content: text})
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages: at least one message is required")
+	}
+
+	chat := map[string]interface{}{
+		"model":      req.Model,
+		"messages":   messages,
+		"max_tokens": req.MaxTokens,
+		"stream":     req.Stream,
+	}
+	if req.Stream {
+		chat["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	if req.Temperature != nil {
+		chat["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		chat["top_p"] = *req.TopP
+	}
+	if req.TopK != nil {
+		chat["top_k"] = *req.TopK
+	}
+	return chat, nil
+}
+
+// flattenContent accepts a string or an array of text blocks and returns
+// the concatenated text.
+func flattenContent(raw json.RawMessage) (string, error) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s, nil
+	}
+
+	var blocks []ContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return "", fmt.Errorf("must be a string or an array of content blocks")
+	}
+	var parts []string
+	for _, b := range blocks {
+		if b.Type != "text" {
+			return "", fmt.Errorf("content block type %q is not supported; only \"text\" blocks are accepted", b.Type)
+		}
+		parts = append(parts, b.Text)
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// stopReason maps an OpenAI finish_reason to a Messages API stop_reason.
+func stopReason(finish string) *string {
+	reason := "end_turn"
+	if finish == "length" {
+		reason = "max_tokens"
+	}
+	return &reason
+}
+
+func newMessageID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "msg_" + hex.EncodeToString(b)
+}
+
+// isAnthropic reports whether errors for r should use the Anthropic shape.
+func isAnthropic(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/v1/messages")
+}
+
+// writeAnthropicError writes a Messages API error, choosing the error type
+// from the HTTP status as Anthropic does.
+func writeAnthropicError(w http.ResponseWriter, status int, msg string) {
+	errType := "api_error"
+	switch status {
+	case http.StatusBadRequest, http.StatusMethodNotAllowed:
+		errType = "invalid_request_error"
+	case http.StatusUnauthorized:
+		errType = "authentication_error"
+	case http.StatusForbidden:
+		errType = "permission_error"
+	case http.StatusNotFound:
+		errType = "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		errType = "request_too_large"
+	case http.StatusTooManyRequests:
+		errType = "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		errType = "overloaded_error"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AnthropicError{
+		Type:  "error",
+		Error: AnthropicErrorDetail{Type: errType, Message: msg},
+	})
+}
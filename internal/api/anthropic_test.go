@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToChatRequest(t *testing.T) {
+	var req MessagesRequest
+	err := json.Unmarshal([]byte(`{
+		"model": "tinyllama",
+		"system": [{"type": "text", "text": "Be brief."}, {"type": "text", "text": "Be kind."}],
+		"messages": [
+			{"role": "user", "content": "Hi"},
+			{"role": "assistant", "content": [{"type": "text", "text": "Hello"}]},
+			{"role": "user", "content": "Bye"}
+		],
+		"max_tokens": 64,
+		"stop_sequences": ["END"],
+		"stream": true,
+		"temperature": 0.5,
+		"top_k": 40
+	}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat, err := toChatRequest(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ChatMessage{
+		{Role: "system", Content: "Be brief.\nBe kind."},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+		{Role: "user", Content: "Bye"},
+	}
+	if !reflect.DeepEqual(chat["messages"], want) {
+		t.Errorf("messages = %+v, want %+v", chat["messages"], want)
+	}
+	if chat["max_tokens"] != 64 || chat["stream"] != true || chat["temperature"] != 0.5 || chat["top_k"] != 40 {
+		t.Errorf("parameters not carried over: %v", chat)
+	}
+	if _, ok := chat["stream_options"]; !ok {
+		t.Errorf("streamed request does not ask for usage")
+	}
+	if _, ok := chat["top_p"]; ok {
+		t.Errorf("top_p set although the request has none")
+	}
+	// The gateway matches stop sequences itself, to report which one hit.
+	if _, ok := chat["stop"]; ok {
+		t.Errorf("stop sequences passed to the backend")
+	}
+}
+
+func TestToChatRequestInvalid(t *testing.T) {
+	for _, body := range []string{
+		`{"messages": []}`,
+		`{"messages": [{"role": "system", "content": "x"}]}`,
+		`{"messages": [{"role": "user", "content": [{"type": "image", "text": ""}]}]}`,
+		`{"messages": [{"role": "user", "content": 42}]}`,
+		`{"system": {"text": "x"}, "messages": [{"role": "user", "content": "x"}]}`,
+	} {
+		var req MessagesRequest
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := toChatRequest(&req); err == nil {
+			t.Errorf("toChatRequest(%s) succeeded, want an error", body)
+		}
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	for finish, want := range map[string]string{"stop": "end_turn", "length": "max_tokens", "": "end_turn"} {
+		if got := *stopReason(finish); got != want {
+			t.Errorf("stopReason(%q) = %q, want %q", finish, got, want)
+		}
+	}
+}
+
+func TestStopMatcher(t *testing.T) {
+	tests := []struct {
+		stops   []string
+		chunks  []string
+		out     string
+		matched string
+	}{
+		{[]string{"END"}, []string{"Hello ", "wor", "ld"}, "Hello world", ""},
+		{[]string{"END"}, []string{"Hello E", "N", "D and more"}, "Hello ", "END"},
+		{[]string{"END"}, []string{"Hello EN", "TER"}, "Hello ENTER", ""},
+		{[]string{"\n\n", "User:"}, []string{"Hi.", "\nUs", "er: next"}, "Hi.\n", "User:"},
+		{[]string{"bc", "abcd"}, []string{"xab", "cz"}, "xa", "bc"},
+		{[]string{"bc", "abcd"}, []string{"xab", "cd"}, "x", "abcd"},
+		{[]string{""}, []string{"text"}, "text", ""},
+	}
+	for _, tt := range tests {
+		m := &stopMatcher{stops: tt.stops}
+		var out strings.Builder
+		for _, c := range tt.chunks {
+			if m.matched != "" {
+				break
+			}
+			out.WriteString(m.feed(c))
+		}
+		if m.matched == "" {
+			out.WriteString(m.flush())
+		}
+		if out.String() != tt.out || m.matched != tt.matched {
+			t.Errorf("stops %q, chunks %q: got %q matching %q, want %q matching %q",
+				tt.stops, tt.chunks, out.String(), m.matched, tt.out, tt.matched)
+		}
+	}
+}
+
+// sse renders backend stream chunks carrying texts, then a final chunk with
+// finish and, if promptTokens > 0, usage.
+func sse(finish string, promptTokens int, texts ...string) string {
+	var b strings.Builder
+	for _, text := range texts {
+		data, _ := json.Marshal(text)
+		fmt.Fprintf(&b, "data: {\"choices\":[{\"delta\":{\"content\":%s}}]}\n\n", data)
+	}
+	fmt.Fprintf(&b, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":%q}]", finish)
+	if promptTokens > 0 {
+		fmt.Fprintf(&b, ",\"usage\":{\"prompt_tokens\":%d,\"completion_tokens\":%d,\"total_tokens\":%d}",
+			promptTokens, len(texts), promptTokens+len(texts))
+	}
+	b.WriteString("}\n\ndata: [DONE]\n\n")
+	return b.String()
+}
+
+func TestMessageReplyRead(t *testing.T) {
+	reply := &messageReply{call: &proxyCall{}}
+	var got strings.Builder
+	if err := reply.read(strings.NewReader(sse("length", 5, "a", "b")), func(s string) { got.WriteString(s) }); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "ab" || *reply.stopReason() != "max_tokens" || reply.stopSequence() != nil {
+		t.Errorf("got %q, stop reason %q", got.String(), *reply.stopReason())
+	}
+	if u := reply.call.usage; u == nil || u.PromptTokens != 5 || u.CompletionTokens != 2 {
+		t.Errorf("usage = %+v, want the backend's", u)
+	}
+}
+
+func TestMessageReplyReadStopSequence(t *testing.T) {
+	cancelled := false
+	reply := &messageReply{
+		call:        &proxyCall{},
+		stops:       &stopMatcher{stops: []string{"STOP"}},
+		cancel:      func() { cancelled = true },
+		inputTokens: 7,
+	}
+	var got strings.Builder
+	body := sse("stop", 0, "one ", "two ST", "OP three", "four")
+	if err := reply.read(strings.NewReader(body), func(s string) { got.WriteString(s) }); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "one two " {
+		t.Errorf("text %q, want %q", got.String(), "one two ")
+	}
+	if !cancelled {
+		t.Errorf("backend request not cancelled at the stop sequence")
+	}
+	if *reply.stopReason() != "stop_sequence" || reply.stopSequence() == nil || *reply.stopSequence() != "STOP" {
+		t.Errorf("stop reason %q, stop sequence %v", *reply.stopReason(), reply.stopSequence())
+	}
+	if u := reply.call.usage; u == nil || u.PromptTokens != 7 || u.CompletionTokens != 3 {
+		t.Errorf("usage = %+v, want 7 input tokens and one per chunk read", u)
+	}
+}
+
+func TestWriteAnthropicError(t *testing.T) {
+	for status, want := range map[int]string{
+		http.StatusBadRequest:         "invalid_request_error",
+		http.StatusUnauthorized:       "authentication_error",
+		http.StatusTooManyRequests:    "rate_limit_error",
+		http.StatusServiceUnavailable: "overloaded_error",
+		http.StatusBadGateway:         "api_error",
+	} {
+		w := httptest.NewRecorder()
+		writeAnthropicError(w, status, "oops")
+		var body AnthropicError
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != status || body.Type != "error" || body.Error.Type != want || body.Error.Message != "oops" {
+			t.Errorf("status %d: got %d %+v, want type %q", status, w.Code, body, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/audit"
+)
+
+// auditCall writes one audit record for a completed API call.
+func (s *Server) auditCall(r *http.Request, call *proxyCall, status int, elapsed time.Duration) {
+	if s.audit == nil {
+		return
+	}
+	rec := audit.Record{
+		Time:         call.start,
+		KeyID:        call.keyID,
+		Client:       call.client,
+		Model:        call.model,
+		Endpoint:     r.URL.Path,
+		Status:       status,
+		LatencyMS:    elapsed.Milliseconds(),
+		Stream:       call.stream,
+		FinishReason: call.finishReason,
+		Prompt:       call.prompt,
+		Completion:   call.completion.String(),
+	}
+	if call.usage != nil {
+		rec.PromptTokens = call.usage.PromptTokens
+		rec.CompletionTokens = call.usage.CompletionTokens
+	}
+	s.audit.Log(rec)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/backend"
+)
+
+// postBackend sends an OpenAI-style JSON request to path on the leased
+// backend. The request is cancelled if the client goes away.
+func postBackend(r *http.Request, lease *backend.Lease, path string, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost,
+		lease.Manager().BackendURL()+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return http.DefaultClient.Do(req)
+}
+
+// crashGrace is how long a failed backend call waits to learn whether the
+// backend process crashed.
+const crashGrace = 500 * time.Millisecond
+
+// backendFailure explains why a call to the backend for r failed with err:
+// the crash of the backend process, if it crashed, or else err itself.
+func backendFailure(r *http.Request, err error) (msg, code string) {
+	if call := callFromContext(r.Context()); call != nil && call.lease != nil {
+		if crash := call.lease.Crashed(crashGrace); crash != nil {
+			return "the model backend crashed while handling the request: " + crash.Error(), "backend_crashed"
+		}
+	}
+	return "backend unavailable: " + err.Error(), ""
+}
+
+// writeBackendFailure writes a 502 error for a failed backend call. It also
+// serves as the reverse proxy's error handler.
+func (s *Server) writeBackendFailure(w http.ResponseWriter, r *http.Request, err error) {
+	msg, code := backendFailure(r, err)
+	s.writeError(w, r, http.StatusBadGateway, msg, "server_error", code)
+}
+
+// backendError extracts the error message from a failed backend response.
+func backendError(resp *http.Response) string {
+	var e ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&e)
+	if e.Error.Message != "" {
+		return e.Error.Message
+	}
+	return fmt.Sprintf("backend returned HTTP %d", resp.StatusCode)
+}
+
+// readChunk decodes a non-streamed backend response and records it on call.
+func readChunk(body io.Reader, call *proxyCall) (*backendChunk, error) {
+	var chunk backendChunk
+	if err := json.NewDecoder(body).Decode(&chunk); err != nil {
+		return nil, fmt.Errorf("invalid backend response: %w", err)
+	}
+	call.end = time.Now()
+	call.record(&chunk)
+	return &chunk, nil
+}
+
+// readStream reads a backend SSE stream, recording each chunk on call and
+// passing it to fn.
+func readStream(body io.Reader, call *proxyCall, fn func(*backendChunk)) error {
+	call.stream = true
+	defer func() { call.end = time.Now() }()
+
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+
+		var chunk backendChunk
+		if json.Unmarshal([]byte(data), &chunk) != nil {
+			continue
+		}
+		if call.firstToken.IsZero() {
+			call.firstToken = time.Now()
+		}
+		call.record(&chunk)
+		fn(&chunk)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/llmgw/llmgw/internal/backend"
+)
+
+// templateTokensPerMessage approximates the role markers and separators a
+// chat template adds around each message.
+const templateTokensPerMessage = 8
+
+// checkContext rejects a request whose prompt does not fit in the leased
+// model's context window with a context_length_exceeded error, instead of
+// letting llama-server fail or silently truncate it. Prompts are counted
+// with the backend's tokenizer; if that fails the request is let through.
+func (s *Server) checkContext(w http.ResponseWriter, r *http.Request, lease *backend.Lease, body []byte) bool {
+	window := lease.Manager().ContextSize()
+	text, messages := promptText(body)
+	if window <= 0 || text == "" {
+		return true
+	}
+	slack := messages * templateTokensPerMessage
+	// A token spans at least one byte, so short prompts always fit.
+	if len(text)+slack <= window {
+		return true
+	}
+
+	tokens, err := promptTokens(r, lease, body)
+	if err != nil || tokens <= window {
+		return true
+	}
+	what := "messages"
+	if messages == 0 {
+		what = "prompt"
+	}
+	s.writeError(w, r, http.StatusBadRequest,
+		fmt.Sprintf("This model's maximum context length is %d tokens. However, your %s resulted in %d tokens. Please reduce the length of the %s.",
+			window, what, tokens, what),
+		"invalid_request_error", "context_length_exceeded")
+	return false
+}
+
+// promptTokens counts the tokens of a request's prompt with the backend's
+// tokenizer, allowing for the tokens the chat template adds.
+func promptTokens(r *http.Request, lease *backend.Lease, body []byte) (int, error) {
+	text, messages := promptText(body)
+	if text == "" {
+		return 0, nil
+	}
+	tokens, err := tokenize(r, lease, text)
+	if err != nil {
+		return 0, err
+	}
+	return tokens + messages*templateTokensPerMessage, nil
+}
+
+// promptText returns the text of a chat, completion or Messages request
+// (messages, system prompt and prompt) and how many messages it holds.
+func promptText(body []byte) (text string, messages int) {
+	var req struct {
+		Messages []struct {
+			Content interface{} `json:"content"`
+		} `json:"messages"`
+		System interface{} `json:"system"`
+		Prompt interface{} `json:"prompt"`
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return "", 0
+	}
+
+	var sb strings.Builder
+	appendText(&sb, req.System)
+	appendText(&sb, req.Prompt)
+	for _, m := range req.Messages {
+		appendText(&sb, m.Content)
+	}
+	messages = len(req.Messages)
+	if req.System != nil {
+		messages++
+	}
+	return sb.String(), messages
+}
+
+// appendText appends the text in v: a string, a list of strings, or a list
+// of content blocks with a "text" field.
+func appendText(sb *strings.Builder, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		sb.WriteString(v)
+		sb.WriteByte('\n')
+	case []interface{}:
+		for _, item := range v {
+			appendText(sb, item)
+		}
+	case map[string]interface{}:
+		appendText(sb, v["text"])
+	}
+}
+
+// tokenize counts the tokens of text with the backend's tokenizer.
+func tokenize(r *http.Request, lease *backend.Lease, text string) (int, error) {
+	resp, err := postBackend(r, lease, "/tokenize", map[string]string{"content": text})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("backend returned HTTP %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Tokens []json.RawMessage `json:"tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, err
+	}
+	return len(out.Tokens), nil
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/backend"
+	"github.com/llmgw/llmgw/internal/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounter("llmgw_requests_total",
+		"API requests handled, by endpoint, model and HTTP status.",
+		"endpoint", "model", "status")
+	requestDuration = metrics.NewHistogram("llmgw_request_duration_seconds",
+		"API request latency, by endpoint, model and HTTP status.",
+		nil, "endpoint", "model", "status")
+	requestsInFlight = metrics.NewGauge("llmgw_requests_in_flight",
+		"API requests currently being served, by endpoint.",
+		"endpoint")
+	tokensTotal = metrics.NewCounter("llmgw_tokens_total",
+		"Tokens processed, by model and type (prompt or completion).",
+		"model", "type")
+	timeToFirstToken = metrics.NewHistogram("llmgw_stream_time_to_first_token_seconds",
+		"Time from request to the first streamed token, by model.",
+		nil, "model")
+	tokensPerSecond = metrics.NewHistogram("llmgw_stream_tokens_per_second",
+		"Completion tokens per second after the first token in streamed responses, by model.",
+		[]float64{1, 2, 5, 10, 20, 30, 50, 75, 100, 150, 200}, "model")
+)
+
+// registerBackendMetrics exposes per-model backend process state from pool.
+func registerBackendMetrics(pool *backend.Pool) {
+	collect := func(value func(*backend.Manager) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var out []metrics.Sample
+			for _, id := range pool.Models() {
+				out = append(out, metrics.Sample{LabelValues: []string{id}, Value: value(pool.Get(id))})
+			}
+			return out
+		}
+	}
+
+	metrics.NewGaugeFunc("llmgw_backend_up",
+		"Whether the model's llama-server process is loaded (1) or not (0).",
+		[]string{"model"}, collect(func(m *backend.Manager) float64 {
+			if m.Uptime() > 0 {
+				return 1
+			}
+			return 0
+		}))
+	metrics.NewGaugeFunc("llmgw_backend_uptime_seconds",
+		"Seconds since the model's llama-server process was started.",
+		[]string{"model"}, collect(func(m *backend.Manager) float64 {
+			return m.Uptime().Seconds()
+		}))
+	metrics.NewCounterFunc("llmgw_backend_restarts_total",
+		"Times the model's llama-server process has been restarted after a crash.",
+		[]string{"model"}, collect(func(m *backend.Manager) float64 {
+			return float64(m.Restarts())
+		}))
+}
+
+// observe records request metrics and the audit log entry for an API
+// endpoint. It creates the proxyCall that downstream handlers fill in with
+// the model and usage.
+func (s *Server) observe(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint := r.URL.Path
+		call := &proxyCall{start: time.Now()}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		requestsInFlight.Inc(endpoint)
+		s.inFlight.Add(1)
+		next(sw, r.WithContext(withCall(r.Context(), call)))
+		s.inFlight.Add(-1)
+		requestsInFlight.Dec(endpoint)
+
+		elapsed := time.Since(call.start)
+		if r.Method == http.MethodPost {
+			s.auditCall(r, call, sw.status, elapsed)
+		}
+
+		status := strconv.Itoa(sw.status)
+		requestsTotal.Inc(endpoint, call.model, status)
+		requestDuration.Observe(elapsed.Seconds(), endpoint, call.model, status)
+
+		if call.usage != nil {
+			tokensTotal.Add(float64(call.usage.PromptTokens), call.model, "prompt")
+			tokensTotal.Add(float64(call.usage.CompletionTokens), call.model, "completion")
+		}
+		if !call.firstToken.IsZero() {
+			timeToFirstToken.Observe(call.firstToken.Sub(call.start).Seconds(), call.model)
+			gen := call.end.Sub(call.firstToken).Seconds()
+			if call.usage != nil && call.usage.CompletionTokens > 1 && gen > 0 {
+				tokensPerSecond.Observe(float64(call.usage.CompletionTokens-1)/gen, call.model)
+			}
+		}
+	}
+}
+
+// statusWriter records the response status while passing flushes through,
+// which streaming responses rely on.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,564 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/auth"
+	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/huggingface"
+	"github.com/llmgw/llmgw/internal/models"
+)
+
+// pullProgressInterval throttles download progress lines sent by /api/pull.
+const pullProgressInterval = 250 * time.Millisecond
+
+// ------- Ollama types -------
+
+// OllamaOptions are the model parameters accepted in an Ollama request's
+// "options" object. Unsupported options are ignored.
+type OllamaOptions struct {
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	NumPredict    *int     `json:"num_predict,omitempty"`
+	Seed          *int     `json:"seed,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+	Stop          []string `json:"stop,omitempty"`
+}
+
+// OllamaChatRequest is the body of POST /api/chat.
+type OllamaChatRequest struct {
+	Model    string         `json:"model"`
+	Messages []ChatMessage  `json:"messages"`
+	Stream   *bool          `json:"stream,omitempty"`
+	Format   string         `json:"format,omitempty"`
+	Options  *OllamaOptions `json:"options,omitempty"`
+}
+
+// OllamaGenerateRequest is the body of POST /api/generate.
+type OllamaGenerateRequest struct {
+	Model   string         `json:"model"`
+	Prompt  string         `json:"prompt"`
+	System  string         `json:"system,omitempty"`
+	Raw     bool           `json:"raw,omitempty"`
+	Stream  *bool          `json:"stream,omitempty"`
+	Format  string         `json:"format,omitempty"`
+	Options *OllamaOptions `json:"options,omitempty"`
+}
+
+// OllamaPullRequest is the body of POST /api/pull.
+type OllamaPullRequest struct {
+	Model  string `json:"model"`
+	Name   string `json:"name"` // deprecated alias of Model
+	Stream *bool  `json:"stream,omitempty"`
+}
+
+// OllamaResponse is one NDJSON line of a chat or generate response; the
+// last line has Done set and carries the timing and token counts.
+type OllamaResponse struct {
+	Model              string       `json:"model"`
+	CreatedAt          time.Time    `json:"created_at"`
+	Message            *ChatMessage `json:"message,omitempty"`
+	Response           *string      `json:"response,omitempty"`
+	Done               bool         `json:"done"`
+	DoneReason         string       `json:"done_reason,omitempty"`
+	TotalDuration      int64        `json:"total_duration,omitempty"`
+	LoadDuration       int64        `json:"load_duration,omitempty"`
+	PromptEvalCount    int          `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64        `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int          `json:"eval_count,omitempty"`
+	EvalDuration       int64        `json:"eval_duration,omitempty"`
+}
+
+// OllamaModel is one entry of the /api/tags listing.
+type OllamaModel struct {
+	Name       string             `json:"name"`
+	Model      string             `json:"model"`
+	ModifiedAt time.Time          `json:"modified_at"`
+	Size       int64              `json:"size"`
+	Digest     string             `json:"digest"`
+	Details    OllamaModelDetails `json:"details"`
+}
+
+// OllamaModelDetails describes a model's file format.
+type OllamaModelDetails struct {
+	Format            string `json:"format"`
+	QuantizationLevel string `json:"quantization_level,omitempty"`
+}
+
+// OllamaPullStatus is one NDJSON progress line of /api/pull.
+type OllamaPullStatus struct {
+	Status    string `json:"status,omitempty"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ------- handlers -------
+
+func (s *Server) handleOllamaTags(w http.ResponseWriter, r *http.Request) {
+	key := auth.FromContext(r.Context())
+	list := []OllamaModel{}
+	for _, e := range models.NewRegistry(s.cfg).List() {
+		if key != nil && !key.AllowsModel(e.RepoID) {
+			continue
+		}
+		tag := e.Quant()
+		if tag == "" {
+			tag = "latest"
+		}
+		list = append(list, OllamaModel{
+			Name:       e.RepoID + ":" + tag,
+			Model:      e.RepoID + ":" + tag,
+			ModifiedAt: e.Downloaded,
+			Size:       e.SizeBytes,
+			Digest:     e.SHA256,
+			Details: OllamaModelDetails{
+				Format:            "gguf",
+				QuantizationLevel: e.Quant(),
+			},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"models": list})
+}
+
+func (s *Server) handleOllamaVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"version": config.Version})
+}
+
+func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	var req OllamaChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "request body is not valid JSON", "invalid_request_error", "")
+		return
+	}
+	if len(req.Messages) == 0 {
+		// Ollama treats an empty chat as a request to load the model.
+		s.loadOllamaModel(w, r, req.Model, body, func(resp *OllamaResponse) {
+			resp.Message = &ChatMessage{Role: "assistant"}
+		})
+		return
+	}
+
+	stream := req.Stream == nil || *req.Stream
+	chat := map[string]interface{}{
+		"model":    req.Model,
+		"messages": req.Messages,
+		"stream":   stream,
+	}
+	applyOllamaOptions(chat, req.Format, req.Options)
+
+	s.ollamaComplete(w, r, req.Model, body, "/v1/chat/completions", chat, stream,
+		func(resp *OllamaResponse, text string) {
+			resp.Message = &ChatMessage{Role: "assistant", Content: text}
+		})
+}
+
+func (s *Server) handleOllamaGenerate(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	var req OllamaGenerateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "request body is not valid JSON", "invalid_request_error", "")
+		return
+	}
+	if req.Prompt == "" {
+		s.loadOllamaModel(w, r, req.Model, body, func(resp *OllamaResponse) {
+			empty := ""
+			resp.Response = &empty
+		})
+		return
+	}
+
+	stream := req.Stream == nil || *req.Stream
+	path := "/v1/chat/completions"
+	payload := map[string]interface{}{"model": req.Model, "stream": stream}
+	if req.Raw {
+		// Raw prompts bypass the model's chat template.
+		path = "/v1/completions"
+		payload["prompt"] = req.Prompt
+	} else {
+		var messages []ChatMessage
+		if req.System != "" {
+			messages = append(messages, ChatMessage{Role: "system", Content: req.System})
+		}
+		payload["messages"] = append(messages, ChatMessage{Role: "user", Content: req.Prompt})
+	}
+	applyOllamaOptions(payload, req.Format, req.Options)
+
+	s.ollamaComplete(w, r, req.Model, body, path, payload, stream,
+		func(resp *OllamaResponse, text string) {
+			resp.Response = &text
+		})
+}
+
+// ollamaComplete sends payload to the backend and writes the result as
+// Ollama NDJSON. fill sets the chat- or generate-specific text field.
+func (s *Server) ollamaComplete(w http.ResponseWriter, r *http.Request, model string, body []byte,
+	path string, payload map[string]interface{}, stream bool, fill func(*OllamaResponse, string)) {
+
+	name, ok := s.ollamaModel(w, r, model)
+	if !ok {
+		return
+	}
+	lease := s.admit(w, r, name, body)
+	if lease == nil {
+		return
+	}
+	defer s.release(r, lease)
+
+	if stream {
+		payload["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	resp, err := postBackend(r, lease, path, payload)
+	if err != nil {
+		s.writeBackendFailure(w, r, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		s.writeError(w, r, resp.StatusCode, backendError(resp), "server_error", "")
+		return
+	}
+
+	call := callFromContext(r.Context())
+	if !stream {
+		out, err := readChunk(resp.Body, call)
+		if err != nil {
+			s.writeBackendFailure(w, r, err)
+			return
+		}
+		final := s.ollamaFinal(model, call)
+		fill(final, out.text())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(final)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	err = readStream(resp.Body, call, func(chunk *backendChunk) {
+		text := chunk.text()
+		if text == "" {
+			return
+		}
+		line := &OllamaResponse{Model: model, CreatedAt: time.Now().UTC()}
+		fill(line, text)
+		enc.Encode(line)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		msg, _ := backendFailure(r, err)
+		enc.Encode(map[string]string{"error": msg})
+		return
+	}
+	final := s.ollamaFinal(model, call)
+	fill(final, "")
+	enc.Encode(final)
+}
+
+// ollamaFinal builds the closing "done" line from the call's usage and timings.
+func (s *Server) ollamaFinal(model string, call *proxyCall) *OllamaResponse {
+	resp := &OllamaResponse{
+		Model:         model,
+		CreatedAt:     time.Now().UTC(),
+		Done:          true,
+		DoneReason:    call.finishReason,
+		TotalDuration: int64(call.end.Sub(call.start)),
+	}
+	if resp.DoneReason == "" {
+		resp.DoneReason = "stop"
+	}
+	if call.usage != nil {
+		resp.PromptEvalCount = call.usage.PromptTokens
+		resp.EvalCount = call.usage.CompletionTokens
+	}
+	if !call.firstToken.IsZero() {
+		resp.PromptEvalDuration = int64(call.firstToken.Sub(call.start))
+		resp.EvalDuration = int64(call.end.Sub(call.firstToken))
+	} else {
+		resp.EvalDuration = resp.TotalDuration
+	}
+	return resp
+}
+
+// loadOllamaModel answers an empty chat or generate request by loading the
+// model and returning a single "done" line, as Ollama does.
+func (s *Server) loadOllamaModel(w http.ResponseWriter, r *http.Request, model string, body []byte, fill func(*OllamaResponse)) {
+	start := time.Now()
+	name, ok := s.ollamaModel(w, r, model)
+	if !ok {
+		return
+	}
+	lease := s.admit(w, r, name, body)
+	if lease == nil {
+		return
+	}
+	lease.Release()
+
+	elapsed := int64(time.Since(start))
+	resp := &OllamaResponse{
+		Model:         model,
+		CreatedAt:     time.Now().UTC(),
+		Done:          true,
+		DoneReason:    "load",
+		TotalDuration: elapsed,
+		LoadDuration:  elapsed,
+	}
+	fill(resp)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleOllamaPull downloads a model from HuggingFace into the local cache
+// and adds it to the pool. The tag of "repo:tag" selects a quantization.
+// As a pull can fill the disk, it must be enabled with -allow-pull, and
+// once keys exist only a key scoped to endpoints that include /api/pull
+// may use it. The download stops if the client disconnects.
+func (s *Server) handleOllamaPull(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.AllowPull {
+		s.writeError(w, r, http.StatusForbidden,
+			"pulling models is disabled; start the gateway with -allow-pull to enable it",
+			"invalid_request_error", "pull_disabled")
+		return
+	}
+	if key := auth.FromContext(r.Context()); key != nil && len(key.Endpoints) == 0 {
+		s.writeError(w, r, http.StatusForbidden,
+			"pulling models needs a key created with -endpoints including /api/pull",
+			"invalid_request_error", "endpoint_not_allowed")
+		return
+	}
+
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	var req OllamaPullRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "request body is not valid JSON", "invalid_request_error", "")
+		return
+	}
+	if req.Model == "" {
+		req.Model = req.Name
+	}
+	if req.Model == "" {
+		s.writeError(w, r, http.StatusBadRequest, "model is required", "invalid_request_error", "")
+		return
+	}
+
+	repoID, quant := splitOllamaTag(req.Model)
+	if quant == "" {
+		quant = s.cfg.Quant
+	}
+	call := callFromContext(r.Context())
+	call.model = repoID
+	if key := auth.FromContext(r.Context()); key != nil && !key.AllowsModel(repoID) {
+		s.writeError(w, r, http.StatusForbidden,
+			fmt.Sprintf("This API key is not permitted to use model `%s`", repoID),
+			"invalid_request_error", "model_not_allowed")
+		return
+	}
+
+	stream := req.Stream == nil || *req.Stream
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	progress := func(st OllamaPullStatus) {
+		if !stream {
+			return
+		}
+		enc.Encode(st)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if stream {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	// A download can take far longer than the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Downloads share the registry file, so only one runs at a time.
+	s.pullMu.Lock()
+	entry, err := s.pull(r.Context(), repoID, quant, progress)
+	s.pullMu.Unlock()
+
+	if err != nil {
+		if stream {
+			progress(OllamaPullStatus{Error: err.Error()})
+			return
+		}
+		s.writeError(w, r, http.StatusInternalServerError, err.Error(), "server_error", "")
+		return
+	}
+
+	// Serve the variant just pulled rather than one already in the pool.
+	if _, err := s.pool.Replace(repoID, entry.FilePath, entry.SizeBytes); err != nil {
+		if stream {
+			progress(OllamaPullStatus{Error: err.Error()})
+			return
+		}
+		s.writeError(w, r, http.StatusConflict, err.Error(), "server_error", "")
+		return
+	}
+	if stream {
+		progress(OllamaPullStatus{Status: "success"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc.Encode(OllamaPullStatus{Status: "success"})
+}
+
+// pull fetches the best GGUF model of repoID matching quant, reporting
+// progress, and registers it.
+func (s *Server) pull(ctx context.Context, repoID, quant string, progress func(OllamaPullStatus)) (*models.Entry, error) {
+	progress(OllamaPullStatus{Status: "pulling manifest"})
+
+	registry := models.NewRegistry(s.cfg)
+	if e := registry.Find(repoID, quant); e != nil && e.Complete() {
+		return e, nil
+	}
+
+	hf := huggingface.NewClient(s.cfg.HFToken)
+	info, err := hf.GetModelInfo(repoID)
+	if err != nil {
+		return nil, fmt.Errorf("pull model manifest: %w", err)
+	}
+	selected := hf.SelectBestGGUF(hf.FindGGUFFiles(info), quant, 0)
+	if selected == nil {
+		return nil, fmt.Errorf("no GGUF files found in %s", repoID)
+	}
+
+	digest := selected.Filename
+	if sha := selected.Files[0].SHA256(); sha != "" {
+		digest = "sha256:" + sha
+	}
+	var last time.Time
+	e, err := registry.Download(ctx, hf, repoID, selected, func(done, total int64) {
+		if time.Since(last) < pullProgressInterval && done != total {
+			return
+		}
+		last = time.Now()
+		if total == 0 {
+			total = selected.Size
+		}
+		progress(OllamaPullStatus{
+			Status:    "pulling " + path.Base(selected.Filename),
+			Digest:    digest,
+			Total:     total,
+			Completed: done,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	progress(OllamaPullStatus{Status: "writing manifest"})
+	return e, nil
+}
+
+// ------- translation helpers -------
+
+// applyOllamaOptions copies Ollama options onto an OpenAI-style request body.
+func applyOllamaOptions(payload map[string]interface{}, format string, opts *OllamaOptions) {
+	if format == "json" {
+		payload["response_format"] = map[string]string{"type": "json_object"}
+	}
+	if opts == nil {
+		return
+	}
+	if opts.Temperature != nil {
+		payload["temperature"] = *opts.Temperature
+	}
+	if opts.TopP != nil {
+		payload["top_p"] = *opts.TopP
+	}
+	if opts.TopK != nil {
+		payload["top_k"] = *opts.TopK
+	}
+	if opts.NumPredict != nil && *opts.NumPredict > 0 {
+		payload["max_tokens"] = *opts.NumPredict
+	}
+	if opts.Seed != nil {
+		payload["seed"] = *opts.Seed
+	}
+	if opts.RepeatPenalty != nil {
+		payload["repeat_penalty"] = *opts.RepeatPenalty
+	}
+	if len(opts.Stop) > 0 {
+		payload["stop"] = opts.Stop
+	}
+}
+
+// splitOllamaTag splits "repo:tag" into the repo and a quantization; the
+// "latest" tag means no preference.
+func splitOllamaTag(name string) (string, string) {
+	repo, tag := models.SplitRef(name)
+	if tag == "latest" {
+		tag = ""
+	}
+	return repo, tag
+}
+
+// ollamaModel strips the tag from an Ollama model name. A tag must match
+// the quantization of the file the pool serves for the repo: another
+// variant is reported as not found rather than served by a different file.
+// It writes an error response and returns false on a mismatch.
+func (s *Server) ollamaModel(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	repo, tag := splitOllamaTag(name)
+	if tag == "" {
+		return repo, true
+	}
+	served := s.pool.ModelPath(repo)
+	if served == "" {
+		return repo, true
+	}
+	e := &models.Entry{Filename: filepath.Base(served)}
+	for _, cached := range models.NewRegistry(s.cfg).List() {
+		if cached.FilePath == served {
+			e = &cached
+			break
+		}
+	}
+	if !e.IsQuant(tag) {
+		servedTag := e.Quant()
+		if servedTag == "" {
+			servedTag = "latest"
+		}
+		s.writeError(w, r, http.StatusNotFound,
+			fmt.Sprintf("model %q not found, this gateway serves %s:%s", name, repo, servedTag),
+			"invalid_request_error", "model_not_found")
+		return "", false
+	}
+	return repo, true
+}
+
+// isOllama reports whether errors for r should use the Ollama shape.
+func isOllama(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// writeOllamaError writes an Ollama error body: {"error": "..."}.
+func writeOllamaError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
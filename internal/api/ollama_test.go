@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/auth"
+	"github.com/llmgw/llmgw/internal/backend"
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+func TestApplyOllamaOptions(t *testing.T) {
+	temp, topK, numPredict, seed := 0.2, 40, 128, 7
+	payload := map[string]interface{}{}
+	applyOllamaOptions(payload, "json", &OllamaOptions{
+		Temperature: &temp,
+		TopK:        &topK,
+		NumPredict:  &numPredict,
+		Seed:        &seed,
+		Stop:        []string{"\n"},
+	})
+	want := map[string]interface{}{
+		"response_format": map[string]string{"type": "json_object"},
+		"temperature":     0.2,
+		"top_k":           40,
+		"max_tokens":      128,
+		"seed":            7,
+		"stop":            []string{"\n"},
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("payload = %v, want %v", payload, want)
+	}
+
+	// Ollama's -1 means "no limit", which is the backend's default too.
+	unlimited := -1
+	payload = map[string]interface{}{}
+	applyOllamaOptions(payload, "", &OllamaOptions{NumPredict: &unlimited})
+	if len(payload) != 0 {
+		t.Errorf("payload = %v, want nothing set", payload)
+	}
+	applyOllamaOptions(payload, "", nil)
+	if len(payload) != 0 {
+		t.Errorf("payload = %v, want nothing set", payload)
+	}
+}
+
+func TestSplitOllamaTag(t *testing.T) {
+	tests := []struct{ name, repo, tag string }{
+		{"org/model:Q4_K_M", "org/model", "Q4_K_M"},
+		{"org/model:latest", "org/model", ""},
+		{"org/model", "org/model", ""},
+	}
+	for _, tt := range tests {
+		repo, tag := splitOllamaTag(tt.name)
+		if repo != tt.repo || tag != tt.tag {
+			t.Errorf("splitOllamaTag(%q) = %q, %q; want %q, %q", tt.name, repo, tag, tt.repo, tt.tag)
+		}
+	}
+}
+
+func TestOllamaModel(t *testing.T) {
+	t.Setenv("LLMGW_HOME", t.TempDir())
+	cfg := config.New()
+	s := &Server{cfg: cfg, pool: backend.NewPool(cfg)}
+	s.pool.Add("org/model", filepath.Join(cfg.ModelsDir, "org_model", "model.Q4_K_M.gguf"), 1<<20)
+
+	tests := []struct {
+		name   string
+		want   string
+		status int
+	}{
+		{"org/model", "org/model", 0},
+		{"org/model:latest", "org/model", 0},
+		{"org/model:Q4_K_M", "org/model", 0},
+		{"org/model:q4_k_m", "org/model", 0},
+		{"org/model:Q8_0", "", http.StatusNotFound},
+		{"org/other:Q8_0", "org/other", 0}, // not served: left to admit
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/chat", nil)
+		got, ok := s.ollamaModel(w, r, tt.name)
+		if got != tt.want || ok != (tt.status == 0) {
+			t.Errorf("ollamaModel(%q) = %q, %v; want %q", tt.name, got, ok, tt.want)
+		}
+		if tt.status != 0 && w.Code != tt.status {
+			t.Errorf("ollamaModel(%q): status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestOllamaFinal(t *testing.T) {
+	start := time.Now()
+	call := &proxyCall{
+		start:      start,
+		firstToken: start.Add(100 * time.Millisecond),
+		end:        start.Add(time.Second),
+		usage:      &Usage{PromptTokens: 12, CompletionTokens: 34},
+	}
+	resp := (&Server{}).ollamaFinal("m", call)
+	if !resp.Done || resp.DoneReason != "stop" || resp.Model != "m" {
+		t.Errorf("done %v, reason %q, model %q", resp.Done, resp.DoneReason, resp.Model)
+	}
+	if resp.PromptEvalCount != 12 || resp.EvalCount != 34 {
+		t.Errorf("counts %d and %d, want 12 and 34", resp.PromptEvalCount, resp.EvalCount)
+	}
+	if resp.TotalDuration != int64(time.Second) || resp.PromptEvalDuration != int64(100*time.Millisecond) ||
+		resp.EvalDuration != int64(900*time.Millisecond) {
+		t.Errorf("durations %d, %d, %d", resp.TotalDuration, resp.PromptEvalDuration, resp.EvalDuration)
+	}
+
+	call.finishReason = "length"
+	call.firstToken = time.Time{}
+	resp = (&Server{}).ollamaFinal("m", call)
+	if resp.DoneReason != "length" || resp.EvalDuration != resp.TotalDuration {
+		t.Errorf("reason %q, eval duration %d, total %d", resp.DoneReason, resp.EvalDuration, resp.TotalDuration)
+	}
+}
+
+func TestWriteOllamaError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeOllamaError(w, http.StatusNotFound, "model not found")
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound || body["error"] != "model not found" {
+		t.Errorf("got %d %v", w.Code, body)
+	}
+}
+
+func TestOllamaPullGate(t *testing.T) {
+	s := testServer(t, "org/tiny-GGUF")
+	req := httptest.NewRequest(http.MethodPost, "/api/pull", strings.NewReader(`{"model":"org/other-GGUF"}`))
+	w := httptest.NewRecorder()
+	s.handleOllamaPull(w, req)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "-allow-pull") {
+		t.Errorf("pull without -allow-pull = %d %s, want 403 naming -allow-pull", w.Code, w.Body.String())
+	}
+
+	s.cfg.AllowPull = true
+	key := &auth.Key{Name: "ci"}
+	req = httptest.NewRequest(http.MethodPost, "/api/pull", strings.NewReader(`{"model":"org/other-GGUF"}`))
+	req = req.WithContext(auth.WithKey(req.Context(), key))
+	w = httptest.NewRecorder()
+	s.handleOllamaPull(w, req)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "/api/pull") {
+		t.Errorf("pull with an unscoped key = %d %s, want 403 naming /api/pull", w.Code, w.Body.String())
+	}
+}
@@ -1,96 +1,258 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/llmgw/llmgw/internal/audit"
+	"github.com/llmgw/llmgw/internal/auth"
+	"github.com/llmgw/llmgw/internal/backend"
+	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/metrics"
+	"github.com/llmgw/llmgw/internal/models"
+	"github.com/llmgw/llmgw/internal/ratelimit"
+	"github.com/llmgw/llmgw/internal/ui"
 )
 
+// maxBodyBytes caps the size of inference request bodies read by the gateway.
+const maxBodyBytes = 32 << 20
+
 // Server is the user-facing HTTP server that proxies requests to llama-server.
 type Server struct {
-	port       int
-	backendURL string
-	modelName  string
-	proxy      *httputil.ReverseProxy
+	cfg     *config.Config
+	port    int
+	origins []string
+	pool    *backend.Pool
+	keys    *auth.Store
+	limiter *ratelimit.Limiter
+	rpm     int
+	tpd     int
+	audit   *audit.Logger
+	proxy   *httputil.ReverseProxy
+	pullMu  sync.Mutex
+
+	http     *http.Server
+	inFlight atomic.Int64    // API requests being served
+	closing  context.Context // done once Shutdown has begun
 }
 
-// NewServer creates an API server that proxies inference to the backend.
-func NewServer(port int, backendURL, modelName string) *Server {
-	target, _ := url.Parse(backendURL)
-	proxy := httputil.NewSingleHostReverseProxy(target)
+// backendKey carries the target backend URL through the request context.
+type backendKey struct{}
+
+// NewServer creates an API server that routes inference to the models in pool.
+func NewServer(cfg *config.Config, pool *backend.Pool) *Server {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(pr.In.Context().Value(backendKey{}).(*url.URL))
+		},
+		ModifyResponse: tapResponse,
+		// Ensure streaming works: disable response buffering
+		FlushInterval: 50 * time.Millisecond,
+	}
 
-	// Ensure streaming works: disable response buffering
-	proxy.FlushInterval = 50 * time.Millisecond
+	registerBackendMetrics(pool)
 
-	return &Server{
-		port:       port,
-		backendURL: backendURL,
-		modelName:  modelName,
-		proxy:      proxy,
+	var auditLog *audit.Logger
+	if cfg.AuditLog != "" {
+		var err error
+		auditLog, err = audit.Open(audit.Options{
+			Path:          cfg.AuditLog,
+			IncludeBodies: cfg.AuditBodies,
+			Redact:        append(append([]string{}, audit.DefaultRedactions...), cfg.AuditRedact...),
+			MaxSize:       cfg.AuditMaxSize,
+			MaxAge:        cfg.AuditMaxAge,
+			MaxBackups:    cfg.AuditMaxBackups,
+		})
+		if err != nil {
+			ui.Warn("Audit log disabled: %v", err)
+		}
 	}
+
+	keys := auth.NewStore(cfg)
+	if cfg.NoAuth && keys.Enabled() {
+		ui.Warn("Authentication is off (-no-auth): API keys are not checked")
+	}
+
+	s := &Server{
+		cfg:     cfg,
+		port:    cfg.Port,
+		origins: cfg.CORSOrigins,
+		pool:    pool,
+		keys:    keys,
+		limiter: ratelimit.New(cfg),
+		rpm:     cfg.RateLimitRPM,
+		tpd:     cfg.RateLimitTPD,
+		audit:   auditLog,
+		proxy:   proxy,
+		http: &http.Server{
+			Addr:         fmt.Sprintf(":%d", cfg.Port),
+			ReadTimeout:  5 * time.Minute,
+			WriteTimeout: 5 * time.Minute,
+			IdleTimeout:  2 * time.Minute,
+		},
+	}
+	proxy.ErrorHandler = s.writeBackendFailure
+
+	// Shutdown waits for handlers to return, so long-lived ones (log
+	// followers) watch closing to end as soon as it begins.
+	var stop context.CancelFunc
+	s.closing, stop = context.WithCancel(context.Background())
+	s.http.RegisterOnShutdown(stop)
+	return s
 }
 
-// ListenAndServe starts the HTTP server (blocking).
+// ListenAndServe starts the HTTP server (blocking). Once Shutdown has been
+// called it returns http.ErrServerClosed.
 func (s *Server) ListenAndServe() error {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/v1/chat/completions", s.cors(s.proxyPost))
-	mux.HandleFunc("/v1/completions", s.cors(s.proxyPost))
-	mux.HandleFunc("/v1/embeddings", s.cors(s.proxyPost))
-	mux.HandleFunc("/v1/models", s.cors(s.handleModels))
+	mux.HandleFunc("/v1/chat/completions", s.cors(s.observe(s.auth(s.proxyPost))))
+	mux.HandleFunc("/v1/completions", s.cors(s.observe(s.auth(s.proxyPost))))
+	mux.HandleFunc("/v1/embeddings", s.cors(s.observe(s.auth(s.proxyPost))))
+	mux.HandleFunc("/v1/messages", s.cors(s.observe(s.auth(s.handleMessages))))
+	mux.HandleFunc("/v1/models", s.cors(s.observe(s.auth(s.handleModels))))
+
+	// Ollama-compatible API
+	mux.HandleFunc("/api/chat", s.cors(s.observe(s.auth(s.handleOllamaChat))))
+	mux.HandleFunc("/api/generate", s.cors(s.observe(s.auth(s.handleOllamaGenerate))))
+	mux.HandleFunc("/api/pull", s.cors(s.observe(s.auth(s.handleOllamaPull))))
+	mux.HandleFunc("/api/tags", s.cors(s.observe(s.auth(s.handleOllamaTags))))
+	mux.HandleFunc("/api/version", s.cors(s.handleOllamaVersion))
+
+	mux.HandleFunc("/admin/logs", s.cors(s.auth(s.handleLogs)))
+
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/metrics", metrics.Handler)
 	mux.HandleFunc("/", s.handleRoot)
 
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", s.port),
-		Handler:      mux,
-		ReadTimeout:  5 * time.Minute,
-		WriteTimeout: 5 * time.Minute,
-		IdleTimeout:  2 * time.Minute,
+	s.http.Handler = mux
+	return s.http.ListenAndServe()
+}
+
+// Shutdown stops accepting connections and waits for the requests in flight
+// to finish, then saves the rate limiter's usage. If ctx ends first, the
+// connections still open are closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		s.http.Close()
 	}
-	return srv.ListenAndServe()
+	if lerr := s.limiter.Close(); lerr != nil {
+		ui.Warn("Could not save rate limit usage: %v", lerr)
+	}
+	return err
+}
+
+// InFlight returns the number of API requests being served.
+func (s *Server) InFlight() int {
+	return int(s.inFlight.Load())
 }
 
 // ------- handlers -------
 
 func (s *Server) proxyPost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed", "invalid_request_error")
+	body, ok := s.readBody(w, r)
+	if !ok {
 		return
 	}
-	s.proxy.ServeHTTP(w, r)
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "request body is not valid JSON", "invalid_request_error", "")
+		return
+	}
+
+	lease := s.admit(w, r, req.Model, body)
+	if lease == nil {
+		return
+	}
+	defer s.release(r, lease)
+
+	target, _ := url.Parse(lease.Manager().BackendURL())
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	ctx := context.WithValue(r.Context(), backendKey{}, target)
+	s.proxy.ServeHTTP(w, r.WithContext(ctx))
 }
 
 func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
-	list := ModelList{
-		Object: "list",
-		Data: []ModelInfo{
-			{
-				ID:      s.modelName,
-				Object:  "model",
-				Created: time.Now().Unix(),
-				OwnedBy: "local",
-			},
-		},
+	list := ModelList{Object: "list", Data: []ModelInfo{}}
+	now := time.Now().Unix()
+	key := auth.FromContext(r.Context())
+	for _, id := range s.pool.Models() {
+		if key != nil && !key.AllowsModel(id) {
+			continue
+		}
+		list.Data = append(list.Data, ModelInfo{
+			ID:            id,
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "local",
+			ContextLength: s.pool.Get(id).ContextSize(),
+		})
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(list)
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	resp, err := http.Get(s.backendURL + "/health")
-	if err != nil {
-		s.writeError(w, http.StatusServiceUnavailable, "backend unavailable", "server_error")
-		return
+	status := http.StatusOK
+	backends := make(map[string]string)
+	for _, id := range s.pool.Models() {
+		if !s.pool.Loaded(id) {
+			backends[id] = "unloaded"
+			continue
+		}
+		mgr := s.pool.Get(id)
+		switch mgr.State() {
+		case backend.StateRestarting:
+			backends[id] = "restarting"
+			status = http.StatusServiceUnavailable
+			continue
+		case backend.StateFailed:
+			backends[id] = "crashed"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		backends[id] = "ok"
+		resp, err := http.Get(mgr.BackendURL() + "/health")
+		if err != nil {
+			backends[id] = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			backends[id] = fmt.Sprintf("HTTP %d", resp.StatusCode)
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	overall := "ok"
+	if status != http.StatusOK {
+		overall = "degraded"
 	}
-	defer resp.Body.Close()
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": overall,
+		"models": backends,
+	})
 }
 
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
@@ -98,15 +260,28 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	backendVersion := "llama.cpp " + s.cfg.BackendVersion
+	switch {
+	case s.cfg.BackendBin != "":
+		backendVersion = "llama-server " + s.cfg.BackendBin
+	case s.cfg.BackendVersion == "":
+		backendVersion = "llama.cpp (unversioned)"
+	}
 	info := map[string]interface{}{
 		"name":    "LLM Gateway",
 		"version": "1.0.0",
-		"model":   s.modelName,
+		"backend": backendVersion,
+		"models":  s.pool.Models(),
 		"endpoints": map[string]string{
 			"chat_completions": "/v1/chat/completions",
 			"completions":      "/v1/completions",
+			"messages":         "/v1/messages",
+			"embeddings":       "/v1/embeddings",
 			"models":           "/v1/models",
+			"ollama":           "/api/chat, /api/generate, /api/tags, /api/pull",
+			"logs":             "/admin/logs",
 			"health":           "/health",
+			"metrics":          "/metrics",
 		},
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -117,11 +292,109 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 
 // ------- helpers -------
 
+// readBody checks that the request is a POST and reads its body.
+// It writes an error response and returns false on failure.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, r, http.StatusMethodNotAllowed, "method not allowed", "invalid_request_error", "")
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "could not read request body", "invalid_request_error", "")
+		return nil, false
+	}
+	return body, true
+}
+
+// admit resolves the requested model, checks the caller's scopes and rate
+// limits, and acquires a lease on the model's backend. It writes an error
+// response and returns nil if the request cannot proceed.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request, model string, body []byte) *backend.Lease {
+	id := s.resolveModel(model)
+	if id == "" {
+		msg := fmt.Sprintf("The model `%s` does not exist", model)
+		if model == "" {
+			msg = "model is required; one of: " + strings.Join(s.pool.Models(), ", ")
+		}
+		s.writeError(w, r, http.StatusNotFound, msg, "invalid_request_error", "model_not_found")
+		return nil
+	}
+	call := callFromContext(r.Context())
+	call.model = id
+
+	if key := auth.FromContext(r.Context()); key != nil && !key.AllowsModel(id) {
+		s.writeError(w, r, http.StatusForbidden,
+			fmt.Sprintf("This API key is not permitted to use model `%s`", id),
+			"invalid_request_error", "model_not_allowed")
+		return nil
+	}
+
+	call.client = auth.ClientID(r)
+	if s.audit != nil && s.audit.IncludeBodies() {
+		call.captureText = true
+		call.prompt = string(body)
+	}
+	if !s.checkRateLimit(w, r, call.client) {
+		return nil
+	}
+
+	// The lease keeps the model loaded until the response has been streamed.
+	lease, err := s.pool.Acquire(id)
+	if err != nil {
+		if errors.Is(err, backend.ErrOverBudget) || errors.Is(err, backend.ErrNoMemory) {
+			s.writeError(w, r, http.StatusServiceUnavailable, err.Error(), "server_error", "model_overloaded")
+			return nil
+		}
+		if errors.Is(err, backend.ErrCrashed) {
+			s.writeError(w, r, http.StatusServiceUnavailable, err.Error(), "server_error", "backend_crashed")
+			return nil
+		}
+		s.writeError(w, r, http.StatusServiceUnavailable, err.Error(), "server_error", "")
+		return nil
+	}
+	call.lease = lease
+	if !s.checkContext(w, r, lease, body) {
+		lease.Release()
+		return nil
+	}
+	return lease
+}
+
+// release returns the lease and charges the call's token usage to the client.
+func (s *Server) release(r *http.Request, lease *backend.Lease) {
+	lease.Release()
+	if call := callFromContext(r.Context()); call.usage != nil {
+		s.limiter.AddTokens(call.client, call.usage.TotalTokens)
+	}
+}
+
+// resolveModel maps the model named in a request to a pooled model ID, or ""
+// if it is not served. Aliases are accepted. The name may only be omitted
+// when a single model is served.
+func (s *Server) resolveModel(name string) string {
+	if name == "" {
+		if ids := s.pool.Models(); len(ids) == 1 {
+			return ids[0]
+		}
+		return ""
+	}
+	for _, id := range []string{name, models.ResolveAlias(name)} {
+		if s.pool.Get(id) != nil {
+			return id
+		}
+	}
+	return ""
+}
+
 func (s *Server) cors(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if origin := s.allowedOrigin(r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-api-key, anthropic-version")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -130,10 +403,123 @@ func (s *Server) cors(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func (s *Server) writeError(w http.ResponseWriter, status int, msg, errType string) {
+// checkRateLimit applies the client's request and token limits, setting the
+// x-ratelimit-* headers. It writes a 429 and returns false when a limit is hit.
+func (s *Server) checkRateLimit(w http.ResponseWriter, r *http.Request, client string) bool {
+	rpm, tpd := s.rpm, s.tpd
+	if key := auth.FromContext(r.Context()); key != nil {
+		if key.RPM > 0 {
+			rpm = key.RPM
+		}
+		if key.TPD > 0 {
+			tpd = key.TPD
+		}
+	}
+	if rpm <= 0 && tpd <= 0 {
+		return true
+	}
+
+	d := s.limiter.Allow(client, rpm, tpd)
+	h := w.Header()
+	if rpm > 0 {
+		h.Set("x-ratelimit-limit-requests", strconv.Itoa(d.LimitRequests))
+		h.Set("x-ratelimit-remaining-requests", strconv.Itoa(d.RemainingRequests))
+		h.Set("x-ratelimit-reset-requests", formatReset(d.ResetRequests))
+	}
+	if tpd > 0 {
+		h.Set("x-ratelimit-limit-tokens", strconv.Itoa(d.LimitTokens))
+		h.Set("x-ratelimit-remaining-tokens", strconv.Itoa(d.RemainingTokens))
+		h.Set("x-ratelimit-reset-tokens", formatReset(d.ResetTokens))
+	}
+	if d.Allowed {
+		return true
+	}
+
+	retry := int(d.RetryAfter().Seconds() + 0.999)
+	h.Set("Retry-After", strconv.Itoa(retry))
+	msg := fmt.Sprintf("Rate limit reached for requests per minute: limit %d. Please try again in %s.",
+		d.LimitRequests, formatReset(d.ResetRequests))
+	if d.Exceeded == "tokens" {
+		msg = fmt.Sprintf("Rate limit reached for tokens per day: limit %d. Please try again in %s.",
+			d.LimitTokens, formatReset(d.ResetTokens))
+	}
+	s.writeError(w, r, http.StatusTooManyRequests, msg, d.Exceeded, "rate_limit_exceeded")
+	return false
+}
+
+// formatReset renders a duration the way OpenAI's reset headers do, e.g. "6m0s" or "1.5s".
+func formatReset(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// origin, or "" if cross-origin access should not be granted.
+func (s *Server) allowedOrigin(origin string) string {
+	for _, o := range s.origins {
+		if o == "*" {
+			return "*"
+		}
+		if origin != "" && o == origin {
+			return origin
+		}
+	}
+	return ""
+}
+
+// auth rejects requests without a valid API key once a key has been created,
+// unless the gateway runs with -no-auth, and enforces the key's endpoint
+// scopes. Model scopes are checked after the request's model has been
+// resolved.
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.NoAuth || !s.keys.Enabled() {
+			next(w, r)
+			return
+		}
+
+		token := auth.RequestToken(r)
+		if token == "" {
+			s.writeError(w, r, http.StatusUnauthorized,
+				"You didn't provide an API key. Pass it as a Bearer token in the Authorization header.",
+				"invalid_request_error", "invalid_api_key")
+			return
+		}
+		key := s.keys.Authenticate(token)
+		if key == nil {
+			s.writeError(w, r, http.StatusUnauthorized, "Incorrect API key provided.",
+				"invalid_request_error", "invalid_api_key")
+			return
+		}
+		if !key.AllowsEndpoint(r.URL.Path) {
+			s.writeError(w, r, http.StatusForbidden,
+				fmt.Sprintf("This API key is not permitted to access %s", r.URL.Path),
+				"invalid_request_error", "endpoint_not_allowed")
+			return
+		}
+		if call := callFromContext(r.Context()); call != nil {
+			call.keyID = key.ID
+		}
+		next(w, r.WithContext(auth.WithKey(r.Context(), key)))
+	}
+}
+
+// writeError writes an OpenAI-shaped error, or the Anthropic or Ollama shape
+// for those APIs.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, status int, msg, errType, code string) {
+	if isAnthropic(r) {
+		writeAnthropicError(w, status, msg)
+		return
+	}
+	if isOllama(r) {
+		writeOllamaError(w, status, msg)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(ErrorResponse{
-		Error: ErrorDetail{Message: msg, Type: errType},
+		Error: ErrorDetail{Message: msg, Type: errType, Code: code},
 	})
 }
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/llmgw/llmgw/internal/backend"
+	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/models"
+)
+
+// testServer returns a server whose pool holds the given models. Nothing is
+// started until a model is acquired.
+func testServer(t *testing.T, ids ...string) *Server {
+	t.Helper()
+	t.Setenv("LLMGW_HOME", t.TempDir())
+	cfg := config.New()
+	s := &Server{cfg: cfg, pool: backend.NewPool(cfg)}
+	for _, id := range ids {
+		s.pool.Add(id, filepath.Join(cfg.ModelsDir, filepath.Base(id)+".Q4_K_M.gguf"), 1<<20)
+	}
+	return s
+}
+
+func TestResolveModel(t *testing.T) {
+	alias := "tinyllama"
+	repo := models.Aliases[alias]
+
+	single := testServer(t, repo)
+	for name, want := range map[string]string{
+		"":              repo,
+		repo:            repo,
+		alias:           repo,
+		"gpt-3.5-turbo": "",
+	} {
+		if got := single.resolveModel(name); got != want {
+			t.Errorf("one model: resolveModel(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	several := testServer(t, repo, "org/other")
+	for name, want := range map[string]string{
+		"":              "",
+		alias:           repo,
+		"org/other":     "org/other",
+		"gpt-3.5-turbo": "",
+	} {
+		if got := several.resolveModel(name); got != want {
+			t.Errorf("two models: resolveModel(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package api
 
+import "encoding/json"
+
 // ---- OpenAI-compatible request/response types ----
 
 // ChatCompletionRequest is the body of POST /v1/chat/completions.
@@ -86,6 +88,8 @@ type ModelInfo struct {
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+	// ContextLength is the context window the model is served with.
+	ContextLength int `json:"context_length,omitempty"`
 }
 
 // ErrorResponse wraps an API error.
@@ -99,3 +103,61 @@ type ErrorDetail struct {
 	Type    string `json:"type"`
 	Code    string `json:"code,omitempty"`
 }
+
+// ---- Anthropic Messages API types ----
+
+// MessagesRequest is the body of POST /v1/messages.
+type MessagesRequest struct {
+	Model         string             `json:"model"`
+	System        json.RawMessage    `json:"system,omitempty"`
+	Messages      []AnthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	TopK          *int               `json:"top_k,omitempty"`
+}
+
+// AnthropicMessage is one conversation turn. Content is either a string or
+// an array of content blocks.
+type AnthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ContentBlock is one block of message content.
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// MessagesResponse is a non-streaming Messages API response.
+type MessagesResponse struct {
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Model        string         `json:"model"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   *string        `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Usage        AnthropicUsage `json:"usage"`
+}
+
+// AnthropicUsage contains Messages API token counts.
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicError is the Messages API error envelope.
+type AnthropicError struct {
+	Type  string               `json:"type"`
+	Error AnthropicErrorDetail `json:"error"`
+}
+
+// AnthropicErrorDetail has the error fields.
+type AnthropicErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
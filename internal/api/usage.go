@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/backend"
+)
+
+// maxTapBytes caps how much of a non-streamed response is buffered for parsing.
+const maxTapBytes = 8 << 20
+
+// proxyCall collects what the gateway learns about one proxied request.
+// It is carried in the request context so ModifyResponse can find it.
+type proxyCall struct {
+	model      string
+	start      time.Time
+	firstToken time.Time // first streamed event; zero for non-streamed responses
+	end        time.Time
+	usage      *Usage
+
+	keyID        string
+	client       string
+	lease        *backend.Lease
+	stream       bool
+	finishReason string
+	// prompt and completion are only captured when the audit log stores bodies.
+	captureText bool
+	prompt      string
+	completion  strings.Builder
+}
+
+type callKey struct{}
+
+func withCall(ctx context.Context, c *proxyCall) context.Context {
+	return context.WithValue(ctx, callKey{}, c)
+}
+
+func callFromContext(ctx context.Context) *proxyCall {
+	c, _ := ctx.Value(callKey{}).(*proxyCall)
+	return c
+}
+
+// backendChunk is the subset of a llama-server completion response, or of one
+// streamed chunk, that the gateway inspects. It covers chat and text
+// completions alike.
+type backendChunk struct {
+	Choices []struct {
+		Text         string       `json:"text"`
+		Message      *ChatMessage `json:"message"`
+		Delta        *ChatMessage `json:"delta"`
+		FinishReason *string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage   *Usage `json:"usage"`
+	Timings *struct {
+		PromptN    int `json:"prompt_n"`
+		PredictedN int `json:"predicted_n"`
+	} `json:"timings"`
+}
+
+// text returns the generated text carried by the chunk's first choice.
+func (c *backendChunk) text() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	ch := c.Choices[0]
+	switch {
+	case ch.Delta != nil:
+		return ch.Delta.Content
+	case ch.Message != nil:
+		return ch.Message.Content
+	}
+	return ch.Text
+}
+
+// record updates the call with the chunk's finish reason, text and usage.
+// Usage is taken from the "usage" block, falling back to llama-server's
+// "timings" counters.
+func (c *proxyCall) record(chunk *backendChunk) {
+	for _, ch := range chunk.Choices {
+		if ch.FinishReason != nil && *ch.FinishReason != "" {
+			c.finishReason = *ch.FinishReason
+		}
+	}
+	if c.captureText {
+		c.completion.WriteString(chunk.text())
+	}
+
+	switch {
+	case chunk.Usage != nil:
+		c.usage = chunk.Usage
+	case chunk.Timings != nil && c.usage == nil:
+		c.usage = &Usage{
+			PromptTokens:     chunk.Timings.PromptN,
+			CompletionTokens: chunk.Timings.PredictedN,
+			TotalTokens:      chunk.Timings.PromptN + chunk.Timings.PredictedN,
+		}
+	}
+}
+
+// tapResponse wraps the backend response body so token usage can be read
+// from it as it streams through to the client.
+func tapResponse(resp *http.Response) error {
+	c := callFromContext(resp.Request.Context())
+	if c == nil {
+		return nil
+	}
+	stream := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	c.stream = stream
+	resp.Body = &responseTap{ReadCloser: resp.Body, call: c, stream: stream}
+	return nil
+}
+
+// responseTap observes a response body without altering it. Non-streamed
+// bodies are buffered and parsed once; SSE streams are parsed line by line.
+type responseTap struct {
+	io.ReadCloser
+	call   *proxyCall
+	stream bool
+	buf    bytes.Buffer
+	once   sync.Once
+}
+
+func (t *responseTap) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.observe(p[:n])
+	}
+	if err == io.EOF {
+		t.finish()
+	}
+	return n, err
+}
+
+func (t *responseTap) Close() error {
+	t.finish()
+	return t.ReadCloser.Close()
+}
+
+func (t *responseTap) observe(p []byte) {
+	if !t.stream {
+		if t.buf.Len()+len(p) <= maxTapBytes {
+			t.buf.Write(p)
+		}
+		return
+	}
+	t.buf.Write(p)
+	for {
+		line, err := t.buf.ReadBytes('\n')
+		if err != nil {
+			// Incomplete line: keep it for the next read.
+			rest := append([]byte(nil), line...)
+			t.buf.Reset()
+			t.buf.Write(rest)
+			return
+		}
+		t.observeEvent(line)
+	}
+}
+
+// observeEvent parses one SSE line and records its chunk on the call.
+func (t *responseTap) observeEvent(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+	if t.call.firstToken.IsZero() {
+		t.call.firstToken = time.Now()
+	}
+	t.parse(data)
+}
+
+func (t *responseTap) parse(data []byte) {
+	var chunk backendChunk
+	if json.Unmarshal(data, &chunk) == nil {
+		t.call.record(&chunk)
+	}
+}
+
+func (t *responseTap) finish() {
+	t.once.Do(func() {
+		t.call.end = time.Now()
+		if t.stream {
+			if t.buf.Len() > 0 {
+				t.observeEvent(t.buf.Bytes())
+			}
+			return
+		}
+		t.parse(t.buf.Bytes())
+	})
+}
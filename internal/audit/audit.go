@@ -0,0 +1,208 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRedactions match common personal data and credentials.
+var DefaultRedactions = []string{
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,                             // email addresses
+	`\bsk-[A-Za-z0-9_-]{16,}`,                                                    // OpenAI-style API keys
+	`\b(?:ghp|gho|ghs|github_pat)_[A-Za-z0-9_]{20,}`,                             // GitHub tokens
+	`\bhf_[A-Za-z0-9]{20,}`,                                                      // HuggingFace tokens
+	`\bAKIA[0-9A-Z]{16}\b`,                                                       // AWS access key IDs
+	`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{16,}`,                                     // bearer tokens
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`, // PEM keys
+}
+
+// Record is one audited API call, written as a single JSON line.
+type Record struct {
+	Time             time.Time `json:"ts"`
+	KeyID            string    `json:"key_id,omitempty"`
+	Client           string    `json:"client,omitempty"`
+	Model            string    `json:"model,omitempty"`
+	Endpoint         string    `json:"endpoint"`
+	Status           int       `json:"status"`
+	LatencyMS        int64     `json:"latency_ms"`
+	Stream           bool      `json:"stream,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	FinishReason     string    `json:"finish_reason,omitempty"`
+	Prompt           string    `json:"prompt,omitempty"`
+	Completion       string    `json:"completion,omitempty"`
+}
+
+// Options configures a Logger.
+type Options struct {
+	Path string
+	// IncludeBodies stores the request body and completion text.
+	IncludeBodies bool
+	// Redact lists regular expressions whose matches are replaced before writing.
+	Redact []string
+	// MaxSize rotates the file once it grows past this many bytes (0 = never).
+	MaxSize int64
+	// MaxAge rotates the file once it is older than this (0 = never).
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files to keep.
+	MaxBackups int
+}
+
+// Logger appends audit records to a JSONL file with size/age rotation.
+type Logger struct {
+	opts     Options
+	redact   []*regexp.Regexp
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	rotated  time.Time // time in the name of the last rotated file
+}
+
+// Open creates the log directory and opens (or appends to) the audit file.
+func Open(opts Options) (*Logger, error) {
+	l := &Logger{opts: opts}
+	for _, expr := range opts.Redact {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		l.redact = append(l.redact, re)
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0755); err != nil {
+		return nil, fmt.Errorf("creating audit directory: %w", err)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// IncludeBodies reports whether prompts and completions should be recorded.
+func (l *Logger) IncludeBodies() bool {
+	return l.opts.IncludeBodies
+}
+
+// Log redacts and writes rec. Errors are ignored so auditing never fails a request.
+func (l *Logger) Log(rec Record) {
+	if !l.opts.IncludeBodies {
+		rec.Prompt, rec.Completion = "", ""
+	}
+	rec.Prompt = l.scrub(rec.Prompt)
+	rec.Completion = l.scrub(rec.Completion)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shouldRotate(int64(len(line))) {
+		l.rotate()
+	}
+	if l.f == nil {
+		return
+	}
+	n, _ := l.f.Write(line)
+	l.size += int64(n)
+}
+
+// Close closes the audit file.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// ------- internal helpers -------
+
+func (l *Logger) scrub(s string) string {
+	for _, re := range l.redact {
+		s = re.ReplaceAllString(s, "[REDACTED]")
+	}
+	return s
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size, l.openedAt = f, info.Size(), info.ModTime()
+	if l.size == 0 {
+		l.openedAt = time.Now()
+	}
+	return nil
+}
+
+// shouldRotate reports whether writing n more bytes requires a new file.
+// Must be called with l.mu held.
+func (l *Logger) shouldRotate(n int64) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.opts.MaxSize > 0 && l.size+n > l.opts.MaxSize {
+		return true
+	}
+	return l.opts.MaxAge > 0 && time.Since(l.openedAt) > l.opts.MaxAge
+}
+
+// rotatedName returns a free name for a log rotated at t, and the time it
+// carries. Names carry the time to the millisecond; should one be taken, or
+// not be later than after, the time is moved on so that names stay unique and
+// in order even once pruning has freed earlier ones.
+func rotatedName(base, ext string, t, after time.Time) (string, time.Time) {
+	t = t.Truncate(time.Millisecond)
+	if !t.After(after) {
+		t = after.Add(time.Millisecond)
+	}
+	for {
+		name := fmt.Sprintf("%s-%s%s", base, t.Format("20060102T150405.000"), ext)
+		if _, err := os.Lstat(name); err != nil {
+			return name, t
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// rotate renames the current file with a timestamp suffix, opens a fresh one
+// and prunes old backups. Must be called with l.mu held.
+func (l *Logger) rotate() {
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+
+	ext := filepath.Ext(l.opts.Path)
+	base := strings.TrimSuffix(l.opts.Path, ext)
+	var name string
+	name, l.rotated = rotatedName(base, ext, time.Now(), l.rotated)
+	os.Rename(l.opts.Path, name)
+	l.open()
+
+	backups, _ := filepath.Glob(base + "-*" + ext)
+	sort.Strings(backups) // timestamps sort chronologically
+	for len(backups) > l.opts.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
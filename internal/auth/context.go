@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type keyCtx struct{}
+
+// WithKey returns a context carrying the authenticated key.
+func WithKey(ctx context.Context, k *Key) context.Context {
+	return context.WithValue(ctx, keyCtx{}, k)
+}
+
+// FromContext returns the authenticated key, or nil when auth is disabled.
+func FromContext(ctx context.Context) *Key {
+	k, _ := ctx.Value(keyCtx{}).(*Key)
+	return k
+}
+
+// ClientID identifies the caller for rate limiting: the key ID when
+// authenticated, otherwise the remote IP. An unchecked token is not used, as
+// a client could then escape its limits by sending a new one each time.
+func ClientID(r *http.Request) string {
+	if k := FromContext(r.Context()); k != nil {
+		return "key:" + k.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// RequestToken extracts the API key from the Authorization bearer token, or
+// from the x-api-key header used by Anthropic clients.
+func RequestToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return strings.TrimSpace(r.Header.Get("x-api-key"))
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientID(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	r.RemoteAddr = "192.0.2.7:51234"
+	if got := ClientID(r); got != "ip:192.0.2.7" {
+		t.Errorf("no token: ClientID = %q, want ip:192.0.2.7", got)
+	}
+
+	// An unchecked token does not identify the client, or it could dodge
+	// its limits by sending a new one each time.
+	r.Header.Set("Authorization", "Bearer sk-anything")
+	if got := ClientID(r); got != "ip:192.0.2.7" {
+		t.Errorf("unchecked token: ClientID = %q, want ip:192.0.2.7", got)
+	}
+
+	r = r.WithContext(WithKey(r.Context(), &Key{ID: "k1"}))
+	if got := ClientID(r); got != "key:k1" {
+		t.Errorf("authenticated: ClientID = %q, want key:k1", got)
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct{ header, value, want string }{
+		{"Authorization", "Bearer sk-1", "sk-1"},
+		{"Authorization", "bearer  sk-2 ", "sk-2"},
+		{"Authorization", "Basic dXNlcg==", ""},
+		{"x-api-key", "sk-3", "sk-3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/v1/models", nil)
+		r.Header.Set(tt.header, tt.value)
+		if got := RequestToken(r); got != tt.want {
+			t.Errorf("%s: %s: RequestToken = %q, want %q", tt.header, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+// secretPrefix marks gateway API keys so they are recognisable in configs.
+const secretPrefix = "sk-llmgw-"
+
+// Key is a stored API key. Only the SHA-256 hash of the secret is kept.
+type Key struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Prefix    string   `json:"prefix"`
+	Hash      string   `json:"hash"`
+	Models    []string `json:"models,omitempty"`
+	Endpoints []string `json:"endpoints,omitempty"`
+	// RPM and TPD override the gateway's default rate limits when non-zero.
+	RPM     int       `json:"rpm,omitempty"`
+	TPD     int       `json:"tpd,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Store manages API keys persisted in keys.json.
+type Store struct {
+	path    string
+	mu      sync.RWMutex
+	keys    []Key
+	modTime time.Time
+	// exists records whether keys.json exists, or may: it is only false
+	// when the file is known to be missing.
+	exists bool
+}
+
+// NewStore initialises the key store and loads existing keys.
+func NewStore(cfg *config.Config) *Store {
+	s := &Store{path: filepath.Join(cfg.HomeDir, "keys.json")}
+	s.reload()
+	return s
+}
+
+// Enabled reports whether authentication is enforced: whether a key has
+// ever been created. Revoking every key leaves keys.json in place, so
+// authentication stays on and every request is rejected; a gateway run with
+// -no-auth is the only way to serve without keys again.
+func (s *Store) Enabled() bool {
+	s.reload()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.exists
+}
+
+// Create generates a new key from the given template and returns its secret.
+// Name, scopes and limits are taken from tmpl; the secret is not stored and
+// cannot be recovered later.
+func (s *Store) Create(tmpl Key) (string, Key, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", Key{}, fmt.Errorf("generating key: %w", err)
+	}
+	secret := secretPrefix + hex.EncodeToString(raw)
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", Key{}, fmt.Errorf("generating key ID: %w", err)
+	}
+
+	key := tmpl
+	key.ID = "key_" + hex.EncodeToString(id)
+	key.Prefix = secret[:len(secretPrefix)+4]
+	key.Hash = hashSecret(secret)
+	key.Created = time.Now()
+
+	s.reload()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	if err := s.save(); err != nil {
+		return "", Key{}, err
+	}
+	return secret, key, nil
+}
+
+// List returns all stored keys.
+func (s *Store) List() []Key {
+	s.reload()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Key, len(s.keys))
+	copy(out, s.keys)
+	return out
+}
+
+// Revoke deletes the key with the given ID, or every key with the given
+// name, and returns how many were deleted.
+func (s *Store) Revoke(idOrName string) (int, error) {
+	s.reload()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		if k.ID != idOrName && k.Name != idOrName {
+			kept = append(kept, k)
+		}
+	}
+	n := len(s.keys) - len(kept)
+	if n == 0 {
+		return 0, fmt.Errorf("key %q not found", idOrName)
+	}
+	s.keys = kept
+	return n, s.save()
+}
+
+// Authenticate returns the key matching secret, or nil.
+func (s *Store) Authenticate(secret string) *Key {
+	s.reload()
+	h := []byte(hashSecret(secret))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.keys {
+		if subtle.ConstantTimeCompare(h, []byte(s.keys[i].Hash)) == 1 {
+			k := s.keys[i]
+			return &k
+		}
+	}
+	return nil
+}
+
+// AllowsModel reports whether the key may use the model with the given ID.
+// A key without model scopes may use every model.
+func (k *Key) AllowsModel(id string) bool {
+	if len(k.Models) == 0 {
+		return true
+	}
+	for _, m := range k.Models {
+		if m == id {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsEndpoint reports whether the key may call the given URL path.
+// Scopes match exactly or as a path prefix ending in "/", so "/v1/" grants
+// every OpenAI endpoint. A key without endpoint scopes may call every endpoint.
+func (k *Key) AllowsEndpoint(path string) bool {
+	if len(k.Endpoints) == 0 {
+		return true
+	}
+	for _, e := range k.Endpoints {
+		if e == path || (strings.HasSuffix(e, "/") && strings.HasPrefix(path, e)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ------- internal helpers -------
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// reload re-reads keys.json if it changed on disk, so keys created or revoked
+// from the CLI take effect in a running gateway.
+func (s *Store) reload() {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		s.mu.Lock()
+		s.keys, s.modTime = nil, time.Time{}
+		// Fail closed if keys.json cannot be checked.
+		s.exists = !errors.Is(err, fs.ErrNotExist)
+		s.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	s.exists = true
+	s.mu.Unlock()
+
+	s.mu.RLock()
+	fresh := info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.keys, s.modTime = keys, info.ModTime()
+	s.mu.Unlock()
+}
+
+// save writes keys.json. Must be called with s.mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	s.exists = true
+	return nil
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+func newStore(t *testing.T) (*Store, *config.Config) {
+	t.Helper()
+	cfg := &config.Config{HomeDir: t.TempDir()}
+	return NewStore(cfg), cfg
+}
+
+func TestCreateAuthenticate(t *testing.T) {
+	s, cfg := newStore(t)
+	if s.Enabled() {
+		t.Fatalf("enabled before any key was created")
+	}
+
+	secret, key, err := s.Create(Key{Name: "ci", Models: []string{"org/model"}, RPM: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, secretPrefix) || !strings.HasPrefix(secret, key.Prefix) {
+		t.Errorf("secret %q does not start with %q and prefix %q", secret, secretPrefix, key.Prefix)
+	}
+	if !strings.HasPrefix(key.ID, "key_") || key.Name != "ci" || key.RPM != 5 || key.Created.IsZero() {
+		t.Errorf("key = %+v", key)
+	}
+	if !s.Enabled() {
+		t.Errorf("not enabled after a key was created")
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.HomeDir, "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Errorf("keys.json contains the secret")
+	}
+
+	if got := s.Authenticate(secret); got == nil || got.ID != key.ID {
+		t.Errorf("Authenticate(secret) = %+v, want key %s", got, key.ID)
+	}
+	for _, wrong := range []string{"", key.Prefix, secret + "x", key.Hash} {
+		if got := s.Authenticate(wrong); got != nil {
+			t.Errorf("Authenticate(%q) = key %s, want nil", wrong, got.ID)
+		}
+	}
+
+	// A gateway started later reads the key from keys.json.
+	if got := NewStore(cfg).Authenticate(secret); got == nil || got.ID != key.ID {
+		t.Errorf("new store: Authenticate(secret) = %+v, want key %s", got, key.ID)
+	}
+}
+
+func TestCreateUnique(t *testing.T) {
+	s, _ := newStore(t)
+	secret1, key1, err := s.Create(Key{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret2, key2, err := s.Create(Key{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret1 == secret2 || key1.ID == key2.ID || key1.Hash == key2.Hash {
+		t.Errorf("two keys share a secret, ID or hash")
+	}
+	if len(s.List()) != 2 {
+		t.Errorf("List has %d keys, want 2", len(s.List()))
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s, _ := newStore(t)
+	secret1, key1, _ := s.Create(Key{Name: "shared"})
+	secret2, _, _ := s.Create(Key{Name: "shared"})
+	secret3, key3, _ := s.Create(Key{Name: "other"})
+
+	if n, err := s.Revoke(key1.ID); n != 1 || err != nil {
+		t.Fatalf("Revoke(%s) = %d, %v; want 1", key1.ID, n, err)
+	}
+	if s.Authenticate(secret1) != nil {
+		t.Errorf("revoked key still authenticates")
+	}
+	if _, _, err := s.Create(Key{Name: "shared"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Revoke("shared"); n != 2 || err != nil {
+		t.Errorf("Revoke(shared) = %d, %v; want 2", n, err)
+	}
+	if s.Authenticate(secret2) != nil {
+		t.Errorf("key revoked by name still authenticates")
+	}
+	if got := s.Authenticate(secret3); got == nil || got.ID != key3.ID {
+		t.Errorf("unrelated key revoked")
+	}
+	if _, err := s.Revoke("shared"); err == nil {
+		t.Errorf("revoking a missing key succeeded")
+	}
+
+	// Authentication stays on once every key is gone.
+	if _, err := s.Revoke("other"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.List()) != 0 || !s.Enabled() {
+		t.Errorf("after revoking every key: %d keys, enabled %v; want 0, true", len(s.List()), s.Enabled())
+	}
+}
+
+func TestEnabledFailsClosed(t *testing.T) {
+	s, cfg := newStore(t)
+	// keys.json cannot be checked: a file sits where its directory should be.
+	s.path = filepath.Join(cfg.HomeDir, "home", "keys.json")
+	os.WriteFile(filepath.Join(cfg.HomeDir, "home"), nil, 0644)
+	if !s.Enabled() {
+		t.Errorf("enabled = false when keys.json cannot be checked")
+	}
+}
+
+func TestAllows(t *testing.T) {
+	open := &Key{}
+	if !open.AllowsModel("any/model") || !open.AllowsEndpoint("/v1/chat/completions") {
+		t.Errorf("a key without scopes should allow everything")
+	}
+
+	k := &Key{Models: []string{"org/a"}, Endpoints: []string{"/v1/", "/api/tags"}}
+	for model, want := range map[string]bool{"org/a": true, "org/b": false, "org/a2": false} {
+		if got := k.AllowsModel(model); got != want {
+			t.Errorf("AllowsModel(%q) = %v, want %v", model, got, want)
+		}
+	}
+	for path, want := range map[string]bool{
+		"/v1/chat/completions": true,
+		"/v1/models":           true,
+		"/api/tags":            true,
+		"/api/tags/x":          false,
+		"/api/chat":            false,
+		"/admin/logs":          false,
+	} {
+		if got := k.AllowsEndpoint(path); got != want {
+			t.Errorf("AllowsEndpoint(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package backend
+
+import (
+	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/gguf"
+)
+
+// ContextSize returns the context window to run the model at modelPath
+// with: cfg.CtxSize if set, or else ("-context auto") the length the model
+// was trained with, reduced to what fits in available bytes of memory next
+// to weightBytes of weights. available is 0 if unknown. Models whose header
+// does not record a trained length get config.DefaultCtx.
+func ContextSize(cfg *config.Config, modelPath string, weightBytes, available int64) int {
+	if cfg.CtxSize > 0 {
+		return cfg.CtxSize
+	}
+	f, err := gguf.ReadModel(modelPath)
+	if err != nil || f.ContextLength() == 0 {
+		return config.DefaultCtx
+	}
+	return f.FitContext(weightBytes, available)
+}
@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+// writeModel writes a GGUF header for a llama model trained with a context
+// of ctx tokens, with TinyLlama's shape.
+func writeModel(t *testing.T, path string, ctx uint32) {
+	t.Helper()
+	var b bytes.Buffer
+	w := func(v interface{}) { binary.Write(&b, binary.LittleEndian, v) }
+	str := func(s string) { w(uint64(len(s))); b.WriteString(s) }
+	const typeUint32, typeString = 4, 8
+
+	w([]byte("GGUF"))
+	w(uint32(3)) // version
+	w(uint64(0)) // tensors
+	w(uint64(6)) // metadata
+	str("general.architecture")
+	w(uint32(typeString))
+	str("llama")
+	for _, kv := range []struct {
+		key   string
+		value uint32
+	}{
+		{"llama.context_length", ctx},
+		{"llama.block_count", 22},
+		{"llama.embedding_length", 2048},
+		{"llama.attention.head_count", 32},
+		{"llama.attention.head_count_kv", 4},
+	} {
+		str(kv.key)
+		w(uint32(typeUint32))
+		w(kv.value)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextSize(t *testing.T) {
+	t.Setenv("LLMGW_HOME", t.TempDir())
+	dir := t.TempDir()
+	trained := filepath.Join(dir, "long.gguf")
+	writeModel(t, trained, 32768)
+	unknown := filepath.Join(dir, "unknown.gguf")
+	writeModel(t, unknown, 0)
+
+	auto := config.New()
+	auto.CtxSize = 0
+	fixed := config.New()
+	fixed.CtxSize = 4096
+
+	tests := []struct {
+		name      string
+		cfg       *config.Config
+		path      string
+		available int64
+		want      int
+	}{
+		{"set explicitly", fixed, trained, 1 << 20, 4096},
+		{"trained length", auto, trained, 64 << 30, 32768},
+		{"fitted to memory", auto, trained, 1 << 20, 2048},
+		{"no trained length", auto, unknown, 64 << 30, config.DefaultCtx},
+		{"unreadable model", auto, filepath.Join(dir, "missing.gguf"), 64 << 30, config.DefaultCtx},
+	}
+	for _, tt := range tests {
+		if got := ContextSize(tt.cfg, tt.path, 600<<20, tt.available); got != tt.want {
+			t.Errorf("%s: ContextSize = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
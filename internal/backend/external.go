@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/ui"
+)
+
+// versionTimeout bounds how long `llama-server --version` may take.
+const versionTimeout = 10 * time.Second
+
+// CheckBinary runs `path --version` to make sure path is a working
+// llama-server, and returns the version it reports, e.g. "4567 (3f1ae2e3)".
+func CheckBinary(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("llama-server binary: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			lines := strings.Split(msg, "\n")
+			return "", fmt.Errorf("%s --version failed (%v): %s", path, err, lines[len(lines)-1])
+		}
+		return "", fmt.Errorf("%s --version failed: %w", path, err)
+	}
+
+	// llama.cpp tools print "version: <build> (<commit>)" followed by
+	// compiler details.
+	for _, line := range strings.Split(string(out), "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "version:"); ok {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	return "", fmt.Errorf("%s does not look like llama-server: --version printed no version", path)
+}
+
+// FindOnPath returns the llama-server binary on $PATH, or "".
+func FindOnPath() string {
+	path, err := exec.LookPath(config.BackendBinaryName())
+	if err != nil {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path
+}
+
+// useExternal validates the configured external binary and makes its path
+// absolute, since llama-server runs from its own directory.
+func (m *Manager) useExternal() error {
+	path, err := filepath.Abs(m.cfg.BackendBin)
+	if err != nil {
+		return err
+	}
+	version, err := CheckBinary(path)
+	if err != nil {
+		return err
+	}
+	m.cfg.BackendBin = path
+	ui.Info("Using llama-server %s at %s", version, path)
+	return nil
+}
+
+// usePath switches to a working llama-server on $PATH, if there is one.
+func (m *Manager) usePath() bool {
+	path := FindOnPath()
+	if path == "" {
+		return false
+	}
+	version, err := CheckBinary(path)
+	if err != nil {
+		ui.Warn("Ignoring llama-server on PATH: %v", err)
+		return false
+	}
+	m.cfg.BackendBin = path
+	ui.Info("Using llama-server %s from PATH (%s)", version, path)
+	return true
+}
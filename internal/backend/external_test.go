@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+// script writes an executable shell script.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	path := filepath.Join(t.TempDir(), "llama-server")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckBinary(t *testing.T) {
+	bin, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := CheckBinary(bin); err != nil || v != "4567 (3f1ae2e3)" {
+		t.Errorf("CheckBinary = %q, %v; want 4567 (3f1ae2e3)", v, err)
+	}
+
+	for name, tt := range map[string]struct{ path, want string }{
+		"missing":        {filepath.Join(t.TempDir(), "llama-server"), "no such file"},
+		"not llama":      {script(t, "echo hello"), "printed no version"},
+		"fails to start": {script(t, "echo 'error while loading shared libraries' >&2; exit 127"), "shared libraries"},
+	} {
+		if _, err := CheckBinary(tt.path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: CheckBinary = %v, want an error mentioning %q", name, err, tt.want)
+		}
+	}
+}
+
+func TestEnsureBackendExternal(t *testing.T) {
+	cfg := testConfig(t)
+	// A relative path is made absolute, since llama-server runs in its own
+	// directory.
+	wd, _ := os.Getwd()
+	rel, err := filepath.Rel(wd, cfg.BackendBin)
+	if err != nil {
+		t.Skip(err)
+	}
+	abs := cfg.BackendBin
+	cfg.BackendBin = rel
+	if err := New(cfg).EnsureBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BackendBin != abs || cfg.BackendBinaryPath() != abs {
+		t.Errorf("BackendBin = %s, want %s", cfg.BackendBin, abs)
+	}
+
+	cfg.BackendBin = filepath.Join(t.TempDir(), "llama-server")
+	if err := New(cfg).EnsureBackend(); err == nil {
+		t.Errorf("EnsureBackend with a missing binary succeeded")
+	}
+}
+
+func TestEnsureBackendFromPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs symlinks")
+	}
+	cfg := testConfig(t)
+	bin := cfg.BackendBin
+	cfg.BackendBin = ""
+
+	dir := t.TempDir()
+	onPath := filepath.Join(dir, config.BackendBinaryName())
+	if err := os.Symlink(bin, onPath); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	// With no version installed or pinned, the binary on PATH is used.
+	if err := New(cfg).EnsureBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BackendBin != onPath {
+		t.Errorf("BackendBin = %q, want %s from PATH", cfg.BackendBin, onPath)
+	}
+}
@@ -7,146 +7,403 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/llmgw/llmgw/internal/config"
-	"github.com/llmgw/llmgw/internal/downloader"
+	"github.com/llmgw/llmgw/internal/gguf"
 	"github.com/llmgw/llmgw/internal/ui"
 )
 
-// Manager handles the llama.cpp server lifecycle.
+// StopGrace is how long Stop waits for llama-server to exit after asking it
+// to before killing it.
+const StopGrace = 10 * time.Second
+
+// bindGrace is how long llama-server must have been running before an
+// answer on its port is taken to come from it: one that fails to bind a
+// port another server holds exits well within it.
+const bindGrace = time.Second
+
+// unconfirmedGrace is how long a llama-server that does not report its model
+// file must stay up after answering before WaitReady accepts it.
+const unconfirmedGrace = 2 * time.Second
+
+// probeClient checks on a starting llama-server. The timeout keeps a port
+// that accepts connections but never answers from hanging startup.
+var probeClient = &http.Client{Timeout: 2 * time.Second}
+
+// Manager handles the llama.cpp server lifecycle. Once a backend is ready,
+// a crash is noticed and the process restarted; see supervise.
 type Manager struct {
 	cfg *config.Config
-	cmd *exec.Cmd
+
+	mu        sync.Mutex
+	proc      *process
+	modelPath string
+	state     State
+	lastExit  *Exit
+	crashes   int           // consecutive crashes
+	quit      chan struct{} // closed by Stop to cancel pending restarts
+	log       *Log
+	startedAt time.Time
+	restarts  int // processes started by the supervisor after crashes
+
+	// onProcess, if set, is told when a llama-server process starts
+	// (running) and when it exits. It is called with mu held.
+	onProcess func(pid int, running bool)
 }
 
-// New creates a backend manager.
+// process is one run of llama-server.
+type process struct {
+	cmd     *exec.Cmd
+	port    int
+	exited  chan struct{} // closed once the process has been reaped
+	started time.Time
+}
+
+// New creates a backend manager whose output is only kept in memory.
 func New(cfg *config.Config) *Manager {
-	return &Manager{cfg: cfg}
+	return newManager(cfg, "")
+}
+
+// newManager creates a backend manager that also appends its output to the
+// file at logPath.
+func newManager(cfg *config.Config, logPath string) *Manager {
+	return &Manager{cfg: cfg, state: StateStopped, log: newLog(logPath)}
+}
+
+// Log returns the backend's output log.
+func (m *Manager) Log() *Log {
+	return m.log
 }
 
-// EnsureBackend downloads the llama.cpp server binary if it doesn't exist.
+// EnsureBackend makes sure there is a llama-server to run. An external
+// binary is validated and used as is. Otherwise the active llama.cpp version
+// is downloaded if it isn't installed; with no active version, a llama-server
+// on $PATH is used if there is one, or else the latest release is installed
+// and made active.
 func (m *Manager) EnsureBackend() error {
+	if m.cfg.BackendBin != "" {
+		return m.useExternal()
+	}
+
 	binPath := m.cfg.BackendBinaryPath()
 	if _, err := os.Stat(binPath); err == nil {
 		return nil
 	}
+	if m.cfg.BackendVersion == "" && m.usePath() {
+		return nil
+	}
 
 	ui.Info("Downloading llama.cpp inference server...")
 
-	dlURL, assetName, err := m.findRelease()
+	tag, err := m.Install(m.cfg.BackendVersion)
 	if err != nil {
-		return fmt.Errorf("finding llama.cpp release: %w", err)
-	}
-
-	zipPath := filepath.Join(m.cfg.BinDir, assetName)
-	if err := downloader.DownloadFile(dlURL, zipPath, "llama.cpp"); err != nil {
-		return fmt.Errorf("downloading llama.cpp: %w", err)
-	}
-
-	if err := m.extractBinaries(zipPath, binPath); err != nil {
-		return fmt.Errorf("extracting llama.cpp: %w", err)
+		return err
 	}
-
-	os.Remove(zipPath)
-
-	if runtime.GOOS != "windows" {
-		os.Chmod(binPath, 0755)
+	if m.cfg.BackendVersion == "" {
+		if err := m.cfg.SetBackendVersion(tag); err != nil {
+			return fmt.Errorf("recording llama.cpp version: %w", err)
+		}
 	}
 
-	ui.Success("llama.cpp server installed")
+	ui.Success("llama.cpp server %s installed", tag)
 	return nil
 }
 
-// Start launches llama-server with the given model.
+// Start launches llama-server with the given model. For a split model any
+// part may be given; llama-server is pointed at the first one, from which it
+// loads the rest.
 func (m *Manager) Start(modelPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.modelPath = gguf.FirstShard(modelPath)
+	m.state = StateStarting
+	m.crashes = 0
+	m.quit = make(chan struct{})
+	return m.spawn()
+}
+
+// spawn starts a llama-server process for m.modelPath and a goroutine that
+// waits for it to exit. Must be called with m.mu held.
+func (m *Manager) spawn() error {
+	port := m.cfg.BackendPort
+	if port == 0 {
+		var err error
+		if port, err = freePort(); err != nil {
+			return fmt.Errorf("finding a port for llama-server: %w", err)
+		}
+	}
+
 	binPath := m.cfg.BackendBinaryPath()
 	args := []string{
-		"-m", modelPath,
-		"--port", fmt.Sprintf("%d", m.cfg.BackendPort),
+		"-m", m.modelPath,
+		"--port", fmt.Sprintf("%d", port),
 		"-c", fmt.Sprintf("%d", m.cfg.CtxSize),
 		"--host", "127.0.0.1",
 	}
+	args = append(args, m.cfg.BackendArgs...)
 
-	m.cmd = exec.Command(binPath, args...)
-	m.cmd.Dir = m.cfg.BinDir
+	p := &process{
+		cmd:    exec.Command(binPath, args...),
+		port:   port,
+		exited: make(chan struct{}),
+	}
+	p.cmd.Dir = filepath.Dir(binPath)
+	p.cmd.SysProcAttr = processAttr()
 
+	// Output always goes to the log, and to the terminal with -verbose.
 	if m.cfg.Verbose {
-		m.cmd.Stdout = os.Stdout
-		m.cmd.Stderr = os.Stderr
+		p.cmd.Stdout = io.MultiWriter(os.Stdout, m.log)
+		p.cmd.Stderr = io.MultiWriter(os.Stderr, m.log)
 	} else {
-		m.cmd.Stdout = io.Discard
-		m.cmd.Stderr = io.Discard
+		p.cmd.Stdout = m.log
+		p.cmd.Stderr = m.log
 	}
 
-	if err := m.cmd.Start(); err != nil {
+	p.started = time.Now()
+	fmt.Fprintf(m.log, "==> %s starting %s %s\n", p.started.Format(time.RFC3339), binPath, strings.Join(args, " "))
+	if err := p.cmd.Start(); err != nil {
 		return fmt.Errorf("starting llama-server: %w", err)
 	}
+
+	m.proc = p
+	m.startedAt = p.started
+	if m.onProcess != nil {
+		m.onProcess(p.cmd.Process.Pid, true)
+	}
+	go m.wait(p)
 	return nil
 }
 
-// WaitReady polls the backend health endpoint until it responds OK.
+// WaitReady polls the backend health endpoint until it responds OK, then
+// makes sure that the server answering is the one that was started: it must
+// report the model file it was given, and the process started must still
+// be running bindGrace after it started. A server that does not report its
+// model file is accepted once the process has stayed up for
+// unconfirmedGrace after it answered.
 func (m *Manager) WaitReady(timeout time.Duration) error {
-	healthURL := fmt.Sprintf("http://127.0.0.1:%d/health", m.cfg.BackendPort)
 	deadline := time.Now().Add(timeout)
 
+	m.mu.Lock()
+	p := m.proc
+	modelPath := m.modelPath
+	m.mu.Unlock()
+	if p == nil {
+		return fmt.Errorf("llama-server is not running")
+	}
+	healthURL := fmt.Sprintf("http://127.0.0.1:%d/health", p.port)
+	exited := func() error {
+		return fmt.Errorf("llama-server exited during startup (%s)", m.LastExit().describe())
+	}
+
+	var unconfirmed time.Time // when a server not reporting its model first answered
 	for time.Now().Before(deadline) {
-		resp, err := http.Get(healthURL)
+		confirmed := false
+		resp, err := probeClient.Get(healthURL)
 		if err == nil {
 			resp.Body.Close()
 			if resp.StatusCode == http.StatusOK {
-				return nil
+				served, err := servedModel(p.port)
+				switch {
+				case err != nil:
+					// Try again.
+				case served == "":
+					if unconfirmed.IsZero() {
+						unconfirmed = time.Now()
+					}
+					confirmed = time.Since(unconfirmed) >= unconfirmedGrace
+				case !sameFile(served, modelPath):
+					return fmt.Errorf("port %d is held by another server, which is serving %s", p.port, served)
+				default:
+					confirmed = time.Since(p.started) >= bindGrace
+				}
+			}
+		}
+		if confirmed {
+			// The answer may have come from another server on the port
+			// after ours failed to bind it and exited.
+			select {
+			case <-p.exited:
+				return exited()
+			default:
+			}
+			m.mu.Lock()
+			if m.proc == p && (m.state == StateStarting || m.state == StateRestarting) {
+				m.state = StateRunning
 			}
+			m.mu.Unlock()
+			return nil
 		}
-		// Check if process died
-		if m.cmd.ProcessState != nil && m.cmd.ProcessState.Exited() {
-			return fmt.Errorf("llama-server process exited unexpectedly")
+		select {
+		case <-p.exited:
+			return exited()
+		case <-time.After(500 * time.Millisecond):
 		}
-		time.Sleep(500 * time.Millisecond)
 	}
-	return fmt.Errorf("backend not ready after %v", timeout)
+	return fmt.Errorf("backend not ready after %v%s", timeout, formatTail(m.log.Tail(tailLines)))
 }
 
-// Stop kills the backend process.
+// Stop asks the backend process to exit, kills it if it is still running
+// after StopGrace, and cancels any pending restart.
 func (m *Manager) Stop() {
-	if m.cmd != nil && m.cmd.Process != nil {
-		m.cmd.Process.Kill()
-		m.cmd.Wait()
+	m.stop(StopGrace)
+}
+
+// stop stops the backend, giving the process grace to exit before killing
+// it. With no grace it is killed at once.
+func (m *Manager) stop(grace time.Duration) {
+	m.mu.Lock()
+	m.state = StateStopped
+	if m.quit != nil {
+		close(m.quit)
+		m.quit = nil
 	}
+	p := m.proc
+	m.startedAt = time.Time{}
+	m.mu.Unlock()
+
+	if p == nil {
+		return
+	}
+	if grace <= 0 || terminate(p.cmd.Process) != nil {
+		p.cmd.Process.Kill()
+		<-p.exited
+		return
+	}
+	select {
+	case <-p.exited:
+	case <-time.After(grace):
+		fmt.Fprintf(m.log, "==> %s llama-server did not exit within %v; killing it\n", time.Now().Format(time.RFC3339), grace)
+		p.cmd.Process.Kill()
+		<-p.exited
+	}
+}
+
+// Uptime returns how long the current backend process has been running,
+// or zero if it is stopped.
+func (m *Manager) Uptime() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.startedAt.IsZero() {
+		return 0
+	}
+	return time.Since(m.startedAt)
+}
+
+// Restarts returns how many times the supervisor has restarted the backend
+// after a crash. Loads after the model was unloaded do not count.
+func (m *Manager) Restarts() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.restarts
+}
+
+// ContextSize returns the context window the backend runs with, in tokens.
+func (m *Manager) ContextSize() int {
+	return m.cfg.CtxSize
 }
 
-// BackendURL returns the internal backend base URL.
+// BackendURL returns the base URL of the running llama-server. Unless
+// cfg.BackendPort fixes it, the port changes each time the backend starts.
 func (m *Manager) BackendURL() string {
-	return fmt.Sprintf("http://127.0.0.1:%d", m.cfg.BackendPort)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	port := m.cfg.BackendPort
+	if m.proc != nil {
+		port = m.proc.port
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", port)
 }
 
 // ------- internal helpers -------
 
-func (m *Manager) findRelease() (downloadURL, assetName string, err error) {
-	resp, err := http.Get("https://api.github.com/repos/ggml-org/llama.cpp/releases/latest")
+// freePort returns a TCP port on the loopback interface that is free now.
+// Another process may still take it before llama-server binds it, which
+// WaitReady detects.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// servedModel asks the llama-server on port which model file it loaded, so
+// that WaitReady can tell it apart from another server on the same port. It
+// returns "" for servers too old to say.
+func servedModel(port int) (string, error) {
+	resp, err := probeClient.Get(fmt.Sprintf("http://127.0.0.1:%d/props", port))
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 	defer resp.Body.Close()
 
+	var props struct {
+		ModelPath string `json:"model_path"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&props) != nil {
+		return "", nil
+	}
+	return props.ModelPath, nil
+}
+
+// sameFile reports whether paths a and b name the same file.
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
+
+// findRelease looks up a llama.cpp release by tag, or the latest release if
+// tag is "", and picks the archive for this platform.
+func (m *Manager) findRelease(tag string) (name, downloadURL, assetName string, err error) {
+	releaseURL := m.cfg.GitHubAPI + "/repos/" + releaseRepo + "/releases/latest"
+	if tag != "" {
+		releaseURL = m.cfg.GitHubAPI + "/repos/" + releaseRepo + "/releases/tags/" + url.PathEscape(tag)
+	}
+	resp, err := http.Get(releaseURL)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && tag != "" {
+		return "", "", "", fmt.Errorf("no llama.cpp release tagged %q", tag)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("GitHub API returned HTTP %d", resp.StatusCode)
+		return "", "", "", fmt.Errorf("GitHub API returned HTTP %d", resp.StatusCode)
 	}
 
 	var release struct {
+		Tag    string `json:"tag_name"`
 		Assets []struct {
 			Name string `json:"name"`
 			URL  string `json:"browser_download_url"`
 		} `json:"assets"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return "", "", err
+		return "", "", "", err
+	}
+	if err := ValidateTag(release.Tag); err != nil {
+		return "", "", "", err
 	}
 
 	targets := targetAssetHints()
@@ -156,7 +413,7 @@ func (m *Manager) findRelease() (downloadURL, assetName string, err error) {
 		for _, a := range release.Assets {
 			lower := strings.ToLower(a.Name)
 			if strings.Contains(lower, target) && isArchive(lower) {
-				return a.URL, a.Name, nil
+				return release.Tag, a.URL, a.Name, nil
 			}
 		}
 	}
@@ -174,11 +431,11 @@ func (m *Manager) findRelease() (downloadURL, assetName string, err error) {
 			!strings.Contains(lower, "opencl") &&
 			!strings.Contains(lower, "aclgraph") &&
 			!strings.Contains(lower, "cudart") {
-			return a.URL, a.Name, nil
+			return release.Tag, a.URL, a.Name, nil
 		}
 	}
 
-	return "", "", fmt.Errorf("no llama.cpp release found for %s/%s", runtime.GOOS, runtime.GOARCH)
+	return "", "", "", fmt.Errorf("llama.cpp %s has no build for %s/%s", release.Tag, runtime.GOOS, runtime.GOARCH)
 }
 
 // targetAssetHints returns prioritized asset name substrings to match.
@@ -251,7 +508,7 @@ func (m *Manager) extractFromZip(zipPath, serverDest string) error {
 
 		// Also extract DLLs on Windows (needed at runtime)
 		if runtime.GOOS == "windows" && strings.HasSuffix(strings.ToLower(base), ".dll") {
-			dest := filepath.Join(m.cfg.BinDir, base)
+			dest := filepath.Join(filepath.Dir(serverDest), base)
 			extractZipFile(f, dest) // best-effort
 		}
 	}
@@ -300,6 +557,30 @@ func (m *Manager) extractFromTarGz(tarGzPath, serverDest string) error {
 				return err
 			}
 			found = true
+			continue
+		}
+
+		// Newer builds link llama-server against shared libraries, which
+		// are loaded from its directory.
+		if isSharedLib(base) {
+			dest := filepath.Join(filepath.Dir(serverDest), base)
+			switch hdr.Typeflag {
+			case tar.TypeSymlink:
+				os.Remove(dest)
+				if err := os.Symlink(filepath.Base(hdr.Linkname), dest); err != nil {
+					return err
+				}
+			case tar.TypeReg:
+				out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(out, tr)
+				out.Close()
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
 
@@ -309,6 +590,15 @@ func (m *Manager) extractFromTarGz(tarGzPath, serverDest string) error {
 	return nil
 }
 
+// isSharedLib reports whether name is one of llama.cpp's shared libraries,
+// e.g. libllama.so or libggml-cpu.so.0.
+func isSharedLib(name string) bool {
+	if !strings.HasPrefix(name, "libllama") && !strings.HasPrefix(name, "libggml") {
+		return false
+	}
+	return strings.HasSuffix(name, ".so") || strings.Contains(name, ".so.")
+}
+
 func extractZipFile(f *zip.File, dest string) error {
 	rc, err := f.Open()
 	if err != nil {
@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// logLines is how many lines of output each backend keeps in memory.
+	logLines = 1000
+	// maxLogSize rotates a backend's log file once it grows past this size;
+	// one rotated file (<model>.log.1) is kept.
+	maxLogSize = 10 << 20
+)
+
+// Log collects a backend's output across restarts. Recent lines are kept in
+// a ring buffer for diagnostics and streaming, and everything is appended to
+// a log file, if one is configured.
+type Log struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	size    int64
+	ring    [logLines]string
+	head    int // index of the oldest line
+	n       int
+	partial []byte
+	subs    map[chan string]struct{}
+}
+
+// newLog creates a log that also appends to path, or only keeps lines in
+// memory if path is "". The file is opened on the first write.
+func newLog(path string) *Log {
+	return &Log{path: path, subs: make(map[chan string]struct{})}
+}
+
+// Path returns the log file path, or "" if output is only kept in memory.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Write records output, splitting it into lines. It never fails, so that a
+// full disk cannot block the backend process.
+func (l *Log) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.writeFile(p)
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		l.add(strings.TrimRight(string(l.partial[:i]), "\r"))
+		l.partial = l.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Tail returns up to n of the most recent lines, oldest first.
+func (l *Log) Tail(n int) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := l.last(n)
+	if len(l.partial) > 0 {
+		out = append(out, string(l.partial))
+	}
+	return out
+}
+
+// Follow returns the last n complete lines and a channel that receives every
+// line completed after them, including one that was still being written.
+// cancel must be called to stop following. Lines are dropped if the
+// receiver falls too far behind.
+func (l *Log) Follow(n int) (tail []string, lines <-chan string, cancel func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Taking the tail and subscribing under one lock makes sure no line is
+	// missed or repeated in between.
+	tail = l.last(n)
+	ch := make(chan string, 256)
+	l.subs[ch] = struct{}{}
+	return tail, ch, func() {
+		l.mu.Lock()
+		delete(l.subs, ch)
+		l.mu.Unlock()
+	}
+}
+
+// last returns up to n of the most recent complete lines, oldest first.
+// Must be called with l.mu held.
+func (l *Log) last(n int) []string {
+	n = min(n, l.n)
+	out := make([]string, 0, n+1)
+	for i := l.n - n; i < l.n; i++ {
+		out = append(out, l.ring[(l.head+i)%logLines])
+	}
+	return out
+}
+
+// add appends a complete line. Must be called with l.mu held.
+func (l *Log) add(line string) {
+	if l.n < logLines {
+		l.ring[(l.head+l.n)%logLines] = line
+		l.n++
+	} else {
+		l.ring[l.head] = line
+		l.head = (l.head + 1) % logLines
+	}
+	for ch := range l.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// writeFile appends p to the log file, rotating it when it grows too large.
+// Must be called with l.mu held.
+func (l *Log) writeFile(p []byte) {
+	if l.path == "" {
+		return
+	}
+	if l.file != nil && l.size+int64(len(p)) > maxLogSize {
+		l.file.Close()
+		l.file = nil
+		os.Rename(l.path, l.path+".1")
+	}
+	if l.file == nil {
+		os.MkdirAll(filepath.Dir(l.path), 0755)
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			// Keep the in-memory buffer working; retry the file next time.
+			return
+		}
+		info, _ := f.Stat()
+		l.file, l.size = f, 0
+		if info != nil {
+			l.size = info.Size()
+		}
+	}
+	n, _ := l.file.Write(p)
+	l.size += int64(n)
+}
+
+// Close closes the log file. Later writes reopen it.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,123 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogTailWraparound(t *testing.T) {
+	l := newLog("")
+	for i := 0; i < logLines+5; i++ {
+		fmt.Fprintf(l, "line %d\n", i)
+	}
+
+	if got, want := l.Tail(3), []string{"line 1002", "line 1003", "line 1004"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tail(3) = %q, want %q", got, want)
+	}
+	all := l.Tail(2 * logLines)
+	if len(all) != logLines || all[0] != "line 5" || all[logLines-1] != "line 1004" {
+		t.Errorf("Tail(%d) = %d lines from %q to %q, want %d from \"line 5\" to \"line 1004\"",
+			2*logLines, len(all), all[0], all[len(all)-1], logLines)
+	}
+	if got := l.Tail(0); len(got) != 0 {
+		t.Errorf("Tail(0) = %q, want none", got)
+	}
+}
+
+func TestLogPartialLines(t *testing.T) {
+	l := newLog("")
+	l.Write([]byte("loading"))
+	if got, want := l.Tail(5), []string{"loading"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tail with a partial line = %q, want %q", got, want)
+	}
+
+	// A line split across writes, CRLF endings and several lines per write.
+	l.Write([]byte(" model\r\nlistening"))
+	l.Write([]byte(" on 8081\nready\n"))
+	want := []string{"loading model", "listening on 8081", "ready"}
+	if got := l.Tail(5); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tail = %q, want %q", got, want)
+	}
+}
+
+func TestLogFollow(t *testing.T) {
+	l := newLog("")
+	l.Write([]byte("one\ntwo\npart"))
+
+	tail, lines, cancel := l.Follow(5)
+	defer cancel()
+	// The partial line is not in the tail but arrives once completed.
+	if want := []string{"one", "two"}; !reflect.DeepEqual(tail, want) {
+		t.Errorf("Follow tail = %q, want %q", tail, want)
+	}
+	l.Write([]byte("ial\nthree\n"))
+	for _, want := range []string{"partial", "three"} {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Errorf("followed line = %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no line followed, want %q", want)
+		}
+	}
+
+	cancel()
+	l.Write([]byte("four\n"))
+	select {
+	case got := <-lines:
+		t.Errorf("line %q followed after cancel", got)
+	default:
+	}
+}
+
+func TestLogFollowSlowReader(t *testing.T) {
+	l := newLog("")
+	_, lines, cancel := l.Follow(0)
+	defer cancel()
+
+	// A follower that does not read must not block writes.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*logLines; i++ {
+			fmt.Fprintf(l, "line %d\n", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked on a follower that is not reading")
+	}
+	if got := <-lines; got != "line 0" {
+		t.Errorf("first followed line = %q, want \"line 0\"", got)
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "model.log")
+	l := newLog(path)
+	defer l.Close()
+
+	line := strings.Repeat("x", 1<<20-1) + "\n"
+	for i := 0; i < 11; i++ {
+		l.Write([]byte(line))
+	}
+
+	cur, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := os.Stat(path + ".1")
+	if err != nil {
+		t.Fatalf("no rotated log: %v", err)
+	}
+	if old.Size() != 10<<20 || cur.Size() != 1<<20 {
+		t.Errorf("rotated log %d bytes and current %d, want %d and %d", old.Size(), cur.Size(), 10<<20, 1<<20)
+	}
+}
@@ -0,0 +1,547 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/gguf"
+	"github.com/llmgw/llmgw/internal/sysinfo"
+	"github.com/llmgw/llmgw/internal/ui"
+)
+
+// readyTimeout bounds how long a lazily started backend may take to load.
+const readyTimeout = 5 * time.Minute
+
+var (
+	// ErrUnknownModel is returned by Acquire for models not in the pool.
+	ErrUnknownModel = errors.New("model not in pool")
+	// ErrOverBudget is returned when a model cannot be loaded without evicting
+	// one that is still serving requests.
+	ErrOverBudget = errors.New("memory budget exceeded by models in use")
+	// ErrInUse is returned by Replace while the model is serving requests.
+	ErrInUse = errors.New("model is in use")
+	// ErrNoMemory is returned when a model looks too large for the memory
+	// available, unless cfg.Force is set.
+	ErrNoMemory = errors.New("not enough free memory")
+)
+
+// Pool runs one llama-server process per model, each on its own port.
+// Models are loaded on first use, unloaded after cfg.IdleTTL of inactivity,
+// and evicted least-recently-used first to stay within cfg.MemoryBudget.
+type Pool struct {
+	cfg    *config.Config
+	mu     sync.Mutex
+	order  []string
+	models map[string]*poolModel
+	done   chan struct{}
+
+	onProcess func(id string, pid int, running bool)
+}
+
+type poolModel struct {
+	id        string
+	modelPath string
+	sizeBytes int64               // estimated memory footprint
+	est       gguf.MemoryEstimate // its breakdown; zero if the header is unreadable
+	mgr       *Manager
+
+	loaded    bool
+	loading   chan struct{} // non-nil while a load is in progress
+	unloading chan struct{} // non-nil while the backend is being stopped
+	loadErr   error
+	refs      int
+	lastUsed  time.Time
+}
+
+// Lease keeps a model loaded while a request is using it. Release must be
+// called exactly once when the request finishes.
+type Lease struct {
+	pool *Pool
+	pm   *poolModel
+	proc *process // the backend process serving the lease
+	once sync.Once
+}
+
+// NewPool creates an empty pool. Each backend listens on a free port picked
+// when it starts, or, if cfg.BackendPort is set, on ports allocated
+// sequentially from it.
+func NewPool(cfg *config.Config) *Pool {
+	p := &Pool{
+		cfg:    cfg,
+		models: make(map[string]*poolModel),
+		done:   make(chan struct{}),
+	}
+	if cfg.IdleTTL > 0 {
+		go p.reapIdle()
+	}
+	return p
+}
+
+// Add registers a model under id and returns the manager that will serve it.
+// sizeBytes is the size of the model's files; when zero, the size of the
+// file on disk is used. With an automatic context size (cfg.CtxSize 0), the
+// model's own is chosen by ContextSize, fitted to the memory the models
+// already in the pool leave (see memoryLeft). The model's memory footprint
+// is estimated from its size, header and context. Adding an id twice returns
+// the existing manager.
+func (p *Pool) Add(id, modelPath string, sizeBytes int64) *Manager {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pm, ok := p.models[id]; ok {
+		return pm.mgr
+	}
+
+	pm := p.newModel(id, modelPath, sizeBytes, len(p.order))
+	p.models[id] = pm
+	p.order = append(p.order, id)
+	return pm.mgr
+}
+
+// Replace makes modelPath the file served as id, adding id if it is not in
+// the pool yet. A backend running the previous file is stopped first; if it
+// is serving requests, Replace fails with ErrInUse.
+func (p *Pool) Replace(id, modelPath string, sizeBytes int64) (*Manager, error) {
+	p.mu.Lock()
+	old, ok := p.models[id]
+	if !ok || old.modelPath == modelPath {
+		p.mu.Unlock()
+		return p.Add(id, modelPath, sizeBytes), nil
+	}
+	if old.refs > 0 || old.unloading != nil {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("replacing %s: %w", id, ErrInUse)
+	}
+
+	pm := p.newModel(id, modelPath, sizeBytes, slices.Index(p.order, id))
+	// Requests for the new file wait until the old backend has stopped,
+	// since both may use the same port.
+	pm.unloading = make(chan struct{})
+	p.models[id] = pm
+	if old.loaded {
+		ui.Info("Unloading %s to serve %s", id, filepath.Base(modelPath))
+		old.loaded = false
+	}
+	p.mu.Unlock()
+
+	old.mgr.Stop()
+
+	p.mu.Lock()
+	close(pm.unloading)
+	pm.unloading = nil
+	p.mu.Unlock()
+	return pm.mgr, nil
+}
+
+// ModelPath returns the file served as id, or "" if it is not in the pool.
+func (p *Pool) ModelPath(id string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pm, ok := p.models[id]; ok {
+		return pm.modelPath
+	}
+	return ""
+}
+
+// OnProcess registers fn to be told the PID of each llama-server process
+// the pool starts (running) and when it exits. It applies to models added
+// afterwards.
+func (p *Pool) OnProcess(fn func(id string, pid int, running bool)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onProcess = fn
+}
+
+// Acquire returns a lease on the backend serving id, loading the model first
+// if necessary. It blocks while the model loads.
+func (p *Pool) Acquire(id string) (*Lease, error) {
+	p.mu.Lock()
+	pm, ok := p.models[id]
+	if !ok {
+		p.mu.Unlock()
+		return nil, ErrUnknownModel
+	}
+	pm.refs++
+	pm.lastUsed = time.Now()
+
+	if pm.loaded {
+		switch pm.mgr.State() {
+		case StateRestarting:
+			pm.refs--
+			p.mu.Unlock()
+			return nil, pm.mgr.Err()
+		case StateFailed:
+			// The supervisor gave up restarting it; try loading it afresh.
+			pm.loaded = false
+		}
+	}
+
+	for !pm.loaded {
+		if pm.unloading != nil {
+			// The model is being evicted; load it again once it has stopped.
+			ch := pm.unloading
+			p.mu.Unlock()
+			<-ch
+			p.mu.Lock()
+			continue
+		}
+		if pm.loading != nil {
+			// Another request is already loading this model; wait for it.
+			ch := pm.loading
+			p.mu.Unlock()
+			<-ch
+			p.mu.Lock()
+			if pm.loadErr != nil {
+				err := pm.loadErr
+				pm.refs--
+				p.mu.Unlock()
+				return nil, err
+			}
+			continue
+		}
+
+		victims, err := p.makeRoom(pm)
+		if err != nil {
+			pm.refs--
+			p.mu.Unlock()
+			return nil, err
+		}
+
+		pm.loading = make(chan struct{})
+		pm.loadErr = nil
+		p.mu.Unlock()
+
+		p.unload(victims)
+		err = p.checkMemory(pm)
+		if err == nil {
+			ui.Info("Loading %s...", id)
+			err = pm.mgr.Start(pm.modelPath)
+		}
+		if err == nil {
+			if err = pm.mgr.WaitReady(readyTimeout); err != nil {
+				pm.mgr.Stop()
+			}
+		}
+
+		p.mu.Lock()
+		pm.loadErr = err
+		pm.loaded = err == nil
+		close(pm.loading)
+		pm.loading = nil
+		if err != nil {
+			pm.refs--
+			p.mu.Unlock()
+			return nil, fmt.Errorf("loading %s: %w", id, err)
+		}
+		ui.Success("Loaded %s", id)
+	}
+	p.mu.Unlock()
+
+	return &Lease{pool: p, pm: pm, proc: pm.mgr.current()}, nil
+}
+
+// Manager returns the backend manager held by the lease.
+func (l *Lease) Manager() *Manager {
+	return l.pm.mgr
+}
+
+// Crashed reports, as an error wrapping ErrCrashed, whether the backend
+// process serving the lease has exited unexpectedly. A failed backend call
+// may be noticed before the exit is, so Crashed waits up to wait for it.
+func (l *Lease) Crashed(wait time.Duration) error {
+	if l.proc == nil {
+		return nil
+	}
+	select {
+	case <-l.proc.exited:
+	case <-time.After(wait):
+		return nil
+	}
+	if l.pm.mgr.State() == StateStopped {
+		return nil
+	}
+	return fmt.Errorf("%w (%s)", ErrCrashed, l.pm.mgr.LastExit().Status)
+}
+
+// Release returns the lease, allowing the model to be evicted or unloaded.
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		l.pool.mu.Lock()
+		l.pm.refs--
+		l.pm.lastUsed = time.Now()
+		l.pool.mu.Unlock()
+	})
+}
+
+// StartAll eagerly loads every registered model, subject to the memory budget.
+func (p *Pool) StartAll() error {
+	for _, id := range p.Models() {
+		lease, err := p.Acquire(id)
+		if err != nil {
+			return err
+		}
+		lease.Release()
+	}
+	return nil
+}
+
+// Get returns the manager serving id, or nil if the model is not in the pool.
+func (p *Pool) Get(id string) *Manager {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pm, ok := p.models[id]; ok {
+		return pm.mgr
+	}
+	return nil
+}
+
+// Loaded reports whether the model id currently has a running backend.
+func (p *Pool) Loaded(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pm, ok := p.models[id]
+	return ok && pm.loaded
+}
+
+// Models returns the IDs of all registered models in registration order.
+func (p *Pool) Models() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]string, len(p.order))
+	copy(out, p.order)
+	return out
+}
+
+// StopAll stops every backend process in the pool, in parallel, and the
+// idle reaper.
+func (p *Pool) StopAll() {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	mgrs := make([]*Manager, 0, len(p.order))
+	for _, id := range p.order {
+		pm := p.models[id]
+		mgrs = append(mgrs, pm.mgr)
+		pm.loaded = false
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, mgr := range mgrs {
+		wg.Add(1)
+		go func(mgr *Manager) {
+			defer wg.Done()
+			mgr.Stop()
+		}(mgr)
+	}
+	wg.Wait()
+}
+
+// Kill kills every backend process at once, without giving them a chance
+// to exit cleanly. It is meant for a forced exit, and may be called while
+// StopAll is in progress.
+func (p *Pool) Kill() {
+	p.mu.Lock()
+	mgrs := make([]*Manager, 0, len(p.order))
+	for _, id := range p.order {
+		mgrs = append(mgrs, p.models[id].mgr)
+	}
+	p.mu.Unlock()
+
+	for _, mgr := range mgrs {
+		mgr.stop(0)
+	}
+}
+
+// ------- internal helpers -------
+
+// newModel creates the pool entry for id. index is its position in the
+// pool, which picks its port when cfg.BackendPort is set. Must be called
+// with p.mu held.
+func (p *Pool) newModel(id, modelPath string, sizeBytes int64, index int) *poolModel {
+	if sizeBytes <= 0 {
+		if info, err := os.Stat(modelPath); err == nil {
+			sizeBytes = info.Size()
+		}
+	}
+
+	c := p.cfg.ForModel(id)
+	if p.cfg.BackendPort != 0 {
+		c.BackendPort = p.cfg.BackendPort + index
+	}
+	c.CtxSize = ContextSize(c, modelPath, sizeBytes, p.memoryLeft())
+	pm := &poolModel{id: id, modelPath: modelPath, sizeBytes: sizeBytes, mgr: newManager(c, c.BackendLogPath(id))}
+	if f, err := gguf.ReadModel(modelPath); err == nil {
+		pm.est = f.EstimateMemory(sizeBytes, c.CtxSize)
+		pm.sizeBytes = pm.est.Total()
+	}
+	if fn := p.onProcess; fn != nil {
+		pm.mgr.onProcess = func(pid int, running bool) { fn(id, pid, running) }
+	}
+	return pm
+}
+
+// makeRoom picks idle models to evict, least recently used first, until pm
+// fits in the memory budget, and marks them as unloading. The caller must
+// stop them with unload after releasing the lock. Must be called with p.mu
+// held.
+func (p *Pool) makeRoom(pm *poolModel) ([]*poolModel, error) {
+	budget := p.cfg.MemoryBudget
+	if budget <= 0 {
+		return nil, nil
+	}
+	if pm.sizeBytes > budget {
+		return nil, fmt.Errorf("%s needs %s but the memory budget is %s: %w",
+			pm.id, ui.FormatBytes(pm.sizeBytes), ui.FormatBytes(budget), ErrOverBudget)
+	}
+
+	var victims []*poolModel
+
+	for p.usedBytes()+pm.sizeBytes > budget {
+		var victim *poolModel
+		for _, other := range p.models {
+			if other == pm || !other.loaded || other.refs > 0 {
+				continue
+			}
+			if victim == nil || other.lastUsed.Before(victim.lastUsed) {
+				victim = other
+			}
+		}
+		if victim == nil {
+			// Leave the models picked so far loaded.
+			for _, v := range victims {
+				v.loaded = true
+			}
+			return nil, fmt.Errorf("cannot load %s: %w", pm.id, ErrOverBudget)
+		}
+		victim.loaded = false
+		victims = append(victims, victim)
+	}
+	for _, victim := range victims {
+		ui.Info("Unloading %s to free memory", victim.id)
+		victim.unloading = make(chan struct{})
+	}
+	return victims, nil
+}
+
+// unload stops the backends of models marked as unloading, in parallel, and
+// wakes up requests waiting to load them again. Must be called without p.mu
+// held, since stopping a backend can take up to StopGrace.
+func (p *Pool) unload(victims []*poolModel) {
+	var wg sync.WaitGroup
+	for _, pm := range victims {
+		wg.Add(1)
+		go func(pm *poolModel) {
+			defer wg.Done()
+			pm.mgr.Stop()
+		}(pm)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	for _, pm := range victims {
+		close(pm.unloading)
+		pm.unloading = nil
+	}
+	p.mu.Unlock()
+}
+
+// memoryLeft returns the memory a model added now can count on, or 0 if
+// unknown. With a memory budget, other models are evicted to make room, so
+// it is the budget (or the memory available, if less). Without one, every
+// model may be loaded at once, so the models in the pool that are not
+// loaded yet are set against the memory available; the loaded ones already
+// use theirs. Must be called with p.mu held.
+func (p *Pool) memoryLeft() int64 {
+	mem, err := sysinfo.ReadMemory()
+	if err != nil {
+		return p.cfg.MemoryBudget
+	}
+	if budget := p.cfg.MemoryBudget; budget > 0 {
+		return min(budget, mem.Available)
+	}
+	left := mem.Available
+	for _, pm := range p.models {
+		if !pm.loaded && pm.loading == nil && pm.unloading == nil {
+			left -= pm.sizeBytes
+		}
+	}
+	// Nothing left: the smallest automatic context, then.
+	return max(left, 1)
+}
+
+// checkMemory makes sure pm's estimated footprint fits in the memory
+// available right before it is loaded. With cfg.Force it only warns.
+func (p *Pool) checkMemory(pm *poolModel) error {
+	mem, err := sysinfo.ReadMemory()
+	if err != nil || pm.est.Total() == 0 {
+		return nil
+	}
+	need := pm.est.Total()
+	ui.Detail("Estimated memory: %s (weights %s + KV cache %s), %s available",
+		ui.FormatBytes(need), ui.FormatBytes(pm.est.Weights), ui.FormatBytes(pm.est.KVCache),
+		ui.FormatBytes(mem.Available))
+
+	switch {
+	case need > mem.Available && !p.cfg.Force:
+		return fmt.Errorf("%w: needs about %s but only %s is available",
+			ErrNoMemory, ui.FormatBytes(need), ui.FormatBytes(mem.Available))
+	case need > mem.Available:
+		ui.Warn("%s may not fit in memory; loading it anyway (-force)", pm.id)
+	case need > mem.Available*9/10:
+		ui.Warn("%s leaves little free memory; the system may start swapping", pm.id)
+	}
+	return nil
+}
+
+// usedBytes sums the estimated footprint of loaded and loading models.
+// Must be called with p.mu held.
+func (p *Pool) usedBytes() int64 {
+	var total int64
+	for _, pm := range p.models {
+		if pm.loaded || pm.loading != nil {
+			total += pm.sizeBytes
+		}
+	}
+	return total
+}
+
+// reapIdle periodically unloads models that have not been used for cfg.IdleTTL.
+func (p *Pool) reapIdle() {
+	interval := min(max(p.cfg.IdleTTL/2, time.Second), 30*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			var idle []*poolModel
+			p.mu.Lock()
+			for _, pm := range p.models {
+				if pm.loaded && pm.refs == 0 && now.Sub(pm.lastUsed) > p.cfg.IdleTTL {
+					ui.Info("Unloading %s after %v idle", pm.id, p.cfg.IdleTTL)
+					pm.loaded = false
+					pm.unloading = make(chan struct{})
+					idle = append(idle, pm)
+				}
+			}
+			p.mu.Unlock()
+			p.unload(idle)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+// fakeServerEnv makes the test binary act as llama-server, so that tests
+// can run real backend processes.
+const fakeServerEnv = "LLMGW_TEST_LLAMA_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		fakeLlamaServer(os.Args[1:])
+		return
+	}
+	os.Setenv(fakeServerEnv, "1")
+	os.Exit(m.Run())
+}
+
+// fakeLlamaServer answers /health and /props like llama-server until it is
+// killed, or prints its version for --version.
+func fakeLlamaServer(args []string) {
+	if len(args) == 1 && args[0] == "--version" {
+		fmt.Println("version: 4567 (3f1ae2e3)")
+		fmt.Println("built with cc for x86_64-linux-gnu")
+		return
+	}
+
+	fs := flag.NewFlagSet("llama-server", flag.ContinueOnError)
+	model := fs.String("m", "", "")
+	port := fs.Int("port", 0, "")
+	host := fs.String("host", "127.0.0.1", "")
+	fs.Int("c", 0, "")
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"ok"}`)
+	})
+	http.HandleFunc("/props", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"model_path": *model})
+	})
+	fmt.Printf("listening on %s:%d\n", *host, *port)
+	err := http.ListenAndServe(fmt.Sprintf("%s:%d", *host, *port), nil)
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+// testConfig returns a config that runs the fake llama-server.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	t.Setenv("LLMGW_HOME", t.TempDir())
+	bin, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New()
+	cfg.BackendBin = bin
+	cfg.CtxSize = 512
+	return cfg
+}
+
+// testPool returns a pool with a model of sizeBytes for each id.
+func testPool(t *testing.T, cfg *config.Config, sizeBytes int64, ids ...string) *Pool {
+	t.Helper()
+	p := NewPool(cfg)
+	t.Cleanup(p.StopAll)
+	dir := t.TempDir()
+	for _, id := range ids {
+		p.Add(id, filepath.Join(dir, id+".gguf"), sizeBytes)
+	}
+	return p
+}
+
+func use(t *testing.T, p *Pool, id string) {
+	t.Helper()
+	lease, err := p.Acquire(id)
+	if err != nil {
+		t.Fatalf("Acquire(%s): %v", id, err)
+	}
+	lease.Release()
+}
+
+func checkLoaded(t *testing.T, p *Pool, want map[string]bool) {
+	t.Helper()
+	for id, loaded := range want {
+		if got := p.Loaded(id); got != loaded {
+			t.Errorf("Loaded(%s) = %v, want %v", id, got, loaded)
+		}
+	}
+}
+
+func TestPoolEvictsLeastRecentlyUsed(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MemoryBudget = 100
+	p := testPool(t, cfg, 40, "a", "b", "c")
+
+	use(t, p, "a")
+	use(t, p, "b")
+	use(t, p, "a")
+	// Two models fit; b was used least recently.
+	use(t, p, "c")
+	checkLoaded(t, p, map[string]bool{"a": true, "b": false, "c": true})
+
+	// With both loaded models in use there is nothing to evict for b.
+	la, err := p.Acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer la.Release()
+	lc, err := p.Acquire("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lc.Release()
+	if _, err := p.Acquire("b"); !errors.Is(err, ErrOverBudget) {
+		t.Errorf("Acquire(b) with a and c in use = %v, want ErrOverBudget", err)
+	}
+	checkLoaded(t, p, map[string]bool{"a": true, "b": false, "c": true})
+}
+
+func TestPoolModelOverBudget(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MemoryBudget = 100
+	p := testPool(t, cfg, 150, "big")
+
+	if _, err := p.Acquire("big"); !errors.Is(err, ErrOverBudget) {
+		t.Errorf("Acquire = %v, want ErrOverBudget", err)
+	}
+	if _, err := p.Acquire("missing"); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("Acquire(missing) = %v, want ErrUnknownModel", err)
+	}
+}
+
+func TestPoolUnloadsIdleModels(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.IdleTTL = 100 * time.Millisecond
+	p := testPool(t, cfg, 40, "a")
+
+	lease, err := p.Acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A model in use is never idle.
+	time.Sleep(1500 * time.Millisecond)
+	checkLoaded(t, p, map[string]bool{"a": true})
+
+	lease.Release()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Loaded("a") {
+		if time.Now().After(deadline) {
+			t.Fatal("idle model still loaded")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if state := p.Get("a").State(); state != StateStopped {
+		t.Errorf("State after unloading = %s, want %s", state, StateStopped)
+	}
+}
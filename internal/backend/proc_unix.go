@@ -0,0 +1,19 @@
+//go:build !windows
+
+package backend
+
+import (
+	"os"
+	"syscall"
+)
+
+// processAttr puts llama-server in its own process group, so that Ctrl+C in
+// the terminal reaches only llmgw, which then stops it in an orderly way.
+func processAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate asks the process to exit.
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
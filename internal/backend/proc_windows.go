@@ -0,0 +1,21 @@
+//go:build windows
+
+package backend
+
+import (
+	"os"
+	"syscall"
+)
+
+// createNewProcessGroup keeps Ctrl+C in the console from reaching
+// llama-server, so that llmgw can stop it in an orderly way.
+const createNewProcessGroup = 0x00000200
+
+func processAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: createNewProcessGroup}
+}
+
+// terminate ends the process. Windows has no SIGTERM, so it is killed.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,204 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/ui"
+)
+
+const (
+	// maxRestarts bounds consecutive automatic restarts after crashes.
+	maxRestarts = 5
+	// stableUptime is how long a process must stay up for its crash to
+	// count as a fresh one rather than another consecutive failure.
+	stableUptime = time.Minute
+	// tailLines is how many lines of output are included in error reports.
+	tailLines = 20
+)
+
+// ErrCrashed is returned for requests to a backend that exited unexpectedly.
+var ErrCrashed = errors.New("backend crashed")
+
+// State is the lifecycle state of a backend process.
+type State string
+
+const (
+	StateStopped    State = "stopped"
+	StateStarting   State = "starting"
+	StateRunning    State = "running"
+	StateRestarting State = "restarting" // crashed; a restart is pending or loading
+	StateFailed     State = "failed"     // crashed and ran out of restarts
+)
+
+// Exit describes how a backend process ended.
+type Exit struct {
+	Code   int
+	Status string   // e.g. "exit status 1" or "signal: killed"
+	Tail   []string // last lines of output
+	At     time.Time
+}
+
+// describe formats the exit status followed by the output tail, if any.
+func (e *Exit) describe() string {
+	return e.Status + formatTail(e.Tail)
+}
+
+// formatTail formats output lines for inclusion in an error message.
+func formatTail(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return "; last output:\n    " + strings.Join(lines, "\n    ")
+}
+
+// State returns the backend's lifecycle state.
+func (m *Manager) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// LastExit returns how the most recent backend process ended, or nil.
+func (m *Manager) LastExit() *Exit {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastExit
+}
+
+// Err returns nil unless the backend has crashed and is restarting or has
+// given up, in which case the error wraps ErrCrashed.
+func (m *Manager) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch m.state {
+	case StateRestarting:
+		return fmt.Errorf("%w (%s); restarting", ErrCrashed, m.lastExit.Status)
+	case StateFailed:
+		return fmt.Errorf("%w (%s); restart limit reached", ErrCrashed, m.lastExit.Status)
+	}
+	return nil
+}
+
+// wait reaps the process and, if it was serving rather than being stopped,
+// records the crash and hands over to the supervisor.
+func (m *Manager) wait(p *process) {
+	p.cmd.Wait()
+
+	m.mu.Lock()
+	exit := &Exit{
+		Code:   p.cmd.ProcessState.ExitCode(),
+		Status: p.cmd.ProcessState.String(),
+		Tail:   m.log.Tail(tailLines),
+		At:     time.Now(),
+	}
+	m.lastExit = exit
+	fmt.Fprintf(m.log, "==> %s llama-server exited: %s\n", exit.At.Format(time.RFC3339), exit.Status)
+	if m.onProcess != nil {
+		m.onProcess(p.cmd.Process.Pid, false)
+	}
+	close(p.exited)
+
+	crashed := m.proc == p && m.state == StateRunning
+	if crashed {
+		if exit.At.Sub(p.started) >= stableUptime {
+			m.crashes = 0
+		}
+		m.crashes++
+		m.state = StateRestarting
+		m.startedAt = time.Time{}
+	}
+	quit := m.quit
+	m.mu.Unlock()
+
+	if crashed {
+		m.supervise(quit)
+	}
+}
+
+// supervise restarts a crashed backend with exponential backoff until it is
+// ready again, Stop is called (closing quit), or maxRestarts is exceeded.
+func (m *Manager) supervise(quit chan struct{}) {
+	m.mu.Lock()
+	name := filepath.Base(m.modelPath)
+	ui.Warn("llama-server for %s exited unexpectedly (%s)", name, m.lastExit.describe())
+	m.mu.Unlock()
+
+	for {
+		m.mu.Lock()
+		attempt := m.crashes
+		if attempt > maxRestarts {
+			if m.state == StateRestarting {
+				m.state = StateFailed
+			}
+			m.mu.Unlock()
+			ui.Error("Giving up on llama-server for %s after %d failed restarts", name, maxRestarts)
+			return
+		}
+		m.mu.Unlock()
+
+		delay := time.Second << (attempt - 1)
+		ui.Info("Restarting llama-server for %s in %v (attempt %d/%d)...", name, delay, attempt, maxRestarts)
+		select {
+		case <-quit:
+			return
+		case <-time.After(delay):
+		}
+
+		err := m.restart()
+		if errors.Is(err, errStopped) {
+			return
+		}
+		if err == nil {
+			if err = m.WaitReady(readyTimeout); err == nil {
+				ui.Success("Restarted llama-server for %s", name)
+				return
+			}
+			m.kill()
+		}
+		if m.State() == StateStopped {
+			return
+		}
+		ui.Warn("Restart failed: %v", err)
+
+		m.mu.Lock()
+		m.crashes++
+		m.mu.Unlock()
+	}
+}
+
+// errStopped is returned by restart once Stop has been called.
+var errStopped = errors.New("backend stopped")
+
+// restart launches a new process for a crashed backend, unless it has been
+// stopped in the meantime.
+func (m *Manager) restart() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state != StateRestarting {
+		return errStopped
+	}
+	if err := m.spawn(); err != nil {
+		return err
+	}
+	m.restarts++
+	return nil
+}
+
+// current returns the running process, or nil.
+func (m *Manager) current() *process {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.proc
+}
+
+// kill terminates the current process without changing the backend state.
+func (m *Manager) kill() {
+	if p := m.current(); p != nil {
+		p.cmd.Process.Kill()
+		<-p.exited
+	}
+}
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitState waits for the manager to reach state.
+func waitState(t *testing.T, m *Manager, state State, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for m.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("State = %s after %v, want %s", m.State(), timeout, state)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestRestartAfterCrash(t *testing.T) {
+	m := New(testConfig(t))
+	defer m.Stop()
+	if err := m.Start(filepath.Join(t.TempDir(), "model.gguf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WaitReady(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	first := m.current()
+	first.cmd.Process.Kill()
+	waitState(t, m, StateRestarting, 5*time.Second)
+	if err := m.Err(); !errors.Is(err, ErrCrashed) {
+		t.Errorf("Err while restarting = %v, want ErrCrashed", err)
+	}
+	if exit := m.LastExit(); exit == nil || exit.Status == "" {
+		t.Errorf("LastExit = %+v, want the crash recorded", exit)
+	}
+
+	// The first restart comes after a second, then the backend is ready.
+	waitState(t, m, StateRunning, 10*time.Second)
+	if m.current() == first || m.Restarts() != 1 || m.Err() != nil {
+		t.Errorf("after restart: new process %v, Restarts %d, Err %v; want a new process, 1, nil",
+			m.current() != first, m.Restarts(), m.Err())
+	}
+
+	// A second crash soon after counts as consecutive, doubling the delay,
+	// and Stop cancels the pending restart.
+	m.current().cmd.Process.Kill()
+	waitState(t, m, StateRestarting, 5*time.Second)
+	m.mu.Lock()
+	crashes := m.crashes
+	m.mu.Unlock()
+	if crashes != 2 {
+		t.Errorf("consecutive crashes = %d, want 2", crashes)
+	}
+	m.Stop()
+	time.Sleep(2500 * time.Millisecond)
+	if m.State() != StateStopped || m.Restarts() != 1 {
+		t.Errorf("after Stop: State %s, Restarts %d; want %s, 1", m.State(), m.Restarts(), StateStopped)
+	}
+}
+
+func TestStopIsNotACrash(t *testing.T) {
+	m := New(testConfig(t))
+	if err := m.Start(filepath.Join(t.TempDir(), "model.gguf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WaitReady(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	m.Stop()
+	if m.State() != StateStopped || m.Err() != nil || m.Restarts() != 0 {
+		t.Errorf("after Stop: State %s, Err %v, Restarts %d", m.State(), m.Err(), m.Restarts())
+	}
+}
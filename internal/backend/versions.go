@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/downloader"
+	"github.com/llmgw/llmgw/internal/ui"
+)
+
+// releaseRepo is the GitHub repository llama.cpp releases come from.
+const releaseRepo = "ggml-org/llama.cpp"
+
+// partialSuffix marks a version directory that is still being installed.
+const partialSuffix = ".partial"
+
+// Version is an installed llama.cpp release.
+type Version struct {
+	Tag         string
+	Path        string // llama-server binary
+	InstalledAt time.Time
+}
+
+// ValidateTag checks that tag can name a release directory.
+func ValidateTag(tag string) error {
+	if tag == "" || tag == "." || tag == ".." || strings.ContainsAny(tag, `/\:`) ||
+		strings.HasSuffix(tag, partialSuffix) {
+		return fmt.Errorf("invalid llama.cpp version %q", tag)
+	}
+	return nil
+}
+
+// Install downloads llama.cpp release tag, or the latest release if tag is
+// "", into its own directory under BinDir and returns the tag installed.
+// A version that is already installed is not downloaded again. Install does
+// not change the active version.
+func (m *Manager) Install(tag string) (string, error) {
+	if tag != "" {
+		if err := ValidateTag(tag); err != nil {
+			return "", err
+		}
+	}
+
+	tag, dlURL, assetName, err := m.findRelease(tag)
+	if err != nil {
+		return "", fmt.Errorf("finding llama.cpp release: %w", err)
+	}
+	if m.IsInstalled(tag) {
+		ui.Info("llama.cpp %s is already installed", tag)
+		return tag, nil
+	}
+
+	// Unpack next to the final directory and move it into place once
+	// complete, so an interrupted install never looks usable.
+	dir := m.cfg.BackendDir(tag)
+	tmp := dir + partialSuffix
+	os.RemoveAll(tmp)
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	archivePath := filepath.Join(tmp, assetName)
+	if err := downloader.DownloadFile(dlURL, archivePath, "llama.cpp "+tag); err != nil {
+		return "", fmt.Errorf("downloading llama.cpp: %w", err)
+	}
+
+	binPath := filepath.Join(tmp, config.BackendBinaryName())
+	if err := m.extractBinaries(archivePath, binPath); err != nil {
+		return "", fmt.Errorf("extracting llama.cpp: %w", err)
+	}
+	os.Remove(archivePath)
+
+	if runtime.GOOS != "windows" {
+		os.Chmod(binPath, 0755)
+	}
+
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", fmt.Errorf("installing llama.cpp: %w", err)
+	}
+	return tag, nil
+}
+
+// IsInstalled reports whether llama.cpp release tag is installed.
+func (m *Manager) IsInstalled(tag string) bool {
+	if ValidateTag(tag) != nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(m.cfg.BackendDir(tag), config.BackendBinaryName()))
+	return err == nil
+}
+
+// Installed lists the installed llama.cpp versions, oldest release first.
+func (m *Manager) Installed() ([]Version, error) {
+	entries, err := os.ReadDir(m.cfg.BinDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions []Version
+	for _, e := range entries {
+		if !e.IsDir() || !m.IsInstalled(e.Name()) {
+			continue
+		}
+		path := filepath.Join(m.cfg.BackendDir(e.Name()), config.BackendBinaryName())
+		v := Version{Tag: e.Name(), Path: path}
+		if info, err := os.Stat(path); err == nil {
+			v.InstalledAt = info.ModTime()
+		}
+		versions = append(versions, v)
+	}
+
+	// Release tags are "b" plus a build number, so shorter tags are older.
+	sort.Slice(versions, func(i, j int) bool {
+		a, b := versions[i].Tag, versions[j].Tag
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return versions, nil
+}
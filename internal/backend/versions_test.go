@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+// install pretends release tag is installed under cfg.BinDir; "" puts the
+// binary directly in BinDir, as unversioned installs did.
+func install(t *testing.T, cfg *config.Config, tag string) {
+	t.Helper()
+	path := filepath.Join(cfg.BinDir, tag, config.BackendBinaryName())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateTag(t *testing.T) {
+	for tag, valid := range map[string]bool{
+		"b4567":      true,
+		"b4567-cuda": true,
+		"":           false,
+		".":          false,
+		"..":         false,
+		"../b1":      false,
+		`b1\x`:       false,
+		"c:b1":       false,
+		"b1.partial": false,
+	} {
+		if err := ValidateTag(tag); (err == nil) != valid {
+			t.Errorf("ValidateTag(%q) = %v, want valid %v", tag, err, valid)
+		}
+	}
+}
+
+func TestInstalled(t *testing.T) {
+	t.Setenv("LLMGW_HOME", t.TempDir())
+	cfg := config.New()
+	m := New(cfg)
+	if versions, err := m.Installed(); err != nil || len(versions) != 0 {
+		t.Fatalf("Installed with no bin directory = %v, %v; want none", versions, err)
+	}
+
+	for _, tag := range []string{"b1000", "b99", "b100", "b200" + partialSuffix} {
+		install(t, cfg, tag)
+	}
+	os.MkdirAll(filepath.Join(cfg.BinDir, "b300"), 0755) // no binary
+	install(t, cfg, "")                                  // unversioned install
+
+	versions, err := m.Installed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags []string
+	for _, v := range versions {
+		tags = append(tags, v.Tag)
+		if v.Path != filepath.Join(cfg.BackendDir(v.Tag), config.BackendBinaryName()) || v.InstalledAt.IsZero() {
+			t.Errorf("version %s: path %s, installed %v", v.Tag, v.Path, v.InstalledAt)
+		}
+	}
+	if want := []string{"b99", "b100", "b1000"}; !slices.Equal(tags, want) {
+		t.Errorf("Installed = %v, want %v, oldest release first", tags, want)
+	}
+	if m.IsInstalled("b200"+partialSuffix) || m.IsInstalled("b300") || m.IsInstalled("..") {
+		t.Errorf("partial, empty or invalid versions reported as installed")
+	}
+}
+
+func TestPinnedVersion(t *testing.T) {
+	t.Setenv("LLMGW_HOME", t.TempDir())
+	t.Setenv("LLMGW_PROFILE", "")
+	cfg := config.New()
+	install(t, cfg, "b100")
+	install(t, cfg, "b200")
+
+	if err := cfg.SetBackendVersion("b100"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BackendVersion != "b100" {
+		t.Fatalf("BackendVersion after pinning = %q, want b100", cfg.BackendVersion)
+	}
+	want := filepath.Join(cfg.BinDir, "b100", config.BackendBinaryName())
+	if got := cfg.BackendBinaryPath(); got != want {
+		t.Errorf("BackendBinaryPath = %s, want %s", got, want)
+	}
+	// The pinned version is installed, so nothing is downloaded.
+	if err := New(cfg).EnsureBackend(); err != nil {
+		t.Errorf("EnsureBackend with the pinned version installed: %v", err)
+	}
+}
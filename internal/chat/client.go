@@ -0,0 +1,231 @@
+// Package chat implements llmgw chat: a client for streaming chat
+// completions from an OpenAI-compatible server, and the interactive loop
+// around it.
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Session is a conversation: the model, its settings and the message
+// history. It is what /save writes and /load reads.
+type Session struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	Messages    []Message `json:"messages"`
+}
+
+// Save writes the session to path as JSON.
+func (s *Session) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// LoadSession reads a session written by Save.
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, m := range s.Messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			return nil, fmt.Errorf("%s: unexpected %q message", path, m.Role)
+		}
+	}
+	return &s, nil
+}
+
+// Client sends chat completions to an OpenAI-compatible server: a running
+// gateway, or a llama-server started for the chat.
+type Client struct {
+	// BaseURL is the server address without the /v1 path, e.g.
+	// "http://localhost:8080".
+	BaseURL string
+	// APIKey is sent as a bearer token if set.
+	APIKey string
+}
+
+// Reply is a finished assistant reply and its statistics.
+type Reply struct {
+	Content          string
+	PromptTokens     int
+	CompletionTokens int
+	FirstToken       time.Duration // until the first token arrived
+	Elapsed          time.Duration // for the whole reply
+}
+
+// streamChunk is the part of a streamed chat.completion.chunk that is used.
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// Stream sends the session's conversation and calls onToken with each piece
+// of the reply as it arrives. If ctx is cancelled, the partial reply is
+// returned along with the error.
+func (c *Client) Stream(ctx context.Context, s *Session, onToken func(string)) (*Reply, error) {
+	messages := s.Messages
+	if s.System != "" {
+		messages = append([]Message{{Role: "system", Content: s.System}}, messages...)
+	}
+	body := map[string]interface{}{
+		"model":          s.Model,
+		"messages":       messages,
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+	}
+	if s.Temperature != nil {
+		body["temperature"] = *s.Temperature
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/v1/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	reply := &Reply{}
+	var content strings.Builder
+	chunks := 0
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		payload, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if payload == "[DONE]" {
+			break
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			continue
+		}
+		if chunk.Usage != nil {
+			reply.PromptTokens = chunk.Usage.PromptTokens
+			reply.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if chunks == 0 {
+				reply.FirstToken = time.Since(start)
+			}
+			chunks++
+			content.WriteString(choice.Delta.Content)
+			onToken(choice.Delta.Content)
+		}
+	}
+	reply.Elapsed = time.Since(start)
+	reply.Content = content.String()
+	if reply.CompletionTokens == 0 {
+		// Servers that do not report usage send about one token per chunk.
+		reply.CompletionTokens = chunks
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return reply, err
+	}
+	return reply, ctx.Err()
+}
+
+// Models lists the models served at the client's address.
+func (c *Client) Models() ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/v1/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(list.Data))
+	for i, m := range list.Data {
+		ids[i] = m.ID
+	}
+	return ids, nil
+}
+
+// responseError turns an error response into an error, using the message
+// from an OpenAI-style error body when there is one.
+func responseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error.Message != "" {
+		return fmt.Errorf("%s (HTTP %d)", body.Error.Message, resp.StatusCode)
+	}
+	if msg := strings.TrimSpace(string(data)); msg != "" {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, msg)
+	}
+	return fmt.Errorf("HTTP %d", resp.StatusCode)
+}
@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSessionSaveLoad(t *testing.T) {
+	temp := 0.3
+	s := &Session{
+		Model:       "tinyllama",
+		System:      "Be brief.",
+		Temperature: &temp,
+		Messages:    []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}},
+	}
+	path := filepath.Join(t.TempDir(), "chat.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, s) {
+		t.Errorf("LoadSession = %+v, want %+v", loaded, s)
+	}
+}
+
+func TestLoadSessionInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"not json":       `{"model":`,
+		"system message": `{"model":"m","messages":[{"role":"system","content":"x"}]}`,
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".json")
+		os.WriteFile(path, []byte(data), 0644)
+		if _, err := LoadSession(path); err == nil {
+			t.Errorf("%s: LoadSession succeeded", name)
+		}
+	}
+	if _, err := LoadSession(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("LoadSession of a missing file succeeded")
+	}
+}
+
+// sse writes chunks as a chat completion event stream.
+func sse(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, c := range chunks {
+		fmt.Fprintf(w, "data: %s\n\n", c)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func TestStream(t *testing.T) {
+	var body map[string]interface{}
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+		sse(w,
+			`{"choices":[{"delta":{"role":"assistant"}}]}`,
+			`{"choices":[{"delta":{"content":"Hel"}}]}`,
+			`not json`,
+			`{"choices":[{"delta":{"content":"lo"}}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3}}`,
+		)
+	}))
+	defer srv.Close()
+
+	temp := 0.5
+	s := &Session{Model: "tinyllama", System: "Be brief.", Temperature: &temp,
+		Messages: []Message{{Role: "user", Content: "hi"}}}
+	var tokens []string
+	c := &Client{BaseURL: srv.URL, APIKey: "sk-test"}
+	reply, err := c.Stream(context.Background(), s, func(tok string) { tokens = append(tokens, tok) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply.Content != "Hello" || !reflect.DeepEqual(tokens, []string{"Hel", "lo"}) {
+		t.Errorf("reply %q from tokens %q, want Hello from Hel, lo", reply.Content, tokens)
+	}
+	if reply.PromptTokens != 12 || reply.CompletionTokens != 3 {
+		t.Errorf("usage %d + %d, want 12 + 3", reply.PromptTokens, reply.CompletionTokens)
+	}
+	if auth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	msgs, _ := body["messages"].([]interface{})
+	if len(msgs) != 2 || msgs[0].(map[string]interface{})["role"] != "system" {
+		t.Errorf("messages = %v, want the system prompt first", body["messages"])
+	}
+	if body["stream"] != true || body["temperature"] != 0.5 || body["model"] != "tinyllama" {
+		t.Errorf("request = %v", body)
+	}
+	if len(s.Messages) != 1 {
+		t.Errorf("Stream changed the session's messages: %+v", s.Messages)
+	}
+}
+
+func TestStreamWithoutUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sse(w, `{"choices":[{"delta":{"content":"a"}}]}`, `{"choices":[{"delta":{"content":"b"}}]}`)
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL}
+	reply, err := c.Stream(context.Background(), &Session{Model: "m"}, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One token per chunk is assumed.
+	if reply.CompletionTokens != 2 {
+		t.Errorf("CompletionTokens = %d, want 2", reply.CompletionTokens)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			http.Error(w, "backend down", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"message":"The model m does not exist","code":"model_not_found"}}`)
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL}
+	_, err := c.Stream(context.Background(), &Session{Model: "m"}, func(string) {})
+	if err == nil || err.Error() != "The model m does not exist (HTTP 404)" {
+		t.Errorf("Stream = %v, want the server's message", err)
+	}
+	if _, err := c.Models(); err == nil || err.Error() != "HTTP 502: backend down" {
+		t.Errorf("Models = %v, want the response body", err)
+	}
+}
+
+func TestModels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"a"},{"id":"b"}]}`)
+	}))
+	defer srv.Close()
+
+	ids, err := (&Client{BaseURL: srv.URL}).Models()
+	if err != nil || !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Errorf("Models = %q, %v; want [a b]", ids, err)
+	}
+}
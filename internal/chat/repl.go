@@ -0,0 +1,285 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/llmgw/llmgw/internal/ui"
+)
+
+// multiLineQuote opens and closes a block of multi-line input.
+const multiLineQuote = `"""`
+
+// REPL is the interactive chat loop. Replies stream to stdout; Ctrl+C stops
+// a reply and Ctrl+D or /bye ends the chat.
+type REPL struct {
+	Client  *Client
+	Session *Session
+
+	// SwitchModel makes name the model to chat with and returns the client
+	// for it and the model's canonical name.
+	SwitchModel func(name string) (*Client, string, error)
+
+	lines <-chan string
+	sig   chan os.Signal
+}
+
+// Run reads input from in until it ends or the user quits.
+func (r *REPL) Run(in io.Reader) error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	r.lines = lines
+	r.sig = make(chan os.Signal, 1)
+	signal.Notify(r.sig, os.Interrupt)
+	defer signal.Stop(r.sig)
+
+	ui.Detail("Chatting with %s. Type /help for commands, /bye to quit.", r.Session.Model)
+	fmt.Println()
+	for {
+		input, ok := r.readInput()
+		if !ok {
+			fmt.Println()
+			return nil
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		if strings.HasPrefix(input, "/") {
+			if quit := r.command(input); quit {
+				return nil
+			}
+			continue
+		}
+		r.send(input)
+	}
+}
+
+// readInput reads one message. A line ending in a backslash continues on the
+// next line, and text between """ markers may span several lines. It returns
+// false at the end of the input.
+func (r *REPL) readInput() (string, bool) {
+	var buf strings.Builder
+	quoted := false
+	ui.Prompt(">>>")
+	for {
+		select {
+		case <-r.sig:
+			fmt.Println()
+			if buf.Len() == 0 && !quoted {
+				ui.Detail("Use /bye or Ctrl+D to quit.")
+			}
+			buf.Reset()
+			quoted = false
+			ui.Prompt(">>>")
+			continue
+		case line, ok := <-r.lines:
+			if !ok {
+				return "", false
+			}
+			switch {
+			case quoted:
+				if text, end := strings.CutSuffix(line, multiLineQuote); end {
+					buf.WriteString(text)
+					return buf.String(), true
+				}
+				buf.WriteString(line + "\n")
+			case buf.Len() == 0 && strings.HasPrefix(line, multiLineQuote):
+				text := strings.TrimPrefix(line, multiLineQuote)
+				if text, end := strings.CutSuffix(text, multiLineQuote); end && text != "" {
+					return text, true
+				}
+				quoted = true
+				if text != "" {
+					buf.WriteString(text + "\n")
+				}
+			case strings.HasSuffix(line, `\`):
+				buf.WriteString(strings.TrimSuffix(line, `\`) + "\n")
+			default:
+				buf.WriteString(line)
+				return buf.String(), true
+			}
+			ui.Prompt("...")
+		}
+	}
+}
+
+// send adds a user message to the conversation and streams the reply.
+func (r *REPL) send(text string) {
+	s := r.Session
+	s.Messages = append(s.Messages, Message{Role: "user", Content: text})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.sig:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	reply, err := r.Client.Stream(ctx, s, func(token string) { fmt.Print(token) })
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Println()
+		if reply == nil || reply.Content == "" {
+			s.Messages = s.Messages[:len(s.Messages)-1]
+			ui.Warn("Interrupted")
+			return
+		}
+		// Keep what was generated so the conversation can carry on from it.
+		s.Messages = append(s.Messages, Message{Role: "assistant", Content: reply.Content})
+		ui.Warn("Interrupted")
+	case err != nil:
+		if reply != nil && reply.Content != "" {
+			fmt.Println()
+		}
+		s.Messages = s.Messages[:len(s.Messages)-1]
+		ui.Error("%v", err)
+	default:
+		s.Messages = append(s.Messages, Message{Role: "assistant", Content: reply.Content})
+		fmt.Println()
+		ui.ChatStats(reply.PromptTokens, reply.CompletionTokens, reply.FirstToken, reply.Elapsed)
+	}
+	fmt.Println()
+}
+
+// command runs a slash command and reports whether the chat should end.
+func (r *REPL) command(input string) bool {
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+	s := r.Session
+
+	switch name {
+	case "/bye", "/exit", "/quit":
+		return true
+
+	case "/help", "/?":
+		printHelp()
+
+	case "/system":
+		switch arg {
+		case "":
+			if s.System == "" {
+				ui.Detail("No system prompt")
+			} else {
+				ui.Detail("System prompt: %s", s.System)
+			}
+		case "default":
+			s.System = ""
+			ui.Success("Cleared the system prompt")
+		default:
+			s.System = arg
+			ui.Success("Set the system prompt")
+		}
+
+	case "/temperature":
+		switch arg {
+		case "":
+			if s.Temperature == nil {
+				ui.Detail("Temperature: model default")
+			} else {
+				ui.Detail("Temperature: %g", *s.Temperature)
+			}
+		case "default":
+			s.Temperature = nil
+			ui.Success("Using the model's default temperature")
+		default:
+			t, err := strconv.ParseFloat(arg, 64)
+			if err != nil || t < 0 || t > 2 {
+				ui.Error("Temperature must be a number between 0 and 2")
+				break
+			}
+			s.Temperature = &t
+			ui.Success("Set temperature to %g", t)
+		}
+
+	case "/reset":
+		s.Messages = nil
+		ui.Success("Cleared the conversation")
+
+	case "/save":
+		if arg == "" {
+			ui.Error("Usage: /save <file>")
+			break
+		}
+		if err := s.Save(arg); err != nil {
+			ui.Error("Save failed: %v", err)
+			break
+		}
+		ui.Success("Saved %d messages to %s", len(s.Messages), arg)
+
+	case "/load":
+		if arg == "" {
+			ui.Error("Usage: /load <file>")
+			break
+		}
+		loaded, err := LoadSession(arg)
+		if err != nil {
+			ui.Error("Load failed: %v", err)
+			break
+		}
+		if loaded.Model != "" && loaded.Model != s.Model {
+			if !r.switchModel(loaded.Model) {
+				break
+			}
+		}
+		loaded.Model = r.Session.Model
+		r.Session = loaded
+		ui.Success("Loaded %d messages from %s", len(loaded.Messages), arg)
+
+	case "/model":
+		if arg == "" {
+			ui.Detail("Model: %s", s.Model)
+			break
+		}
+		r.switchModel(arg)
+
+	default:
+		ui.Error("Unknown command %s (try /help)", name)
+	}
+	return false
+}
+
+// switchModel changes the model, keeping the conversation.
+func (r *REPL) switchModel(name string) bool {
+	client, model, err := r.SwitchModel(name)
+	if err != nil {
+		ui.Error("Cannot switch to %s: %v", name, err)
+		return false
+	}
+	r.Client = client
+	r.Session.Model = model
+	ui.Success("Switched to %s", model)
+	return true
+}
+
+func printHelp() {
+	fmt.Println(`  /system [text|default]      Show or set the system prompt
+  /temperature [n|default]    Show or set the sampling temperature
+  /model [name]               Show or switch the model
+  /reset                      Clear the conversation
+  /save <file>                Save the conversation as JSON
+  /load <file>                Load a saved conversation
+  /bye                        Quit (also /exit, /quit or Ctrl+D)
+
+  End a line with \ to continue on the next one, or wrap several
+  lines in """. Ctrl+C stops a reply.`)
+}
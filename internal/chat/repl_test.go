@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"one line", []string{"hello"}, "hello"},
+		{"continued", []string{`first \`, "second"}, "first \nsecond"},
+		{"quoted block", []string{`"""`, "one", "two", `"""`}, "one\ntwo\n"},
+		{"quoted with text", []string{`"""one`, `two"""`}, "one\ntwo"},
+		{"quoted on one line", []string{`"""inline"""`}, "inline"},
+	}
+	for _, tt := range tests {
+		lines := make(chan string, len(tt.lines))
+		for _, l := range tt.lines {
+			lines <- l
+		}
+		r := &REPL{lines: lines}
+		if got, ok := r.readInput(); !ok || got != tt.want {
+			t.Errorf("%s: readInput = %q, %v; want %q", tt.name, got, ok, tt.want)
+		}
+	}
+
+	lines := make(chan string)
+	close(lines)
+	if _, ok := (&REPL{lines: lines}).readInput(); ok {
+		t.Errorf("readInput at the end of the input = true, want false")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	r := &REPL{Session: &Session{Model: "a", Messages: []Message{{Role: "user", Content: "hi"}}}}
+	r.SwitchModel = func(name string) (*Client, string, error) {
+		return &Client{BaseURL: "http://" + name}, "org/" + name, nil
+	}
+
+	for _, cmd := range []string{"/system Be brief.", "/temperature 0.7", "/temperature 3", "/model b"} {
+		if r.command(cmd) {
+			t.Fatalf("%s ended the chat", cmd)
+		}
+	}
+	s := r.Session
+	if s.System != "Be brief." || s.Temperature == nil || *s.Temperature != 0.7 || s.Model != "org/b" {
+		t.Errorf("session = %+v, want the system prompt, temperature 0.7 and model org/b", s)
+	}
+	if r.Client.BaseURL != "http://b" {
+		t.Errorf("client for %s, want b's", r.Client.BaseURL)
+	}
+
+	path := filepath.Join(t.TempDir(), "chat.json")
+	r.command("/save " + path)
+	r.command("/reset")
+	if len(r.Session.Messages) != 0 {
+		t.Errorf("/reset left %d messages", len(r.Session.Messages))
+	}
+	r.command("/load " + path)
+	if len(r.Session.Messages) != 1 || r.Session.System != "Be brief." || r.Session.Model != "org/b" {
+		t.Errorf("after /load: %+v", r.Session)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+
+	r.command("/system default")
+	r.command("/temperature default")
+	if r.Session.System != "" || r.Session.Temperature != nil {
+		t.Errorf("defaults not restored: %+v", r.Session)
+	}
+	if !r.command("/bye") {
+		t.Errorf("/bye did not end the chat")
+	}
+}
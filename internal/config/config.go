@@ -1,9 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -11,7 +15,9 @@ const (
 	Version     = "1.0.0"
 	DefaultPort = 8080
 	DefaultCtx  = 4096
-	BackendPort = 39741
+
+	// DefaultGitHubAPI is where llama.cpp releases are looked up.
+	DefaultGitHubAPI = "https://api.github.com"
 )
 
 // Config holds all application configuration.
@@ -19,34 +25,115 @@ type Config struct {
 	HomeDir     string
 	ModelsDir   string
 	BinDir      string
+	LogsDir     string
+	RunDir      string // state files of running gateways
 	Port        int
-	CtxSize     int
-	BackendPort int
+	CtxSize     int // 0 picks each model's trained context length
+	BackendPort int // 0 runs each llama-server on a free ephemeral port
 	Verbose     bool
 	Quant       string
+	HFToken     string
+
+	// BackendVersion is the active llama.cpp release tag, e.g. "b4567".
+	// It is "" for an install that predates versioned backends.
+	BackendVersion string
+	// BackendBin is an external llama-server binary to use instead of a
+	// downloaded release, e.g. a local build.
+	BackendBin string
+	// GitHubAPI is the base URL of the GitHub API used to find releases.
+	GitHubAPI string
+
+	// DownloadConnections is the number of parallel connections per file download.
+	DownloadConnections int
+
+	// CORSOrigins lists origins allowed to call the API from a browser; "*"
+	// allows any. None are allowed by default.
+	CORSOrigins []string
+
+	// NoAuth serves without API keys even if some have been created.
+	NoAuth bool
+
+	// AllowPull lets clients download models with the Ollama /api/pull
+	// endpoint.
+	AllowPull bool
+
+	// RateLimitRPM and RateLimitTPD are the default per-client requests per
+	// minute and tokens per day (0 = unlimited).
+	RateLimitRPM int
+	RateLimitTPD int
+
+	// AuditLog is the JSONL audit log path ("" disables auditing).
+	AuditLog     string
+	AuditBodies  bool
+	AuditRedact  []string
+	AuditMaxSize int64
+	AuditMaxAge  time.Duration
+	// AuditMaxBackups is how many rotated audit logs are kept.
+	AuditMaxBackups int
+
+	// MemoryBudget caps the summed size of loaded models in bytes (0 = no cap).
+	MemoryBudget int64
+	// IdleTTL unloads models unused for this long (0 = never).
+	IdleTTL time.Duration
+	// Force loads models even when they look too large for the memory
+	// available.
+	Force bool
+
+	// DrainTimeout is how long shutdown waits for requests in flight.
+	DrainTimeout time.Duration
+
+	// Profile is the config file profile in effect, if any.
+	Profile string
+	// Models holds per-model overrides from the config file, keyed by repo
+	// ID; see ForModel.
+	Models map[string]ModelConfig
+	// BackendArgs are extra llama-server arguments for one model.
+	BackendArgs []string
+
+	// sources records where each setting that is not a built-in default
+	// came from, e.g. "file" or "env LLMGW_PORT".
+	sources map[string]string
 }
 
-// New creates a Config with sensible defaults.
+// New creates a Config with built-in defaults. The home directory is
+// ~/.llmgw unless LLMGW_HOME is set. Use Load to also apply the config file
+// and environment.
 func New() *Config {
-	home, _ := os.UserHomeDir()
-	if home == "" {
-		home = "."
+	appDir := os.Getenv("LLMGW_HOME")
+	if appDir == "" {
+		home, _ := os.UserHomeDir()
+		if home == "" {
+			home = "."
+		}
+		appDir = filepath.Join(home, "."+AppName)
 	}
-	appDir := filepath.Join(home, "."+AppName)
 
 	return &Config{
-		HomeDir:     appDir,
-		ModelsDir:   filepath.Join(appDir, "models"),
-		BinDir:      filepath.Join(appDir, "bin"),
-		Port:        DefaultPort,
-		CtxSize:     DefaultCtx,
-		BackendPort: BackendPort,
+		HomeDir:   appDir,
+		ModelsDir: filepath.Join(appDir, "models"),
+		BinDir:    filepath.Join(appDir, "bin"),
+		LogsDir:   filepath.Join(appDir, "logs"),
+		RunDir:    filepath.Join(appDir, "run"),
+		Port:      DefaultPort,
+		HFToken:   os.Getenv("HF_TOKEN"),
+		GitHubAPI: DefaultGitHubAPI,
+
+		DownloadConnections: 4,
+
+		AuditLog:        filepath.Join(appDir, "logs", "audit.jsonl"),
+		AuditMaxSize:    100 << 20,
+		AuditMaxAge:     7 * 24 * time.Hour,
+		AuditMaxBackups: 5,
+
+		DrainTimeout: 30 * time.Second,
+
+		sources: map[string]string{},
 	}
 }
 
 // EnsureDirs creates all required directories.
 func (c *Config) EnsureDirs() error {
-	for _, d := range []string{c.HomeDir, c.ModelsDir, c.BinDir} {
+	for _, d := range []string{c.HomeDir, c.ModelsDir, c.BinDir, c.LogsDir, c.RunDir} {
 		if err := os.MkdirAll(d, 0755); err != nil {
 			return err
 		}
@@ -54,13 +141,41 @@ func (c *Config) EnsureDirs() error {
 	return nil
 }
 
-// BackendBinaryPath returns the path to the llama-server binary.
+// BackendBinaryPath returns the path to the llama-server binary to run.
 func (c *Config) BackendBinaryPath() string {
-	name := "llama-server"
+	if c.BackendBin != "" {
+		return c.BackendBin
+	}
+	if c.BackendVersion == "" {
+		// Unversioned installs put the binary directly in BinDir.
+		return filepath.Join(c.BinDir, BackendBinaryName())
+	}
+	return filepath.Join(c.BackendDir(c.BackendVersion), BackendBinaryName())
+}
+
+// BackendDir returns the directory a llama.cpp release is installed in.
+func (c *Config) BackendDir(tag string) string {
+	return filepath.Join(c.BinDir, tag)
+}
+
+// BackendBinaryName returns the file name of the llama-server binary.
+func BackendBinaryName() string {
 	if runtime.GOOS == "windows" {
-		name += ".exe"
+		return "llama-server.exe"
 	}
-	return filepath.Join(c.BinDir, name)
+	return "llama-server"
+}
+
+// BackendLogPath returns the file that llama-server output for a model is
+// logged to.
+func (c *Config) BackendLogPath(modelID string) string {
+	return filepath.Join(c.LogsDir, sanitize(modelID)+".log")
+}
+
+// GatewayLogPath returns the file that the output of a gateway started with
+// run -d on port goes to.
+func (c *Config) GatewayLogPath(port int) string {
+	return filepath.Join(c.LogsDir, fmt.Sprintf("gateway-%d.log", port))
 }
 
 // ModelDir returns the cache directory for a specific model repo.
@@ -80,3 +195,45 @@ func sanitize(s string) string {
 	}
 	return string(out)
 }
+
+// ParseContext parses a -context value: a number of tokens, or "auto" (0)
+// to use each model's trained context length.
+func ParseContext(s string) (int, error) {
+	if s == "" || strings.EqualFold(s, "auto") {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid context size %q: want a positive number of tokens or \"auto\"", s)
+	}
+	return n, nil
+}
+
+// ParseSize parses a human-readable byte size such as "16GB", "512M" or "1024".
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "IB"), "B")
+
+	mult := int64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			str = str[:n-1]
+		}
+	}
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * float64(mult)), nil
+}
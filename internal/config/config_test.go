@@ -0,0 +1,37 @@
+package config
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"512M", 512 << 20},
+		{"512MB", 512 << 20},
+		{"16GB", 16 << 30},
+		{"16gib", 16 << 30},
+		{"1.5G", 3 << 29},
+		{"2T", 2 << 40},
+		{"4k", 4 << 10},
+		{" 8 GB ", 8 << 30},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if err != nil {
+			t.Errorf("ParseSize(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "GB", "-1G", "lots", "12XB"} {
+		if got, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", in, got)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configFile is the name of the config file in HomeDir. It holds global
+// settings, named profiles and per-model overrides:
+//
+//	{
+//	  "port": 8080,
+//	  "profiles": {"coding": {"context": 16384, "quant": "Q5_K_M"}},
+//	  "models": {"tinyllama": {"context": 2048, "temperature": 0.2}}
+//	}
+const configFile = "config.json"
+
+// SettingsPath returns the path of the config file.
+func (c *Config) SettingsPath() string {
+	return filepath.Join(c.HomeDir, configFile)
+}
+
+// Load returns the configuration built from, in increasing order of
+// precedence: built-in defaults, the config file, the named profile and
+// LLMGW_* environment variables. profile may be "" for none, in which case
+// LLMGW_PROFILE is used if set. Command-line flags go on top with Set.
+func Load(profile string) (*Config, error) {
+	c := New()
+	if profile == "" {
+		profile = os.Getenv("LLMGW_PROFILE")
+	}
+
+	f, err := readConfigFile(c.SettingsPath())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.apply(f.settings, SourceFile); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.SettingsPath(), err)
+	}
+	c.Models = f.models
+
+	if profile != "" {
+		p, ok := f.profiles[profile]
+		if !ok {
+			return nil, unknownProfile(profile, f)
+		}
+		if err := c.apply(p.settings, SourceProfile+" "+profile); err != nil {
+			return nil, fmt.Errorf("%s: profile %q: %w", c.SettingsPath(), profile, err)
+		}
+		for name, m := range p.models {
+			c.Models[name] = m
+		}
+		c.Profile = profile
+	}
+
+	if token := os.Getenv("HF_TOKEN"); token != "" {
+		c.HFToken = token
+		c.sources["token"] = SourceEnv + " HF_TOKEN"
+	}
+	for _, s := range settings {
+		env := EnvVar(s.key)
+		if v := os.Getenv(env); v != "" {
+			if err := c.setFrom(s.key, v, SourceEnv+" "+env); err != nil {
+				return nil, fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// apply sets values read from the config file, in a stable order so that
+// the first invalid one is always the one reported.
+func (c *Config) apply(values map[string]string, source string) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := c.setFrom(k, values[k], source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Profiles returns the names of the profiles in the config file.
+func (c *Config) Profiles() ([]string, error) {
+	f, err := readConfigFile(c.SettingsPath())
+	if err != nil {
+		return nil, err
+	}
+	return f.profileNames(), nil
+}
+
+func unknownProfile(name string, f *fileSection) error {
+	if names := f.profileNames(); len(names) > 0 {
+		return fmt.Errorf("unknown profile %q (have: %s)", name, strings.Join(names, ", "))
+	}
+	return fmt.Errorf("unknown profile %q: the config file defines no profiles", name)
+}
+
+// ------- reading -------
+
+// fileSection is the top level of the config file or one profile in it.
+type fileSection struct {
+	settings map[string]string
+	models   map[string]ModelConfig
+	profiles map[string]*fileSection
+}
+
+func (f *fileSection) profileNames() []string {
+	names := make([]string, 0, len(f.profiles))
+	for name := range f.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readConfigFile parses the config file. A missing file is empty.
+func readConfigFile(path string) (*fileSection, error) {
+	raw, err := readRaw(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseSection(raw, true)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// readRaw reads the config file's top-level object. A missing file is empty.
+func readRaw(path string) (map[string]json.RawMessage, error) {
+	raw := map[string]json.RawMessage{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return raw, nil
+		}
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return raw, nil
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return raw, nil
+}
+
+func parseSection(raw map[string]json.RawMessage, top bool) (*fileSection, error) {
+	f := &fileSection{
+		settings: map[string]string{},
+		models:   map[string]ModelConfig{},
+		profiles: map[string]*fileSection{},
+	}
+	for key, value := range raw {
+		switch {
+		case key == "models":
+			if err := decodeModels(value, f.models); err != nil {
+				return nil, err
+			}
+		case key == "profiles" && top:
+			var profiles map[string]map[string]json.RawMessage
+			if err := json.Unmarshal(value, &profiles); err != nil {
+				return nil, fmt.Errorf("profiles: want an object of profiles")
+			}
+			for name, p := range profiles {
+				section, err := parseSection(p, false)
+				if err != nil {
+					return nil, fmt.Errorf("profile %q: %w", name, err)
+				}
+				f.profiles[name] = section
+			}
+		case IsSetting(key):
+			s, err := scalarString(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			f.settings[key] = s
+		default:
+			return nil, unknownSetting(key)
+		}
+	}
+	return f, nil
+}
+
+func decodeModels(value json.RawMessage, into map[string]ModelConfig) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return fmt.Errorf("models: want an object keyed by model")
+	}
+	for name, v := range raw {
+		m, err := decodeModel(v)
+		if err != nil {
+			return fmt.Errorf("models: %s: %w", name, err)
+		}
+		into[name] = m
+	}
+	return nil
+}
+
+func decodeModel(v json.RawMessage) (ModelConfig, error) {
+	var m ModelConfig
+	dec := json.NewDecoder(bytes.NewReader(v))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return m, err
+	}
+	return m, m.validate()
+}
+
+// scalarString converts a JSON setting value to the string form settings
+// are parsed from. Lists may be written as arrays of strings.
+func scalarString(v json.RawMessage) (string, error) {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s, nil
+	}
+	var list []string
+	if json.Unmarshal(v, &list) == nil {
+		return strings.Join(list, ","), nil
+	}
+	var x interface{}
+	if err := json.Unmarshal(v, &x); err != nil {
+		return "", err
+	}
+	switch x.(type) {
+	case float64, bool:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("want a string, number or boolean")
+}
+
+// ------- writing -------
+
+// SaveSetting validates value and records it in the config file, in the
+// named profile if profile is not "". An empty value removes the setting.
+// c itself is only updated for global settings.
+func (c *Config) SaveSetting(profile, key, value string) error {
+	if value != "" {
+		probe := New()
+		if err := probe.setFrom(key, value, SourceFile); err != nil {
+			return err
+		}
+	} else if !IsSetting(key) {
+		return unknownSetting(key)
+	}
+
+	err := c.updateFile(profile, func(section map[string]json.RawMessage) error {
+		setRaw(section, key, value)
+		return nil
+	})
+	if err != nil || profile != "" || c.explicit(key) {
+		return err
+	}
+	if value == "" {
+		// Fall back to the built-in default.
+		value = New().mustGet(key)
+	}
+	return c.setFrom(key, value, SourceFile)
+}
+
+// SaveModelSetting records a per-model override of field (one of the
+// ModelConfig JSON keys) in the config file, in the named profile if profile
+// is not "". args is split on spaces. An empty value removes the override.
+func (c *Config) SaveModelSetting(profile, model, field, value string) error {
+	return c.updateFile(profile, func(section map[string]json.RawMessage) error {
+		models := map[string]map[string]json.RawMessage{}
+		if raw, ok := section["models"]; ok {
+			if err := json.Unmarshal(raw, &models); err != nil {
+				return fmt.Errorf("models: want an object keyed by model")
+			}
+		}
+		entry := models[model]
+		if entry == nil {
+			entry = map[string]json.RawMessage{}
+		}
+
+		switch {
+		case value == "":
+			delete(entry, field)
+		case field == "args":
+			raw, _ := json.Marshal(strings.Fields(value))
+			entry[field] = raw
+		default:
+			setRaw(entry, field, value)
+		}
+
+		raw, _ := json.Marshal(entry)
+		if _, err := decodeModel(raw); err != nil {
+			return fmt.Errorf("invalid %s %q for %s: %w", field, value, model, err)
+		}
+		if len(entry) == 0 {
+			delete(models, model)
+		} else {
+			models[model] = entry
+		}
+		setJSON(section, "models", models, len(models) == 0)
+		return nil
+	})
+}
+
+// SetBackendVersion makes tag the active llama.cpp version and records it
+// in the config file.
+func (c *Config) SetBackendVersion(tag string) error {
+	return c.SaveSetting("", "backend_version", tag)
+}
+
+// SetBackendBin makes path, an external llama-server binary, the one to
+// run and records it in the config file. An empty path goes back to the
+// downloaded releases.
+func (c *Config) SetBackendBin(path string) error {
+	return c.SaveSetting("", "backend_bin", path)
+}
+
+// updateFile applies update to the top level of the config file, or to the
+// named profile, and writes it back.
+func (c *Config) updateFile(profile string, update func(map[string]json.RawMessage) error) error {
+	path := c.SettingsPath()
+	root, err := readRaw(path)
+	if err != nil {
+		return err
+	}
+
+	if profile == "" {
+		if err := update(root); err != nil {
+			return err
+		}
+	} else {
+		profiles := map[string]map[string]json.RawMessage{}
+		if raw, ok := root["profiles"]; ok {
+			if err := json.Unmarshal(raw, &profiles); err != nil {
+				return fmt.Errorf("%s: profiles: want an object of profiles", path)
+			}
+		}
+		section := profiles[profile]
+		if section == nil {
+			section = map[string]json.RawMessage{}
+		}
+		if err := update(section); err != nil {
+			return err
+		}
+		if len(section) == 0 {
+			delete(profiles, profile)
+		} else {
+			profiles[profile] = section
+		}
+		setJSON(root, "profiles", profiles, len(profiles) == 0)
+	}
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.HomeDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// setRaw stores value under key, as a JSON number or boolean if it looks
+// like one and as a string otherwise. An empty value removes key.
+func setRaw(section map[string]json.RawMessage, key, value string) {
+	if value == "" {
+		delete(section, key)
+		return
+	}
+	var x interface{}
+	if err := json.Unmarshal([]byte(value), &x); err == nil {
+		switch x.(type) {
+		case float64, bool:
+			section[key] = json.RawMessage(value)
+			return
+		}
+	}
+	raw, _ := json.Marshal(value)
+	section[key] = raw
+}
+
+// setJSON stores v under key, or removes key if empty.
+func setJSON(section map[string]json.RawMessage, key string, v interface{}, empty bool) {
+	if empty {
+		delete(section, key)
+		return
+	}
+	raw, _ := json.Marshal(v)
+	section[key] = raw
+}
+
+// mustGet returns the value of a known setting.
+func (c *Config) mustGet(key string) string {
+	v, _ := c.Get(key)
+	return v
+}
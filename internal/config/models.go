@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ModelConfig overrides settings for one model. In the config file, models
+// are keyed by repo ID or alias.
+type ModelConfig struct {
+	Context int    `json:"context,omitempty"`
+	Quant   string `json:"quant,omitempty"`
+
+	// Sampling defaults, used when a request does not set them.
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	MinP          *float64 `json:"min_p,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+
+	// Args are extra llama-server arguments, e.g. ["--flash-attn"].
+	Args []string `json:"args,omitempty"`
+}
+
+// ModelFields lists the keys a model override may set.
+var ModelFields = []string{"context", "quant", "temperature", "top_p", "top_k", "min_p", "repeat_penalty", "args"}
+
+func (m ModelConfig) validate() error {
+	switch {
+	case m.Context < 0:
+		return errors.New("context must be positive")
+	case m.Temperature != nil && *m.Temperature < 0:
+		return errors.New("temperature must not be negative")
+	case m.TopP != nil && (*m.TopP < 0 || *m.TopP > 1):
+		return errors.New("top_p must be between 0 and 1")
+	case m.TopK != nil && *m.TopK < 0:
+		return errors.New("top_k must not be negative")
+	case m.MinP != nil && (*m.MinP < 0 || *m.MinP > 1):
+		return errors.New("min_p must be between 0 and 1")
+	case m.RepeatPenalty != nil && *m.RepeatPenalty < 0:
+		return errors.New("repeat_penalty must not be negative")
+	}
+	return nil
+}
+
+// backendArgs returns the llama-server arguments for the sampling defaults
+// and extra arguments.
+func (m ModelConfig) backendArgs() []string {
+	var args []string
+	float := func(flag string, v *float64) {
+		if v != nil {
+			args = append(args, flag, strconv.FormatFloat(*v, 'g', -1, 64))
+		}
+	}
+	float("--temp", m.Temperature)
+	float("--top-p", m.TopP)
+	if m.TopK != nil {
+		args = append(args, "--top-k", strconv.Itoa(*m.TopK))
+	}
+	float("--min-p", m.MinP)
+	float("--repeat-penalty", m.RepeatPenalty)
+	return append(args, m.Args...)
+}
+
+// String formats the override as space-separated key=value pairs.
+func (m ModelConfig) String() string {
+	var parts []string
+	add := func(k, v string) { parts = append(parts, k+"="+v) }
+	float := func(k string, v *float64) {
+		if v != nil {
+			add(k, strconv.FormatFloat(*v, 'g', -1, 64))
+		}
+	}
+	if m.Context > 0 {
+		add("context", strconv.Itoa(m.Context))
+	}
+	if m.Quant != "" {
+		add("quant", m.Quant)
+	}
+	float("temperature", m.Temperature)
+	float("top_p", m.TopP)
+	if m.TopK != nil {
+		add("top_k", strconv.Itoa(*m.TopK))
+	}
+	float("min_p", m.MinP)
+	float("repeat_penalty", m.RepeatPenalty)
+	if len(m.Args) > 0 {
+		add("args", strings.Join(m.Args, " "))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ResolveModelNames rekeys the per-model overrides by repo ID, using
+// resolve to expand aliases.
+func (c *Config) ResolveModelNames(resolve func(string) string) {
+	resolved := make(map[string]ModelConfig, len(c.Models))
+	for name, m := range c.Models {
+		resolved[resolve(name)] = m
+	}
+	c.Models = resolved
+}
+
+// ForModel returns a copy of c with the overrides for the model repoID
+// applied. Settings given as flags or environment variables win over them.
+func (c *Config) ForModel(repoID string) *Config {
+	mc := *c
+	for name, m := range c.Models {
+		if !strings.EqualFold(name, repoID) {
+			continue
+		}
+		if m.Context > 0 && !c.explicit("context") {
+			mc.CtxSize = m.Context
+		}
+		if m.Quant != "" && !c.explicit("quant") {
+			mc.Quant = m.Quant
+		}
+		mc.BackendArgs = m.backendArgs()
+		break
+	}
+	return &mc
+}
@@ -0,0 +1,327 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources of a setting's value, from lowest to highest precedence.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceProfile = "profile"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// setting is a value that can come from the config file, a profile, an
+// LLMGW_* environment variable or a command-line flag of the same name
+// (with "-" for "_").
+type setting struct {
+	key  string
+	help string
+	get  func(c *Config) string
+	set  func(c *Config, v string) error
+}
+
+var settings = []setting{
+	intSetting("port", "API server port", 1, 65535, func(c *Config) *int { return &c.Port }),
+	intSetting("backend_port", "First internal llama-server port (0 = any free port)", 0, 65535, func(c *Config) *int { return &c.BackendPort }),
+	{
+		key:  "context",
+		help: "Context window in tokens, or \"auto\" for each model's own",
+		get: func(c *Config) string {
+			if c.CtxSize == 0 {
+				return "auto"
+			}
+			return strconv.Itoa(c.CtxSize)
+		},
+		set: func(c *Config, v string) (err error) {
+			c.CtxSize, err = ParseContext(v)
+			return err
+		},
+	},
+	stringSetting("quant", "Preferred quantization, e.g. Q4_K_M", func(c *Config) *string { return &c.Quant }),
+	boolSetting("verbose", "Show backend output", func(c *Config) *bool { return &c.Verbose }),
+	stringSetting("token", "HuggingFace API token (or HF_TOKEN)", func(c *Config) *string { return &c.HFToken }),
+	{
+		key:  "cors_origin",
+		help: "Comma-separated origins allowed by CORS, or \"*\" for any",
+		get:  func(c *Config) string { return strings.Join(c.CORSOrigins, ",") },
+		set: func(c *Config, v string) error {
+			c.CORSOrigins = splitList(v)
+			return nil
+		},
+	},
+	boolSetting("no_auth", "Serve without API keys even if some have been created", func(c *Config) *bool { return &c.NoAuth }),
+	boolSetting("allow_pull", "Let clients download models with /api/pull", func(c *Config) *bool { return &c.AllowPull }),
+	intSetting("rpm", "Requests per minute per client (0 = unlimited)", 0, -1, func(c *Config) *int { return &c.RateLimitRPM }),
+	intSetting("tpd", "Tokens per day per client (0 = unlimited)", 0, -1, func(c *Config) *int { return &c.RateLimitTPD }),
+	intSetting("connections", "Parallel connections per model download", 1, 64, func(c *Config) *int { return &c.DownloadConnections }),
+	{
+		key:  "audit_log",
+		help: "Audit log path, or \"off\"",
+		get: func(c *Config) string {
+			if c.AuditLog == "" {
+				return "off"
+			}
+			return c.AuditLog
+		},
+		set: func(c *Config, v string) error {
+			if v == "off" {
+				v = ""
+			}
+			c.AuditLog = v
+			return nil
+		},
+	},
+	boolSetting("audit_bodies", "Also store prompts and completions in the audit log", func(c *Config) *bool { return &c.AuditBodies }),
+	{
+		key:  "audit_redact",
+		help: "Comma-separated extra regexes to redact from the audit log",
+		get:  func(c *Config) string { return strings.Join(c.AuditRedact, ",") },
+		set: func(c *Config, v string) error {
+			list := splitList(v)
+			for _, expr := range list {
+				if _, err := regexp.Compile(expr); err != nil {
+					return err
+				}
+			}
+			c.AuditRedact = list
+			return nil
+		},
+	},
+	sizeSetting("audit_max_size", "Rotate the audit log past this size", func(c *Config) *int64 { return &c.AuditMaxSize }),
+	durationSetting("audit_max_age", "Rotate the audit log after this long", func(c *Config) *time.Duration { return &c.AuditMaxAge }),
+	intSetting("audit_max_backups", "Rotated audit logs to keep", 0, -1, func(c *Config) *int { return &c.AuditMaxBackups }),
+	sizeSetting("mem_budget", "Max total size of loaded models for serve (0 = no cap)", func(c *Config) *int64 { return &c.MemoryBudget }),
+	durationSetting("idle_ttl", "Unload models idle this long for serve (0 = never)", func(c *Config) *time.Duration { return &c.IdleTTL }),
+	durationSetting("drain_timeout", "How long shutdown waits for requests in flight", func(c *Config) *time.Duration { return &c.DrainTimeout }),
+	stringSetting("backend_bin", "llama-server binary to run instead of a downloaded release", func(c *Config) *string { return &c.BackendBin }),
+	{
+		key:  "backend_version",
+		help: "Active llama.cpp release tag",
+		get:  func(c *Config) string { return c.BackendVersion },
+		set: func(c *Config, v string) error {
+			if strings.ContainsAny(v, `/\:`) || v == "." || v == ".." {
+				return fmt.Errorf("not a release tag")
+			}
+			c.BackendVersion = v
+			return nil
+		},
+	},
+	{
+		key:  "github_api",
+		help: "GitHub API base URL used to find llama.cpp releases",
+		get:  func(c *Config) string { return c.GitHubAPI },
+		set: func(c *Config, v string) error {
+			u, err := url.Parse(v)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("want an http(s) URL")
+			}
+			c.GitHubAPI = strings.TrimRight(v, "/")
+			return nil
+		},
+	},
+}
+
+func lookupSetting(key string) *setting {
+	for i := range settings {
+		if settings[i].key == key {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+// IsSetting reports whether key names a setting.
+func IsSetting(key string) bool {
+	return lookupSetting(key) != nil
+}
+
+// Keys returns the names of all settings.
+func Keys() []string {
+	keys := make([]string, len(settings))
+	for i, s := range settings {
+		keys[i] = s.key
+	}
+	return keys
+}
+
+// Help returns a one-line description of the setting key.
+func Help(key string) string {
+	if s := lookupSetting(key); s != nil {
+		return s.help
+	}
+	return ""
+}
+
+// EnvVar returns the environment variable that overrides the setting key.
+func EnvVar(key string) string {
+	return "LLMGW_" + strings.ToUpper(key)
+}
+
+// Get returns the value of the setting key, formatted as it would be set.
+func (c *Config) Get(key string) (string, error) {
+	s := lookupSetting(key)
+	if s == nil {
+		return "", unknownSetting(key)
+	}
+	return s.get(c), nil
+}
+
+// Source returns where the value of the setting key came from: one of the
+// Source constants, followed by the variable, flag or profile name.
+func (c *Config) Source(key string) string {
+	if src, ok := c.sources[key]; ok {
+		return src
+	}
+	return SourceDefault
+}
+
+// explicit reports whether key was set by a flag or environment variable,
+// which take precedence over per-model overrides.
+func (c *Config) explicit(key string) bool {
+	src := c.Source(key)
+	return strings.HasPrefix(src, SourceFlag) || strings.HasPrefix(src, SourceEnv)
+}
+
+// Set validates and applies a value for the setting key given as a
+// command-line flag.
+func (c *Config) Set(key, value string) error {
+	return c.setFrom(key, value, SourceFlag+" -"+strings.ReplaceAll(key, "_", "-"))
+}
+
+// setFrom validates and applies a value for the setting key, recording
+// source as its origin.
+func (c *Config) setFrom(key, value, source string) error {
+	s := lookupSetting(key)
+	if s == nil {
+		return unknownSetting(key)
+	}
+	if err := s.set(c, strings.TrimSpace(value)); err != nil {
+		return fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	c.sources[key] = source
+	return nil
+}
+
+func unknownSetting(key string) error {
+	keys := Keys()
+	sort.Strings(keys)
+	return fmt.Errorf("unknown setting %q (known: %s)", key, strings.Join(keys, ", "))
+}
+
+// ------- setting constructors -------
+
+// intSetting is an integer setting in [min, max]; max < 0 means unbounded.
+func intSetting(key, help string, min, max int, field func(*Config) *int) setting {
+	return setting{
+		key:  key,
+		help: help,
+		get:  func(c *Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			switch {
+			case err != nil:
+				return fmt.Errorf("want a whole number")
+			case n < min:
+				return fmt.Errorf("must be at least %d", min)
+			case max >= 0 && n > max:
+				return fmt.Errorf("must be at most %d", max)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func stringSetting(key, help string, field func(*Config) *string) setting {
+	return setting{
+		key:  key,
+		help: help,
+		get:  func(c *Config) string { return *field(c) },
+		set: func(c *Config, v string) error {
+			*field(c) = v
+			return nil
+		},
+	}
+}
+
+func boolSetting(key, help string, field func(*Config) *bool) setting {
+	return setting{
+		key:  key,
+		help: help,
+		get:  func(c *Config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("want true or false")
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+func sizeSetting(key, help string, field func(*Config) *int64) setting {
+	return setting{
+		key:  key,
+		help: help,
+		get:  func(c *Config) string { return formatSize(*field(c)) },
+		set: func(c *Config, v string) error {
+			n, err := ParseSize(v)
+			if err != nil {
+				return fmt.Errorf("want a size such as 512MB or 16GB")
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func durationSetting(key, help string, field func(*Config) *time.Duration) setting {
+	return setting{
+		key:  key,
+		help: help,
+		get:  func(c *Config) string { return field(c).String() },
+		set: func(c *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return fmt.Errorf("want a duration such as 15m or 168h")
+			}
+			*field(c) = d
+			return nil
+		},
+	}
+}
+
+// formatSize formats n in the largest unit that divides it exactly, so that
+// ParseSize reads it back unchanged.
+func formatSize(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n != 0 && n%u.size == 0 {
+			return strconv.FormatInt(n/u.size, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// splitList splits a comma-separated value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       string // as returned by Get
+	}{
+		{"port", "9090", "9090"},
+		{"backend_port", "0", "0"},
+		{"context", "auto", "auto"},
+		{"context", "8192", "8192"},
+		{"verbose", "true", "true"},
+		{"cors_origin", " a.test, ,b.test ", "a.test,b.test"},
+		{"audit_log", "off", "off"},
+		{"mem_budget", "16GB", "16GB"},
+		{"mem_budget", "1536M", "1536MB"},
+		{"mem_budget", "1000", "1000"},
+		{"idle_ttl", "15m", "15m0s"},
+		{"github_api", "https://api.example.test/", "https://api.example.test"},
+	}
+	for _, tt := range tests {
+		c := New()
+		if err := c.Set(tt.key, tt.value); err != nil {
+			t.Errorf("Set(%s, %q): %v", tt.key, tt.value, err)
+			continue
+		}
+		if got, _ := c.Get(tt.key); got != tt.want {
+			t.Errorf("Set(%s, %q): Get = %q, want %q", tt.key, tt.value, got, tt.want)
+		}
+		if src := c.Source(tt.key); !strings.HasPrefix(src, SourceFlag) {
+			t.Errorf("Set(%s, %q): Source = %q, want a flag", tt.key, tt.value, src)
+		}
+	}
+}
+
+func TestSetInvalid(t *testing.T) {
+	tests := []struct{ key, value string }{
+		{"port", "0"},
+		{"port", "65536"},
+		{"port", "80a"},
+		{"context", "-1"},
+		{"verbose", "maybe"},
+		{"connections", "65"},
+		{"audit_redact", "("},
+		{"mem_budget", "lots"},
+		{"idle_ttl", "-5m"},
+		{"backend_version", "../b1"},
+		{"github_api", "ftp://example.test"},
+		{"no_such_setting", "1"},
+	}
+	for _, tt := range tests {
+		c := New()
+		before, _ := c.Get(tt.key)
+		if err := c.Set(tt.key, tt.value); err == nil {
+			t.Errorf("Set(%s, %q) succeeded, want an error", tt.key, tt.value)
+		}
+		if after, _ := c.Get(tt.key); after != before {
+			t.Errorf("Set(%s, %q) changed the value to %q", tt.key, tt.value, after)
+		}
+		if src := c.Source(tt.key); src != SourceDefault {
+			t.Errorf("Set(%s, %q): Source = %q, want %q", tt.key, tt.value, src, SourceDefault)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("LLMGW_HOME", home)
+	t.Setenv("LLMGW_PROFILE", "")
+	t.Setenv("HF_TOKEN", "")
+	t.Setenv("LLMGW_RPM", "30")
+	os.WriteFile(filepath.Join(home, configFile), []byte(`{
+		"port": 9000,
+		"verbose": true,
+		"cors_origin": ["a.test", "b.test"],
+		"rpm": 10,
+		"profiles": {"big": {"context": 16384, "idle_ttl": "1h"}},
+		"models": {"tinyllama": {"context": 2048}}
+	}`), 0644)
+
+	c, err := Load("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 9000 || c.Source("port") != SourceFile {
+		t.Errorf("port = %d from %q, want 9000 from the file", c.Port, c.Source("port"))
+	}
+	if !c.Verbose {
+		t.Errorf("verbose = false, want true")
+	}
+	if got := strings.Join(c.CORSOrigins, ","); got != "a.test,b.test" {
+		t.Errorf("cors_origin = %q, want a.test,b.test", got)
+	}
+	if c.CtxSize != 16384 || c.Source("context") != SourceProfile+" big" {
+		t.Errorf("context = %d from %q, want 16384 from profile big", c.CtxSize, c.Source("context"))
+	}
+	if c.IdleTTL != time.Hour {
+		t.Errorf("idle_ttl = %v, want 1h", c.IdleTTL)
+	}
+	if c.RateLimitRPM != 30 || c.Source("rpm") != SourceEnv+" LLMGW_RPM" {
+		t.Errorf("rpm = %d from %q, want 30 from LLMGW_RPM", c.RateLimitRPM, c.Source("rpm"))
+	}
+	if m, ok := c.Models["tinyllama"]; !ok || m.Context != 2048 {
+		t.Errorf("models[tinyllama] = %+v, want context 2048", m)
+	}
+
+	if _, err := Load("small"); err == nil || !strings.Contains(err.Error(), "big") {
+		t.Errorf("Load(small) = %v, want an unknown profile error listing big", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct{ profile, content string }{
+		{"", `{"port": "eighty"}`},
+		{"", `{"no_such_setting": 1}`},
+		{"", `{"cors_origin": {"a": 1}}`},
+		{"", `{"models": {"m": {"no_such_field": 1}}}`},
+		{"", `{"port": `},
+		{"p", `{"profiles": {"p": {"port": 0}}}`},
+	}
+	for _, tt := range tests {
+		home := t.TempDir()
+		t.Setenv("LLMGW_HOME", home)
+		t.Setenv("LLMGW_PROFILE", "")
+		os.WriteFile(filepath.Join(home, configFile), []byte(tt.content), 0644)
+		if _, err := Load(tt.profile); err == nil {
+			t.Errorf("Load(%q) with %s succeeded, want an error", tt.profile, tt.content)
+		}
+	}
+}
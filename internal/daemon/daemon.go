@@ -0,0 +1,280 @@
+// Package daemon keeps track of running gateways. Every gateway records its
+// state in a file under ~/.llmgw/run/, which ps, status and stop read, and
+// run -d uses Start to launch one detached from the terminal.
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvLog is set in the environment of a detached gateway to the file its
+// output goes to.
+const EnvLog = "LLMGW_DAEMON_LOG"
+
+// killWait bounds how long to wait for a process to die after SIGKILL.
+const killWait = 5 * time.Second
+
+// State describes a running gateway. It is stored as <port>.json in the run
+// directory.
+type State struct {
+	PID       int       `json:"pid"`
+	Port      int       `json:"port"`
+	Models    []string  `json:"models"`
+	StartedAt time.Time `json:"started_at"`
+	// Command is the gateway's executable name, used to tell it apart from
+	// an unrelated process that was given the same PID after a crash.
+	Command string `json:"command"`
+	// Backends maps each loaded model to its llama-server PID.
+	Backends   map[string]int `json:"backends,omitempty"`
+	BackendBin string         `json:"backend_bin,omitempty"`
+	// LogPath is where the output of a detached gateway goes.
+	LogPath string `json:"log,omitempty"`
+
+	// Orphans lists the llama-server processes killed while cleaning up
+	// after the gateway; see Scan.
+	Orphans []int `json:"-"`
+
+	path string
+}
+
+// Detached reports whether the gateway was started with run -d.
+func (s *State) Detached() bool {
+	return s.LogPath != ""
+}
+
+// Running reports whether the gateway process is still alive.
+func (s *State) Running() bool {
+	return running(s.PID, s.Command)
+}
+
+// Serves reports whether the gateway serves model.
+func (s *State) Serves(model string) bool {
+	for _, m := range s.Models {
+		if strings.EqualFold(m, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop asks the gateway to shut down and waits up to timeout for it to exit
+// before killing it. Any llama-server it leaves behind is killed too.
+func (s *State) Stop(timeout time.Duration) error {
+	if s.Running() {
+		if err := terminate(s.PID); err != nil && s.Running() {
+			return fmt.Errorf("stopping pid %d: %w", s.PID, err)
+		}
+		if !waitExit(s.PID, s.Command, timeout) {
+			kill(s.PID)
+			if !waitExit(s.PID, s.Command, killWait) {
+				return fmt.Errorf("pid %d did not exit", s.PID)
+			}
+		}
+	}
+	s.cleanup()
+	return nil
+}
+
+// cleanup kills the gateway's orphaned llama-server processes and removes
+// its state file.
+func (s *State) cleanup() {
+	name := filepath.Base(s.BackendBin)
+	if s.BackendBin == "" {
+		name = "llama-server"
+	}
+	for _, pid := range s.Backends {
+		if running(pid, name) {
+			kill(pid)
+			s.Orphans = append(s.Orphans, pid)
+		}
+	}
+	os.Remove(s.path)
+}
+
+// Scan reads the state of every gateway in dir. It returns the live ones,
+// ordered by port, and the ones whose process has died, which it cleans up.
+func Scan(dir string) (live, stale []*State, err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, path := range paths {
+		s, err := readState(path)
+		if err != nil {
+			// A file being written, or left half-written by a crash.
+			continue
+		}
+		if s.Running() {
+			live = append(live, s)
+		} else {
+			s.cleanup()
+			stale = append(stale, s)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].Port < live[j].Port })
+	return live, stale, nil
+}
+
+// Lookup returns the live gateway on port, or nil. A stale state file for
+// the port is cleaned up.
+func Lookup(dir string, port int) *State {
+	s, err := readState(statePath(dir, port))
+	if err != nil {
+		return nil
+	}
+	if !s.Running() {
+		s.cleanup()
+		return nil
+	}
+	return s
+}
+
+func readState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.path = path
+	return &s, nil
+}
+
+func statePath(dir string, port int) string {
+	return filepath.Join(dir, strconv.Itoa(port)+".json")
+}
+
+// ------- tracking this gateway -------
+
+// Tracker keeps the current gateway's state file up to date.
+type Tracker struct {
+	mu    sync.Mutex
+	state State
+}
+
+// Register records s as the state of the current process, filling in its
+// PID and command. It fails if another live gateway is registered on the
+// same port.
+func Register(dir string, s State) (*Tracker, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if other := Lookup(dir, s.Port); other != nil && other.PID != os.Getpid() {
+		return nil, fmt.Errorf("a gateway is already running on port %d (pid %d)", s.Port, other.PID)
+	}
+
+	s.PID = os.Getpid()
+	if exe, err := os.Executable(); err == nil {
+		s.Command = filepath.Base(exe)
+	}
+	if s.Backends == nil {
+		s.Backends = make(map[string]int)
+	}
+	s.path = statePath(dir, s.Port)
+
+	t := &Tracker{state: s}
+	if err := t.write(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SetBackend records that a llama-server with the given PID started
+// (running) or exited for model.
+func (t *Tracker) SetBackend(model string, pid int, running bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case running:
+		t.state.Backends[model] = pid
+	case t.state.Backends[model] == pid:
+		delete(t.state.Backends, model)
+	default:
+		return
+	}
+	t.write()
+}
+
+// Remove deletes the state file. It is called when the gateway exits.
+func (t *Tracker) Remove() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	os.Remove(t.state.path)
+}
+
+// write replaces the state file. The new content is written to a temporary
+// file first so that readers never see a partial one. Must be called with
+// t.mu held, except during Register.
+func (t *Tracker) write() error {
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := t.state.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.state.path)
+}
+
+// ------- detaching -------
+
+// Start runs the executable exe with args in the background, detached from
+// the terminal, with its output appended to logPath. The child finds
+// logPath in EnvLog.
+func Start(exe string, args []string, logPath string) (*os.Process, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+	defer devNull.Close()
+
+	fmt.Fprintf(logFile, "==> %s starting %s %s\n", time.Now().Format(time.RFC3339), exe, strings.Join(args, " "))
+	return os.StartProcess(exe, append([]string{exe}, args...), &os.ProcAttr{
+		Env:   append(os.Environ(), EnvLog+"="+logPath),
+		Files: []*os.File{devNull, logFile, logFile},
+		Sys:   detachAttr(),
+	})
+}
+
+// waitExit polls until the process pid is gone, for up to timeout, and
+// reports whether it exited.
+func waitExit(pid int, command string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for running(pid, command) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// running reports whether the process pid is alive and, if its command
+// line can be read, whether it mentions name.
+func running(pid int, name string) bool {
+	if pid <= 0 || !alive(pid) {
+		return false
+	}
+	cmdline := processCommand(pid)
+	return cmdline == "" || name == "" || strings.Contains(cmdline, name)
+}
@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// sleeper starts a process that runs until the test ends.
+func sleeper(t *testing.T) *exec.Cmd {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sleep")
+	}
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return cmd
+}
+
+// deadPID returns the PID of a process that has exited.
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func writeState(t *testing.T, dir string, s State) {
+	t.Helper()
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statePath(dir, s.Port), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	start := time.Now().Truncate(time.Second)
+	tr, err := Register(dir, State{Port: 8080, Models: []string{"org/tiny"}, StartedAt: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Lookup(dir, 8080)
+	if s == nil {
+		t.Fatal("registered gateway not found")
+	}
+	exe, _ := os.Executable()
+	if s.PID != os.Getpid() || s.Command != filepath.Base(exe) || !s.StartedAt.Equal(start) || !s.Serves("ORG/tiny") {
+		t.Errorf("state = %+v", s)
+	}
+
+	tr.SetBackend("org/tiny", 4242, true)
+	tr.SetBackend("org/tiny", 4343, false) // an older process exiting
+	if s := Lookup(dir, 8080); s.Backends["org/tiny"] != 4242 {
+		t.Errorf("backends = %v, want org/tiny on 4242", s.Backends)
+	}
+	tr.SetBackend("org/tiny", 4242, false)
+	if s := Lookup(dir, 8080); len(s.Backends) != 0 {
+		t.Errorf("backends = %v after the backend exited, want none", s.Backends)
+	}
+
+	// This process may register the port again; another live gateway may not.
+	if _, err := Register(dir, State{Port: 8080}); err != nil {
+		t.Errorf("registering again: %v", err)
+	}
+	other := sleeper(t)
+	writeState(t, dir, State{PID: other.Process.Pid, Port: 9090, Command: "sleep"})
+	if _, err := Register(dir, State{Port: 9090}); err == nil {
+		t.Errorf("registered over a live gateway")
+	}
+
+	tr.Remove()
+	if _, err := os.Stat(statePath(dir, 8080)); !os.IsNotExist(err) {
+		t.Errorf("state file left after Remove")
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	exe, _ := os.Executable()
+	self := filepath.Base(exe)
+	orphan := sleeper(t)
+
+	writeState(t, dir, State{PID: os.Getpid(), Port: 9001, Command: self})
+	writeState(t, dir, State{PID: os.Getpid(), Port: 8001, Command: self})
+	// The gateway died and left a llama-server behind.
+	writeState(t, dir, State{PID: deadPID(t), Port: 8002, Command: self,
+		Backends: map[string]int{"org/tiny": orphan.Process.Pid}, BackendBin: "/usr/bin/sleep"})
+	// The PID was reused by another program.
+	writeState(t, dir, State{PID: os.Getpid(), Port: 8003, Command: "llmgw-not-this"})
+	os.WriteFile(filepath.Join(dir, "8004.json"), []byte(`{"pid":`), 0644)
+
+	live, stale, err := Scan(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(live) != 2 || live[0].Port != 8001 || live[1].Port != 9001 {
+		t.Errorf("live = %+v, want ports 8001 and 9001", live)
+	}
+	if len(stale) != 2 {
+		t.Fatalf("stale = %+v, want ports 8002 and 8003", stale)
+	}
+	for _, s := range stale {
+		if _, err := os.Stat(s.path); !os.IsNotExist(err) {
+			t.Errorf("stale state for port %d not removed", s.Port)
+		}
+		if s.Port == 8002 && (len(s.Orphans) != 1 || s.Orphans[0] != orphan.Process.Pid) {
+			t.Errorf("orphans = %v, want the leftover llama-server %d", s.Orphans, orphan.Process.Pid)
+		}
+	}
+	if !waitExit(orphan.Process.Pid, "sleep", 5*time.Second) {
+		t.Errorf("orphaned backend still running")
+	}
+	// A half-written file is skipped, not removed.
+	if _, err := os.Stat(filepath.Join(dir, "8004.json")); err != nil {
+		t.Errorf("unreadable state file removed: %v", err)
+	}
+
+	if Lookup(dir, 8002) != nil || Lookup(dir, 7000) != nil {
+		t.Errorf("Lookup found a gateway that is not running")
+	}
+}
@@ -0,0 +1,57 @@
+//go:build windows
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	detachedProcess       = 0x00000008
+	createNewProcessGroup = 0x00000200
+	stillActive           = 259
+)
+
+func detachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | createNewProcessGroup, HideWindow: true}
+}
+
+func alive(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	return syscall.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
+
+// processCommand returns the image name of the process pid, or "" if it
+// cannot be read.
+func processCommand(pid int) string {
+	out, err := exec.Command("tasklist", "/FI", "PID eq "+strconv.Itoa(pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return ""
+	}
+	// "llama-server.exe","1234","Console","1","1,234 K"
+	name, _, _ := strings.Cut(strings.TrimSpace(string(out)), ",")
+	return strings.Trim(name, `"`)
+}
+
+// terminate kills the process: Windows has no SIGTERM to send to a process
+// without a console.
+func terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+func kill(pid int) {
+	terminate(pid)
+}
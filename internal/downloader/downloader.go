@@ -1,75 +1,438 @@
 package downloader
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/llmgw/llmgw/internal/metrics"
 	"github.com/llmgw/llmgw/internal/ui"
 )
 
+// Retry policy for transient failures. The partial file is kept between
+// attempts and the download resumes where it stopped.
+const (
+	maxAttempts    = 6
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// Concurrency is the number of connections used for one file. Files are
+// split into ranges fetched in parallel when the server supports it; 1
+// forces single-stream downloads.
+var Concurrency = 4
+
+var downloadedBytes = metrics.NewCounter("llmgw_download_bytes_total",
+	"Bytes downloaded from remote servers.")
+
+// ErrChecksum is returned when a downloaded file does not match its
+// expected SHA-256 digest.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// ProgressFunc receives the bytes written so far and the expected total
+// (0 if the server did not send a Content-Length).
+type ProgressFunc func(done, total int64)
+
+// Options controls a Download.
+type Options struct {
+	// SHA256 is the expected hex digest of the file. A download that does
+	// not match is deleted instead of being moved into place.
+	SHA256 string
+	// Progress receives progress updates instead of the terminal progress bar.
+	Progress ProgressFunc
+	// Connections overrides Concurrency for this download when positive.
+	Connections int
+	// Context, when set, cancels the download once it is done. The partial
+	// file is kept for the next attempt to resume.
+	Context context.Context
+}
+
 // DownloadFile downloads a URL to destPath, showing a progress bar.
 // If the file already exists and is non-empty, it skips the download.
 func DownloadFile(url, destPath, label string) error {
+	_, err := Download(url, destPath, label, Options{})
+	return err
+}
+
+// Download is DownloadFile with options. It returns the file's SHA-256 when
+// it was computed: always when opts.SHA256 is set, and for single-stream
+// downloads, which hash while streaming. An existing file is not re-hashed.
+//
+// Interrupted downloads leave destPath+".download" behind and are resumed
+// with Range requests on the next call, provided the remote file's ETag or
+// Last-Modified is unchanged. Transient failures are retried with
+// exponential backoff.
+func Download(url, destPath, label string, opts Options) (string, error) {
 	if info, err := os.Stat(destPath); err == nil && info.Size() > 0 {
-		return nil
+		return "", nil
 	}
 
 	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-		return fmt.Errorf("creating directory: %w", err)
+		return "", fmt.Errorf("creating directory: %w", err)
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	d := &download{
+		ctx:       ctx,
+		url:       url,
+		tmpPath:   destPath + ".download",
+		statePath: destPath + ".download.json",
+		label:     label,
+		progress:  opts.Progress,
+	}
+
+	conns := Concurrency
+	if opts.Connections > 0 {
+		conns = opts.Connections
+	}
+	err := errNoRanges
+	if conns > 1 {
+		err = d.parallel(conns)
+	}
+	if errors.Is(err, errNoRanges) {
+		err = d.retry(d.attempt)
+	}
+	if err != nil {
+		if d.bar != nil {
+			d.bar.Interrupt()
+		}
+		return "", fmt.Errorf("download %s failed: %w", label, err)
+	}
+	if d.bar != nil {
+		d.bar.Finish()
+	}
+
+	sum := d.sum
+	if sum == "" && opts.SHA256 != "" {
+		// Parallel downloads cannot hash in order while streaming.
+		if sum, err = SHA256File(d.tmpPath, nil); err != nil {
+			return "", fmt.Errorf("verifying %s: %w", label, err)
+		}
+	}
+	if opts.SHA256 != "" && !strings.EqualFold(sum, opts.SHA256) {
+		d.reset()
+		return "", fmt.Errorf("verifying %s: %w: expected %s, got %s", label, ErrChecksum, opts.SHA256, sum)
+	}
+
+	if err := os.Rename(d.tmpPath, destPath); err != nil {
+		return "", fmt.Errorf("finalizing %s: %w", label, err)
+	}
+	os.Remove(d.statePath)
+	return sum, nil
+}
+
+// SHA256File returns the hex SHA-256 digest of the file at path, reporting
+// progress to fn if it is non-nil.
+func SHA256File(path string, fn ProgressFunc) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if fn != nil {
+		info, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		total := info.Size()
+		r = &progressReader{reader: f, report: func(n int64) { fn(n, total) }}
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// permanentError marks a failure that retrying will not fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// partState is stored next to a partial download and records which remote
+// file the partial bytes came from. Parallel downloads also record how much
+// of each chunk has been written.
+type partState struct {
+	URL          string  `json:"url"`
+	ETag         string  `json:"etag,omitempty"`
+	LastModified string  `json:"last_modified,omitempty"`
+	Size         int64   `json:"size"`
+	Chunks       []chunk `json:"chunks,omitempty"`
+}
+
+// validator returns the If-Range value that proves the remote file is
+// unchanged, or "" if there is none. Weak ETags cannot be used with If-Range.
+func (s *partState) validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+func loadState(path string) *partState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var s partState
+	if json.Unmarshal(data, &s) != nil {
+		return nil
+	}
+	return &s
+}
+
+func saveState(path string, s *partState) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// download is one file transfer, possibly spanning several attempts.
+type download struct {
+	ctx       context.Context
+	url       string
+	tmpPath   string
+	statePath string
+	label     string
+	progress  ProgressFunc
+	bar       *ui.ProgressBar
+	total     int64
+	sum       string // SHA-256 computed while streaming, if any
+}
+
+// retry calls fn until it succeeds, fails permanently or runs out of
+// attempts, sleeping with exponential backoff in between.
+func (d *download) retry(fn func() error) error {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if d.ctx.Err() != nil {
+			return d.ctx.Err()
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt == maxAttempts {
+			return err
+		}
+		if d.bar != nil {
+			d.bar.Interrupt()
+		}
+		if d.progress == nil {
+			ui.Warn("%s: %v (retrying in %s)", d.label, err, backoff)
+		}
+		select {
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
 	}
+}
 
-	tmpPath := destPath + ".download"
+// attempt makes one single-stream request, resuming the partial file when
+// it can.
+func (d *download) attempt() error {
+	state := loadState(d.statePath)
+	var offset int64
+	if info, err := os.Stat(d.tmpPath); err == nil && state != nil && state.URL == d.url &&
+		state.validator() != "" && len(state.Chunks) == 0 {
+		offset = info.Size()
+	}
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodGet, d.url, nil)
 	if err != nil {
-		return fmt.Errorf("requesting %s: %w", label, err)
+		return &permanentError{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", state.validator())
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting %s: %w", d.label, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download %s failed: HTTP %d", label, resp.StatusCode)
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			d.reset()
+			return fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+		d.total = total
+
+	case http.StatusOK:
+		// Either a fresh download, or the remote file changed and the
+		// server ignored our Range: start over from zero.
+		offset = 0
+		flags |= os.O_TRUNC
+		d.total = resp.ContentLength
+		if d.total < 0 {
+			d.total = 0
+		}
+		err := saveState(d.statePath, &partState{
+			URL:          d.url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         d.total,
+		})
+		if err != nil {
+			return &permanentError{fmt.Errorf("saving download state: %w", err)}
+		}
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		if state != nil && state.Size > 0 && offset == state.Size {
+			// The previous attempt already received everything.
+			sum, err := SHA256File(d.tmpPath, nil)
+			if err != nil {
+				return &permanentError{err}
+			}
+			d.sum = sum
+			return nil
+		}
+		d.reset()
+		return fmt.Errorf("server rejected resume range; restarting")
+
+	default:
+		err := fmt.Errorf("HTTP %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return err
+		}
+		return &permanentError{err}
 	}
 
-	out, err := os.Create(tmpPath)
+	out, err := os.OpenFile(d.tmpPath, flags, 0644)
 	if err != nil {
-		return fmt.Errorf("creating temp file: %w", err)
+		return &permanentError{fmt.Errorf("creating temp file: %w", err)}
 	}
+	defer out.Close()
 
-	var writeErr error
-	if resp.ContentLength > 0 {
-		bar := ui.NewProgressBar(resp.ContentLength, label)
-		pr := &progressReader{reader: resp.Body, bar: bar}
-		_, writeErr = io.Copy(out, pr)
-		bar.Finish()
-	} else {
-		_, writeErr = io.Copy(out, resp.Body)
+	// Hash the bytes kept from earlier attempts, then the rest as it arrives.
+	h := sha256.New()
+	if offset > 0 {
+		if err := hashPrefix(h, d.tmpPath, offset); err != nil {
+			return &permanentError{fmt.Errorf("reading partial file: %w", err)}
+		}
 	}
 
-	out.Close()
-	if writeErr != nil {
-		os.Remove(tmpPath)
-		return fmt.Errorf("writing %s: %w", label, writeErr)
+	report := d.reporter(offset)
+	body := io.TeeReader(meteredReader{resp.Body}, h)
+	pr := &progressReader{reader: body, report: report, current: offset}
+	if _, err := io.Copy(out, pr); err != nil {
+		return fmt.Errorf("writing %s: %w", d.label, err)
 	}
+	if d.total > 0 && pr.current != d.total {
+		return fmt.Errorf("connection closed after %s of %s",
+			ui.FormatBytes(pr.current), ui.FormatBytes(d.total))
+	}
+	d.sum = hex.EncodeToString(h.Sum(nil))
+	return out.Close()
+}
+
+// hashPrefix feeds the first n bytes of the file at path into h.
+func hashPrefix(h hash.Hash, path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(h, f, n)
+	return err
+}
+
+// reporter returns the progress callback for an attempt starting at offset.
+func (d *download) reporter(offset int64) func(int64) {
+	if d.progress != nil {
+		d.progress(offset, d.total)
+		return func(n int64) { d.progress(n, d.total) }
+	}
+	if d.total <= 0 {
+		return func(int64) {}
+	}
+	if d.bar == nil {
+		d.bar = ui.NewProgressBar(d.total, d.label)
+		if offset > 0 {
+			d.bar.Resume(offset)
+		}
+	} else {
+		d.bar.Update(offset)
+	}
+	return d.bar.Update
+}
+
+// reset discards the partial file so the next attempt starts from zero.
+func (d *download) reset() {
+	os.Remove(d.tmpPath)
+	os.Remove(d.statePath)
+}
 
-	if err := os.Rename(tmpPath, destPath); err != nil {
-		os.Remove(tmpPath)
-		return fmt.Errorf("finalizing %s: %w", label, err)
+// parseContentRange parses "bytes start-end/total".
+func parseContentRange(v string) (start, total int64, ok bool) {
+	v, found := strings.CutPrefix(v, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, size, found := strings.Cut(v, "/")
+	if !found {
+		return 0, 0, false
+	}
+	first, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	total, err2 := strconv.ParseInt(size, 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
 	}
-	return nil
+	return start, total, true
 }
 
 type progressReader struct {
 	reader  io.Reader
-	bar     *ui.ProgressBar
+	report  func(current int64)
 	current int64
 }
 
 func (pr *progressReader) Read(p []byte) (int, error) {
 	n, err := pr.reader.Read(p)
 	pr.current += int64(n)
-	pr.bar.Update(pr.current)
+	pr.report(pr.current)
+	return n, err
+}
+
+// meteredReader counts bytes read from the network in downloadedBytes.
+type meteredReader struct {
+	io.Reader
+}
+
+func (r meteredReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	downloadedBytes.Add(float64(n))
 	return n, err
 }
@@ -0,0 +1,200 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fileServer serves content with an ETag, honouring Range and If-Range, and
+// records the Range header of each request.
+type fileServer struct {
+	content []byte
+	etag    string
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.mu.Unlock()
+	w.Header().Set("ETag", s.etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.content))
+}
+
+func testContent() []byte {
+	return bytes.Repeat([]byte("0123456789abcdef"), 4096)
+}
+
+func hexSum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// partial leaves behind what an interrupted download of url would have:
+// the first n bytes of content and the state recording etag.
+func partial(t *testing.T, dest, url, etag string, content []byte, n int) {
+	t.Helper()
+	if err := os.WriteFile(dest+".download", content[:n], 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := saveState(dest+".download.json", &partState{URL: url, ETag: etag, Size: int64(len(content))})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fetch(t *testing.T, url, dest string) string {
+	t.Helper()
+	sum, err := Download(url, dest, "test", Options{Connections: 1, Progress: func(int64, int64) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dest + ".download.json"); !os.IsNotExist(err) {
+		t.Errorf("download state left behind")
+	}
+	if want := testContent(); !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes that differ from the %d served", len(got), len(want))
+	}
+	return sum
+}
+
+func TestDownloadResumes(t *testing.T) {
+	fs := &fileServer{content: testContent(), etag: `"v1"`}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	partial(t, dest, srv.URL, `"v1"`, fs.content, 1000)
+	sum := fetch(t, srv.URL, dest)
+
+	if len(fs.ranges) != 1 || fs.ranges[0] != "bytes=1000-" {
+		t.Errorf("requested ranges %q, want [bytes=1000-]", fs.ranges)
+	}
+	if sum != hexSum(fs.content) {
+		t.Errorf("sum %s does not cover the resumed prefix", sum)
+	}
+}
+
+func TestDownloadRestartsWhenFileChanged(t *testing.T) {
+	fs := &fileServer{content: testContent(), etag: `"v2"`}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	// The partial bytes came from an older version: If-Range fails, the
+	// server sends the whole file and it replaces them.
+	stale := bytes.Repeat([]byte("x"), len(fs.content))
+	partial(t, dest, srv.URL, `"v1"`, stale, 1000)
+	fetch(t, srv.URL, dest)
+
+	if len(fs.ranges) != 1 || fs.ranges[0] != "bytes=1000-" {
+		t.Errorf("requested ranges %q, want [bytes=1000-]", fs.ranges)
+	}
+}
+
+func TestDownloadNoValidator(t *testing.T) {
+	fs := &fileServer{content: testContent(), etag: `W/"weak"`}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	// A weak ETag cannot be used with If-Range, so nothing is resumed.
+	partial(t, dest, srv.URL, `W/"weak"`, []byte(strings.Repeat("x", 1000)), 1000)
+	fetch(t, srv.URL, dest)
+
+	if len(fs.ranges) != 1 || fs.ranges[0] != "" {
+		t.Errorf("requested ranges %q, want a single full request", fs.ranges)
+	}
+}
+
+func TestDownloadAlreadyComplete(t *testing.T) {
+	fs := &fileServer{content: testContent(), etag: `"v1"`}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	// Every byte arrived but the download was not moved into place: the
+	// server answers the resume with 416.
+	partial(t, dest, srv.URL, `"v1"`, fs.content, len(fs.content))
+	sum := fetch(t, srv.URL, dest)
+
+	if sum != hexSum(fs.content) {
+		t.Errorf("sum %s, want %s", sum, hexSum(fs.content))
+	}
+}
+
+func TestAttemptRangeNotSatisfiable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+	}))
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	// The partial file is shorter than the recorded size, so a 416 means
+	// the range is wrong: the partial file is dropped and the next attempt
+	// starts over.
+	content := testContent()
+	partial(t, dest, srv.URL, `"v1"`, content, 1000)
+	d := &download{ctx: context.Background(), url: srv.URL, tmpPath: dest + ".download", statePath: dest + ".download.json",
+		label: "test", progress: func(int64, int64) {}}
+	err := d.attempt()
+	var perm *permanentError
+	if err == nil || errors.As(err, &perm) {
+		t.Fatalf("attempt = %v, want a retryable error", err)
+	}
+	if _, err := os.Stat(d.tmpPath); !os.IsNotExist(err) {
+		t.Errorf("partial file kept after a rejected range")
+	}
+}
+
+func TestAttemptPermanentFailure(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	d := &download{ctx: context.Background(), url: srv.URL, tmpPath: dest + ".download", statePath: dest + ".download.json",
+		label: "test", progress: func(int64, int64) {}}
+	var perm *permanentError
+	if err := d.attempt(); !errors.As(err, &perm) {
+		t.Errorf("attempt = %v, want a permanent error for HTTP 404", err)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		in           string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 100-199/1000", 100, 1000, true},
+		{"bytes 0-0/1", 0, 1, true},
+		{"bytes 100-199/*", 0, 0, false},
+		{"items 100-199/1000", 0, 0, false},
+		{"bytes 100/1000", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, total, ok := parseContentRange(tt.in)
+		if ok != tt.ok || (ok && (start != tt.start || total != tt.total)) {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v; want %d, %d, %v",
+				tt.in, start, total, ok, tt.start, tt.total, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/llmgw/llmgw/internal/ui"
+)
+
+// File is one file of a DownloadGroup.
+type File struct {
+	URL    string
+	Path   string
+	Label  string
+	Size   int64 // expected size, used for progress before the transfer starts
+	SHA256 string
+}
+
+// DownloadGroup downloads several files concurrently, such as the parts of
+// a split model, and reports their combined progress under label. The
+// Concurrency budget is shared between the files. It returns the SHA-256 of
+// each file as Download does. Cancelling ctx stops every download.
+func DownloadGroup(ctx context.Context, files []File, label string, progress ProgressFunc) ([]string, error) {
+	if len(files) == 1 {
+		f := files[0]
+		sum, err := Download(f.URL, f.Path, f.Label, Options{SHA256: f.SHA256, Progress: progress, Context: ctx})
+		return []string{sum}, err
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+
+	var (
+		mu   sync.Mutex
+		done = make([]int64, len(files))
+		bar  *ui.ProgressBar
+	)
+	if progress == nil && total > 0 {
+		bar = ui.NewProgressBar(total, label)
+	}
+	report := func(i int, n int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		done[i] = n
+		var sum int64
+		for _, d := range done {
+			sum += d
+		}
+		if bar != nil {
+			bar.Update(sum)
+		} else if progress != nil {
+			progress(sum, total)
+		}
+	}
+
+	parallel := min(max(Concurrency, 1), len(files))
+	conns := max(1, Concurrency/parallel)
+	sem := make(chan struct{}, parallel)
+
+	sums := make([]string, len(files))
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, f := range files {
+		if info, err := os.Stat(f.Path); err == nil && info.Size() > 0 {
+			report(i, info.Size())
+			continue
+		}
+		wg.Add(1)
+		go func(i int, f File) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			sums[i], errs[i] = Download(f.URL, f.Path, f.Label, Options{
+				SHA256:      f.SHA256,
+				Connections: conns,
+				Progress:    func(n, _ int64) { report(i, n) },
+				Context:     ctx,
+			})
+		}(i, f)
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if bar != nil {
+		if err != nil {
+			bar.Interrupt()
+		} else {
+			bar.Finish()
+		}
+	}
+	return sums, err
+}
@@ -0,0 +1,274 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minChunkSize is the smallest range fetched by one parallel request. Files
+// smaller than two chunks are downloaded in a single stream.
+const minChunkSize = 8 << 20
+
+// stateSaveInterval is how often chunk progress is written to the sidecar
+// state file during a parallel download.
+const stateSaveInterval = time.Second
+
+var (
+	// errNoRanges means the file will be fetched in a single stream, because
+	// the server does not support ranges or the file is too small to split.
+	errNoRanges = errors.New("range requests not supported")
+	// errRemoteChanged means the remote file changed mid-download.
+	errRemoteChanged = errors.New("remote file changed during download")
+)
+
+// chunk is one byte range of a parallel download.
+type chunk struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"` // inclusive
+	Done  int64 `json:"done"`
+}
+
+func (c chunk) size() int64 { return c.End - c.Start + 1 }
+
+// parallel downloads the file as concurrent ranges written into a
+// preallocated temp file, resuming chunks recorded in the state file. It
+// returns errNoRanges when a single-stream download should be used instead.
+func (d *download) parallel(conns int) error {
+	err := d.parallelOnce(conns)
+	if errors.Is(err, errRemoteChanged) {
+		d.reset()
+		err = d.parallelOnce(conns)
+	}
+	return err
+}
+
+func (d *download) parallelOnce(conns int) error {
+	remote := d.probe()
+	if remote == nil || remote.Size < 2*minChunkSize {
+		return errNoRanges
+	}
+
+	state := loadState(d.statePath)
+	if state == nil || state.URL != d.url || len(state.Chunks) == 0 ||
+		state.Size != remote.Size || state.validator() != remote.validator() {
+		state = remote
+		state.Chunks = splitChunks(remote.Size, conns)
+		os.Remove(d.tmpPath)
+	}
+
+	f, err := os.OpenFile(d.tmpPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(state.Size); err != nil {
+		return fmt.Errorf("preallocating %s: %w", d.label, err)
+	}
+	if err := saveState(d.statePath, state); err != nil {
+		return fmt.Errorf("saving download state: %w", err)
+	}
+
+	d.total = state.Size
+	p := &parallelRun{d: d, f: f, state: state}
+	if err := p.run(conns); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// probe requests the first byte of the file to learn its size and
+// validators. It returns nil if the server does not answer with a range.
+func (d *download) probe() *partState {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil
+	}
+	_, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	s := &partState{
+		URL:          d.url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Size:         total,
+	}
+	if !ok || s.validator() == "" {
+		return nil
+	}
+	return s
+}
+
+// splitChunks divides size bytes into ranges, several per connection so
+// fast connections pick up the slack of slow ones.
+func splitChunks(size int64, conns int) []chunk {
+	chunkSize := max(size/int64(conns*4), minChunkSize)
+	var chunks []chunk
+	for start := int64(0); start < size; start += chunkSize {
+		chunks = append(chunks, chunk{Start: start, End: min(start+chunkSize, size) - 1})
+	}
+	return chunks
+}
+
+// parallelRun tracks one parallel download attempt.
+type parallelRun struct {
+	d      *download
+	f      *os.File
+	mu     sync.Mutex // guards state.Chunks, done and report
+	state  *partState
+	done   int64
+	report func(int64)
+}
+
+func (p *parallelRun) run(conns int) error {
+	queue := make(chan int, len(p.state.Chunks))
+	for i, c := range p.state.Chunks {
+		p.done += c.Done
+		if c.Done < c.size() {
+			queue <- i
+		}
+	}
+	close(queue)
+	p.report = p.d.reporter(p.done)
+
+	ctx, cancel := context.WithCancel(p.d.ctx)
+	defer cancel()
+
+	stop := make(chan struct{})
+	go func() {
+		t := time.NewTicker(stateSaveInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				p.save()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for w := 0; w < min(conns, len(queue)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				err := p.d.retry(func() error { return p.fetch(ctx, i) })
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	p.save()
+	return firstErr
+}
+
+// fetch downloads the unfinished remainder of chunk i.
+func (p *parallelRun) fetch(ctx context.Context, i int) error {
+	if ctx.Err() != nil {
+		return &permanentError{ctx.Err()}
+	}
+	p.mu.Lock()
+	c := p.state.Chunks[i]
+	p.mu.Unlock()
+	start := c.Start + c.Done
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.d.url, nil)
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, c.End))
+	req.Header.Set("If-Range", p.state.validator())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return &permanentError{ctx.Err()}
+		}
+		return fmt.Errorf("requesting %s: %w", p.d.label, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// If-Range did not match: the file was replaced upstream.
+		return &permanentError{errRemoteChanged}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	case resp.StatusCode != http.StatusPartialContent:
+		return &permanentError{fmt.Errorf("HTTP %d", resp.StatusCode)}
+	}
+	if s, _, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || s != start {
+		return fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+	}
+
+	body := io.LimitReader(resp.Body, c.End-start+1)
+	w := io.NewOffsetWriter(p.f, start)
+	buf := make([]byte, 256<<10)
+	for {
+		n, rerr := body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return &permanentError{fmt.Errorf("writing %s: %w", p.d.label, err)}
+			}
+			downloadedBytes.Add(float64(n))
+			p.advance(i, int64(n))
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			if ctx.Err() != nil {
+				return &permanentError{ctx.Err()}
+			}
+			return fmt.Errorf("writing %s: %w", p.d.label, rerr)
+		}
+	}
+
+	p.mu.Lock()
+	complete := p.state.Chunks[i].Done == c.size()
+	p.mu.Unlock()
+	if !complete {
+		return fmt.Errorf("connection closed before the end of chunk %d", i)
+	}
+	return nil
+}
+
+// advance records n more bytes written to chunk i and updates progress.
+func (p *parallelRun) advance(i int, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Chunks[i].Done += n
+	p.done += n
+	p.report(p.done)
+}
+
+// save writes chunk progress to the state file. Bytes are always written to
+// the file before they are counted, so a crash can only lose progress.
+func (p *parallelRun) save() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	saveState(p.d.statePath, p.state)
+}
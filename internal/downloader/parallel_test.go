@@ -0,0 +1,163 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// largeContent returns a file big enough to be split into three chunks,
+// whose bytes depend on seed and on their offset.
+func largeContent(seed byte) []byte {
+	b := make([]byte, 2*minChunkSize+12345)
+	for i := range b {
+		b[i] = byte(i%251) + seed
+	}
+	return b
+}
+
+func fetchParallel(t *testing.T, url, dest string, want []byte) {
+	t.Helper()
+	_, err := Download(url, dest, "test", Options{Connections: 4, Progress: func(int64, int64) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes that differ from the %d served", len(got), len(want))
+	}
+	if _, err := os.Stat(dest + ".download.json"); !os.IsNotExist(err) {
+		t.Errorf("download state left behind")
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	size := int64(2*minChunkSize + 12345)
+	chunks := splitChunks(size, 4)
+	want := []chunk{
+		{Start: 0, End: minChunkSize - 1},
+		{Start: minChunkSize, End: 2*minChunkSize - 1},
+		{Start: 2 * minChunkSize, End: size - 1},
+	}
+	if !slices.Equal(chunks, want) {
+		t.Errorf("splitChunks = %+v, want %+v", chunks, want)
+	}
+
+	// Large files get several chunks per connection.
+	if n := len(splitChunks(64*minChunkSize, 2)); n != 8 {
+		t.Errorf("%d chunks for two connections, want 8", n)
+	}
+}
+
+func TestParallelDownload(t *testing.T) {
+	fs := &fileServer{content: largeContent(0), etag: `"v1"`}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	fetchParallel(t, srv.URL, dest, fs.content)
+
+	size := int64(len(fs.content))
+	want := []string{
+		"bytes=0-0", // probe
+		fmt.Sprintf("bytes=0-%d", minChunkSize-1),
+		fmt.Sprintf("bytes=%d-%d", minChunkSize, 2*minChunkSize-1),
+		fmt.Sprintf("bytes=%d-%d", 2*minChunkSize, size-1),
+	}
+	slices.Sort(fs.ranges)
+	slices.Sort(want)
+	if !slices.Equal(fs.ranges, want) {
+		t.Errorf("requested ranges %q, want %q", fs.ranges, want)
+	}
+}
+
+func TestParallelResumes(t *testing.T) {
+	fs := &fileServer{content: largeContent(0), etag: `"v1"`}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	// The first chunk was finished and the second half written before the
+	// download was interrupted.
+	size := int64(len(fs.content))
+	chunks := splitChunks(size, 4)
+	chunks[0].Done = chunks[0].size()
+	chunks[1].Done = 1000
+	tmp := make([]byte, size)
+	copy(tmp, fs.content[:minChunkSize+1000])
+	if err := os.WriteFile(dest+".download", tmp, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := saveState(dest+".download.json", &partState{URL: srv.URL, ETag: `"v1"`, Size: size, Chunks: chunks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchParallel(t, srv.URL, dest, fs.content)
+
+	want := []string{
+		"bytes=0-0",
+		fmt.Sprintf("bytes=%d-%d", minChunkSize+1000, 2*minChunkSize-1),
+		fmt.Sprintf("bytes=%d-%d", 2*minChunkSize, size-1),
+	}
+	slices.Sort(fs.ranges)
+	slices.Sort(want)
+	if !slices.Equal(fs.ranges, want) {
+		t.Errorf("requested ranges %q, want %q", fs.ranges, want)
+	}
+}
+
+// changingServer serves before until it has answered once, then after: the
+// file is replaced right after the download probes it.
+type changingServer struct {
+	before, after *fileServer
+
+	mu     sync.Mutex
+	served int
+	ranges []string
+}
+
+func (s *changingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	fs := s.after
+	if s.served == 0 {
+		fs = s.before
+	}
+	s.served++
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.mu.Unlock()
+	fs.ServeHTTP(w, r)
+}
+
+func TestParallelRestartsWhenFileChanged(t *testing.T) {
+	cs := &changingServer{
+		before: &fileServer{content: largeContent(0), etag: `"v1"`},
+		after:  &fileServer{content: largeContent(7), etag: `"v2"`},
+	}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+
+	// Every chunk request carries If-Range "v1" and gets the whole new file
+	// back; the download starts over once, from a fresh probe.
+	fetchParallel(t, srv.URL, dest, cs.after.content)
+
+	probes := 0
+	for _, r := range cs.ranges {
+		if r == "bytes=0-0" {
+			probes++
+		}
+	}
+	if probes != 2 {
+		t.Errorf("%d probes in %q, want 2: the first attempt and one restart", probes, cs.ranges)
+	}
+}
@@ -0,0 +1,377 @@
+// Package gguf reads GGUF model files: their header, key/value metadata and
+// tensor table. Tensor data is never read, so inspecting a model is cheap
+// regardless of its size.
+package gguf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// magic is "GGUF" read as a little-endian uint32.
+const magic = 0x46554747
+
+// Limits that keep a corrupt header from causing huge allocations.
+const (
+	maxStringLen = 64 << 20
+	maxEntries   = 1 << 20
+	maxDims      = 16
+)
+
+// ErrNotGGUF is returned for files that do not start with the GGUF magic.
+var ErrNotGGUF = errors.New("not a GGUF file")
+
+// Value types of metadata entries.
+const (
+	typeUint8 uint32 = iota
+	typeInt8
+	typeUint16
+	typeInt16
+	typeUint32
+	typeInt32
+	typeFloat32
+	typeBool
+	typeString
+	typeArray
+	typeUint64
+	typeInt64
+	typeFloat64
+)
+
+// Array is a metadata array. Only its length is kept; element values (e.g.
+// a tokenizer's vocabulary) are skipped.
+type Array struct {
+	Len int
+}
+
+// File is the parsed header of a GGUF file, or of every part of a split
+// model.
+type File struct {
+	Version     uint32
+	TensorCount uint64
+	// Params is the total number of weights, summed over the tensor table.
+	Params uint64
+	// Metadata holds scalar values as uint64, int64, float64, bool or
+	// string, and arrays as Array.
+	Metadata map[string]interface{}
+	// Keys lists metadata keys in file order.
+	Keys []string
+}
+
+// ReadModel reads the header of the model at path. For a split model, path
+// may name any part; metadata comes from the first part and tensor counts
+// are summed over all of them.
+func ReadModel(path string) (*File, error) {
+	path = FirstShard(path)
+	f, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := ParseShard(filepath.Base(path))
+	if !ok {
+		return f, nil
+	}
+	for i := 2; i <= s.Count; i++ {
+		part, err := ReadFile(filepath.Join(filepath.Dir(path), s.Name(i)))
+		if err != nil {
+			return nil, err
+		}
+		f.TensorCount += part.TensorCount
+		f.Params += part.Params
+	}
+	return f, nil
+}
+
+// ReadFile reads the header and tensor table of a single GGUF file.
+func ReadFile(path string) (*File, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	f, err := Read(bufio.NewReaderSize(fh, 1<<16))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return f, nil
+}
+
+// Read parses a GGUF header from r, stopping before the tensor data.
+func Read(r io.Reader) (*File, error) {
+	d := &decoder{r: r}
+	if d.u32() != magic {
+		return nil, ErrNotGGUF
+	}
+
+	f := &File{Version: d.u32(), Metadata: map[string]interface{}{}}
+	if d.err == nil && (f.Version < 1 || f.Version > 3) {
+		return nil, fmt.Errorf("unsupported GGUF version %d", f.Version)
+	}
+	// Version 1 used 32-bit counts and string lengths.
+	d.v1 = f.Version == 1
+
+	f.TensorCount = d.count()
+	kvCount := d.count()
+	if d.err == nil && (f.TensorCount > maxEntries || kvCount > maxEntries) {
+		return nil, errors.New("corrupt header: implausible entry count")
+	}
+
+	for i := uint64(0); i < kvCount && d.err == nil; i++ {
+		key := d.str()
+		v := d.value(d.u32())
+		if d.err == nil {
+			f.Keys = append(f.Keys, key)
+			f.Metadata[key] = v
+		}
+	}
+
+	for i := uint64(0); i < f.TensorCount && d.err == nil; i++ {
+		d.skipString() // name
+		dims := d.u32()
+		if dims > maxDims {
+			d.fail(errors.New("corrupt tensor table"))
+			break
+		}
+		n := uint64(1)
+		for j := uint32(0); j < dims; j++ {
+			n *= d.count()
+		}
+		d.u32() // type
+		d.u64() // offset
+		f.Params += n
+	}
+
+	if d.err != nil {
+		if errors.Is(d.err, io.EOF) || errors.Is(d.err, io.ErrUnexpectedEOF) {
+			return nil, errors.New("truncated header")
+		}
+		return nil, d.err
+	}
+	return f, nil
+}
+
+// String returns the string value of key, or "".
+func (f *File) String(key string) string {
+	s, _ := f.Metadata[key].(string)
+	return s
+}
+
+// Uint returns the integer value of key, or 0.
+func (f *File) Uint(key string) uint64 {
+	switch v := f.Metadata[key].(type) {
+	case uint64:
+		return v
+	case int64:
+		if v > 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
+
+// ArrayLen returns the length of the array value of key, or 0.
+func (f *File) ArrayLen(key string) int {
+	a, _ := f.Metadata[key].(Array)
+	return a.Len
+}
+
+// Architecture returns the model architecture, e.g. "llama".
+func (f *File) Architecture() string {
+	return f.String("general.architecture")
+}
+
+// Name returns the model's name as recorded by its converter.
+func (f *File) Name() string {
+	return f.String("general.name")
+}
+
+// ArchUint returns an architecture-specific integer such as
+// "context_length", looked up as "<arch>.<key>".
+func (f *File) ArchUint(key string) uint64 {
+	return f.Uint(f.Architecture() + "." + key)
+}
+
+// ContextLength returns the context length the model was trained with.
+func (f *File) ContextLength() int {
+	return int(f.ArchUint("context_length"))
+}
+
+// Tokenizer returns the tokenizer model, e.g. "llama" or "gpt2".
+func (f *File) Tokenizer() string {
+	return f.String("tokenizer.ggml.model")
+}
+
+// ChatTemplate returns the embedded Jinja chat template, if any.
+func (f *File) ChatTemplate() string {
+	return f.String("tokenizer.chat_template")
+}
+
+// FileType returns the quantization of the bulk of the weights, e.g.
+// "Q4_K_M", from general.file_type. It is "" when the key is absent.
+func (f *File) FileType() string {
+	if _, ok := f.Metadata["general.file_type"]; !ok {
+		return ""
+	}
+	n := f.Uint("general.file_type")
+	if name, ok := fileTypes[n]; ok {
+		return name
+	}
+	return "type " + strconv.FormatUint(n, 10)
+}
+
+// fileTypes names llama.cpp's llama_ftype values.
+var fileTypes = map[uint64]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 7: "Q8_0", 8: "Q5_0", 9: "Q5_1",
+	10: "Q2_K", 11: "Q3_K_S", 12: "Q3_K_M", 13: "Q3_K_L", 14: "Q4_K_S",
+	15: "Q4_K_M", 16: "Q5_K_S", 17: "Q5_K_M", 18: "Q6_K", 19: "IQ2_XXS",
+	20: "IQ2_XS", 21: "Q2_K_S", 22: "IQ3_XS", 23: "IQ3_XXS", 24: "IQ1_S",
+	25: "IQ4_NL", 26: "IQ3_S", 27: "IQ3_M", 28: "IQ2_S", 29: "IQ2_M",
+	30: "IQ4_XS", 31: "IQ1_M", 32: "BF16", 36: "TQ1_0", 37: "TQ2_0",
+}
+
+// decoder reads little-endian GGUF primitives, remembering the first error.
+type decoder struct {
+	r   io.Reader
+	v1  bool
+	err error
+	buf [8]byte
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return d.buf[:n]
+	}
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		d.fail(err)
+	}
+	return d.buf[:n]
+}
+
+func (d *decoder) u8() uint8   { return d.read(1)[0] }
+func (d *decoder) u16() uint16 { return binary.LittleEndian.Uint16(d.read(2)) }
+func (d *decoder) u32() uint32 { return binary.LittleEndian.Uint32(d.read(4)) }
+func (d *decoder) u64() uint64 { return binary.LittleEndian.Uint64(d.read(8)) }
+
+// count reads a count, length or tensor dimension, which are 32-bit in
+// version 1 files.
+func (d *decoder) count() uint64 {
+	if d.v1 {
+		return uint64(d.u32())
+	}
+	return d.u64()
+}
+
+func (d *decoder) str() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	if n > maxStringLen {
+		d.fail(errors.New("corrupt header: implausible string length"))
+		return ""
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.fail(err)
+		return ""
+	}
+	return string(b)
+}
+
+func (d *decoder) skipString() {
+	d.skip(d.count())
+}
+
+func (d *decoder) skip(n uint64) {
+	if d.err != nil {
+		return
+	}
+	if _, err := io.CopyN(io.Discard, d.r, int64(n)); err != nil {
+		d.fail(err)
+	}
+}
+
+// value reads one metadata value of type t.
+func (d *decoder) value(t uint32) interface{} {
+	switch t {
+	case typeUint8:
+		return uint64(d.u8())
+	case typeInt8:
+		return int64(int8(d.u8()))
+	case typeUint16:
+		return uint64(d.u16())
+	case typeInt16:
+		return int64(int16(d.u16()))
+	case typeUint32:
+		return uint64(d.u32())
+	case typeInt32:
+		return int64(int32(d.u32()))
+	case typeUint64:
+		return d.u64()
+	case typeInt64:
+		return int64(d.u64())
+	case typeFloat32:
+		return float64(math.Float32frombits(d.u32()))
+	case typeFloat64:
+		return math.Float64frombits(d.u64())
+	case typeBool:
+		return d.u8() != 0
+	case typeString:
+		return d.str()
+	case typeArray:
+		elem := d.u32()
+		n := d.count()
+		d.skipArray(elem, n)
+		return Array{Len: int(n)}
+	}
+	d.fail(fmt.Errorf("corrupt header: unknown value type %d", t))
+	return nil
+}
+
+// skipArray discards n elements of type elem.
+func (d *decoder) skipArray(elem uint32, n uint64) {
+	if size := scalarSize(elem); size > 0 {
+		d.skip(n * size)
+		return
+	}
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		switch elem {
+		case typeString:
+			d.skipString()
+		case typeArray:
+			inner := d.u32()
+			d.skipArray(inner, d.count())
+		default:
+			d.fail(fmt.Errorf("corrupt header: unknown value type %d", elem))
+		}
+	}
+}
+
+// scalarSize returns the encoded size of a fixed-size type, or 0.
+func scalarSize(t uint32) uint64 {
+	switch t {
+	case typeUint8, typeInt8, typeBool:
+		return 1
+	case typeUint16, typeInt16:
+		return 2
+	case typeUint32, typeInt32, typeFloat32:
+		return 4
+	case typeUint64, typeInt64, typeFloat64:
+		return 8
+	}
+	return 0
+}
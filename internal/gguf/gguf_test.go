@@ -0,0 +1,188 @@
+package gguf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// header builds a GGUF header in memory.
+type header struct {
+	buf bytes.Buffer
+	v1  bool
+}
+
+func newHeader(version uint32, tensors, kvs uint64) *header {
+	h := &header{v1: version == 1}
+	h.u32(magic)
+	h.u32(version)
+	h.count(tensors)
+	h.count(kvs)
+	return h
+}
+
+func (h *header) u32(v uint32) { binary.Write(&h.buf, binary.LittleEndian, v) }
+func (h *header) u64(v uint64) { binary.Write(&h.buf, binary.LittleEndian, v) }
+
+func (h *header) count(n uint64) {
+	if h.v1 {
+		h.u32(uint32(n))
+	} else {
+		h.u64(n)
+	}
+}
+
+func (h *header) str(s string) {
+	h.count(uint64(len(s)))
+	h.buf.WriteString(s)
+}
+
+func (h *header) kv(key string, t uint32, write func()) {
+	h.str(key)
+	h.u32(t)
+	write()
+}
+
+func (h *header) tensor(name string, dims ...uint64) {
+	h.str(name)
+	h.u32(uint32(len(dims)))
+	for _, d := range dims {
+		h.count(d)
+	}
+	h.u32(0) // type
+	h.u64(0) // offset
+}
+
+// model writes the header of a small llama model.
+func model(tensors ...[]uint64) *header {
+	h := newHeader(3, uint64(len(tensors)), 7)
+	h.kv("general.architecture", typeString, func() { h.str("llama") })
+	h.kv("general.name", typeString, func() { h.str("Tiny") })
+	h.kv("llama.context_length", typeUint32, func() { h.u32(4096) })
+	h.kv("llama.rope.freq_base", typeFloat32, func() { h.u32(math.Float32bits(10000)) })
+	h.kv("general.file_type", typeUint32, func() { h.u32(15) })
+	h.kv("tokenizer.ggml.tokens", typeArray, func() {
+		h.u32(typeString)
+		h.u64(3)
+		h.str("<s>")
+		h.str("</s>")
+		h.str("a")
+	})
+	h.kv("tokenizer.ggml.scores", typeArray, func() {
+		h.u32(typeFloat32)
+		h.u64(3)
+		h.buf.Write(make([]byte, 12))
+	})
+	for i, dims := range tensors {
+		h.tensor(fmt.Sprintf("blk.%d.weight", i), dims...)
+	}
+	h.buf.Write(make([]byte, 32)) // tensor data, never read
+	return h
+}
+
+func TestRead(t *testing.T) {
+	f, err := Read(&model([]uint64{2048, 1000}, []uint64{2048}).buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != 3 || f.TensorCount != 2 || f.Params != 2048*1000+2048 {
+		t.Errorf("version %d, %d tensors, %d params; want 3, 2, %d", f.Version, f.TensorCount, f.Params, 2048*1000+2048)
+	}
+	if got := strings.Join(f.Keys, " "); !strings.HasPrefix(got, "general.architecture general.name llama.context_length") {
+		t.Errorf("keys out of file order: %s", got)
+	}
+	if f.Architecture() != "llama" || f.Name() != "Tiny" {
+		t.Errorf("architecture %q, name %q", f.Architecture(), f.Name())
+	}
+	if f.ContextLength() != 4096 {
+		t.Errorf("context length %d, want 4096", f.ContextLength())
+	}
+	if v, _ := f.Metadata["llama.rope.freq_base"].(float64); v != 10000 {
+		t.Errorf("rope.freq_base = %v, want 10000", f.Metadata["llama.rope.freq_base"])
+	}
+	if f.FileType() != "Q4_K_M" {
+		t.Errorf("file type %q, want Q4_K_M", f.FileType())
+	}
+	if f.ArrayLen("tokenizer.ggml.tokens") != 3 || f.ArrayLen("tokenizer.ggml.scores") != 3 {
+		t.Errorf("array lengths %d and %d, want 3", f.ArrayLen("tokenizer.ggml.tokens"), f.ArrayLen("tokenizer.ggml.scores"))
+	}
+	if f.ChatTemplate() != "" || f.Uint("general.name") != 0 {
+		t.Errorf("missing or mistyped keys should read as zero values")
+	}
+}
+
+func TestReadVersion1(t *testing.T) {
+	h := newHeader(1, 1, 2)
+	h.kv("general.architecture", typeString, func() { h.str("llama") })
+	h.kv("llama.context_length", typeInt32, func() { h.u32(2048) })
+	h.tensor("w", 10, 20)
+
+	f, err := Read(&h.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ContextLength() != 2048 || f.Params != 200 {
+		t.Errorf("context length %d, %d params; want 2048, 200", f.ContextLength(), f.Params)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	full := model([]uint64{16, 16}).buf.Bytes()
+	badType := newHeader(3, 0, 1)
+	badType.kv("k", 99, func() {})
+	bigString := newHeader(3, 0, 1)
+	bigString.u64(maxStringLen + 1)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"magic", []byte("GGML0000"), ErrNotGGUF.Error()},
+		{"version", newHeader(4, 0, 0).buf.Bytes(), "unsupported GGUF version 4"},
+		{"counts", newHeader(3, maxEntries+1, 0).buf.Bytes(), "implausible entry count"},
+		{"truncated metadata", full[:60], "truncated header"},
+		{"truncated tensors", full[:len(full)-40], "truncated header"},
+		{"value type", badType.buf.Bytes(), "unknown value type 99"},
+		{"string length", bigString.buf.Bytes(), "implausible string length"},
+	}
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := Read(strings.NewReader("GGML")); !errors.Is(err, ErrNotGGUF) {
+		t.Errorf("wrong magic: got %v, want ErrNotGGUF", err)
+	}
+}
+
+func TestReadModelSplit(t *testing.T) {
+	dir := t.TempDir()
+	for i, dims := range [][]uint64{{100}, {200}, {300}} {
+		s := Shard{Prefix: "m", Index: i + 1, Count: 3}
+		h := model(dims)
+		if err := os.WriteFile(filepath.Join(dir, s.Name(i+1)), h.buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := ReadModel(filepath.Join(dir, "m-00002-of-00003.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.TensorCount != 3 || f.Params != 600 {
+		t.Errorf("%d tensors, %d params; want 3, 600", f.TensorCount, f.Params)
+	}
+
+	os.Remove(filepath.Join(dir, "m-00003-of-00003.gguf"))
+	if _, err := ReadModel(filepath.Join(dir, "m-00001-of-00003.gguf")); err == nil {
+		t.Errorf("ReadModel with a part missing succeeded")
+	}
+}
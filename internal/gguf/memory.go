@@ -0,0 +1,77 @@
+package gguf
+
+// computeOverhead approximates llama.cpp's scratch buffers and runtime,
+// which do not depend much on model size.
+const computeOverhead = 256 << 20
+
+// MemoryEstimate is the RAM a model needs once loaded, in bytes.
+type MemoryEstimate struct {
+	Weights  int64
+	KVCache  int64
+	Overhead int64
+}
+
+// Total returns the summed estimate.
+func (e MemoryEstimate) Total() int64 {
+	return e.Weights + e.KVCache + e.Overhead
+}
+
+// EstimateMemory estimates the RAM needed to run the model with a context
+// window of ctx tokens. weightBytes is the size of the model files, which
+// llama.cpp maps into memory as-is.
+func (f *File) EstimateMemory(weightBytes int64, ctx int) MemoryEstimate {
+	return MemoryEstimate{
+		Weights:  weightBytes,
+		KVCache:  f.KVCacheBytes(ctx),
+		Overhead: computeOverhead,
+	}
+}
+
+// KVCacheBytes returns the size of llama.cpp's default f16 key/value cache
+// for ctx tokens. Models using grouped-query attention store fewer KV heads
+// than attention heads, which shrinks the cache accordingly.
+func (f *File) KVCacheBytes(ctx int) int64 {
+	layers := f.ArchUint("block_count")
+	embd := f.ArchUint("embedding_length")
+	heads := f.ArchUint("attention.head_count")
+	if layers == 0 || embd == 0 || heads == 0 || ctx <= 0 {
+		return 0
+	}
+	kvHeads := f.ArchUint("attention.head_count_kv")
+	if kvHeads == 0 {
+		kvHeads = heads
+	}
+	keyLen := f.ArchUint("attention.key_length")
+	if keyLen == 0 {
+		keyLen = embd / heads
+	}
+	valueLen := f.ArchUint("attention.value_length")
+	if valueLen == 0 {
+		valueLen = embd / heads
+	}
+	const f16 = 2
+	perToken := layers * kvHeads * (keyLen + valueLen) * f16
+	return int64(perToken) * int64(ctx)
+}
+
+// minAutoContext is the smallest window FitContext shrinks a model to.
+const minAutoContext = 2048
+
+// FitContext returns the context length the model was trained with, reduced
+// if necessary so that its estimate stays within 90% of available bytes of
+// memory. It returns 0 if the header does not record a context length, and
+// never goes below minAutoContext (or the trained length, if smaller); a
+// model that does not fit even then is left to the caller's memory check.
+func (f *File) FitContext(weightBytes, available int64) int {
+	trained := f.ContextLength()
+	perToken := f.KVCacheBytes(1)
+	if trained <= 0 || available <= 0 || perToken == 0 {
+		return trained
+	}
+	spare := available*9/10 - weightBytes - computeOverhead
+	if fit := spare / perToken; fit < int64(trained) {
+		// Round down to a multiple of 256 tokens.
+		return max(int(fit)&^255, min(minAutoContext, trained))
+	}
+	return trained
+}
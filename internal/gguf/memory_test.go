@@ -0,0 +1,86 @@
+package gguf
+
+import "testing"
+
+// llama returns the header of a llama model with TinyLlama's shape, with kv
+// overriding or adding keys ("" values remove them).
+func llama(kv map[string]interface{}) *File {
+	f := &File{Metadata: map[string]interface{}{
+		"general.architecture":          "llama",
+		"llama.context_length":          uint64(2048),
+		"llama.block_count":             uint64(22),
+		"llama.embedding_length":        uint64(2048),
+		"llama.attention.head_count":    uint64(32),
+		"llama.attention.head_count_kv": uint64(4),
+	}}
+	for k, v := range kv {
+		if v == "" {
+			delete(f.Metadata, k)
+		} else {
+			f.Metadata[k] = v
+		}
+	}
+	return f
+}
+
+func TestKVCacheBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		f    *File
+		ctx  int
+		want int64
+	}{
+		// 22 layers × 4 KV heads × (64 + 64) × 2 bytes per token.
+		{"grouped-query attention", llama(nil), 2048, 22 * 4 * 128 * 2 * 2048},
+		{"one KV head per head", llama(map[string]interface{}{"llama.attention.head_count_kv": ""}), 2048, 22 * 32 * 128 * 2 * 2048},
+		{"explicit key and value lengths", llama(map[string]interface{}{
+			"llama.attention.key_length":   uint64(128),
+			"llama.attention.value_length": uint64(96),
+		}), 100, 22 * 4 * 224 * 2 * 100},
+		{"unknown shape", llama(map[string]interface{}{"llama.block_count": ""}), 2048, 0},
+		{"no context", llama(nil), 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.f.KVCacheBytes(tt.ctx); got != tt.want {
+			t.Errorf("%s: KVCacheBytes(%d) = %d, want %d", tt.name, tt.ctx, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	est := llama(nil).EstimateMemory(600<<20, 2048)
+	want := MemoryEstimate{Weights: 600 << 20, KVCache: 44 << 20, Overhead: computeOverhead}
+	if est != want {
+		t.Errorf("EstimateMemory = %+v, want %+v", est, want)
+	}
+	if est.Total() != 600<<20+44<<20+computeOverhead {
+		t.Errorf("Total = %d", est.Total())
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	const weights = 100 << 20
+	perToken := int64(22 * 4 * 128 * 2)
+	long := llama(map[string]interface{}{"llama.context_length": uint64(32768)})
+	// Leaves room for 5000 tokens within 90% of the memory available.
+	room := (5000*perToken+weights+computeOverhead)*10/9 + 1
+
+	tests := []struct {
+		name      string
+		f         *File
+		available int64
+		want      int
+	}{
+		{"fits", long, 64 << 30, 32768},
+		{"memory unknown", long, 0, 32768},
+		{"shrunk to a multiple of 256", long, room, 4864},
+		{"never below the minimum", long, 1 << 20, minAutoContext},
+		{"short trained context kept", llama(map[string]interface{}{"llama.context_length": uint64(1024)}), 1 << 20, 1024},
+		{"no trained context", llama(map[string]interface{}{"llama.context_length": ""}), 64 << 30, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.f.FitContext(weights, tt.available); got != tt.want {
+			t.Errorf("%s: FitContext = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
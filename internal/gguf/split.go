@@ -0,0 +1,50 @@
+package gguf
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// shardPattern matches the part names written by llama.cpp's gguf-split,
+// e.g. "mixtral-8x7b.Q8_0-00001-of-00003.gguf".
+var shardPattern = regexp.MustCompile(`^(.+)-(\d{5})-of-(\d{5})\.gguf$`)
+
+// Shard identifies one part of a split model.
+type Shard struct {
+	Prefix string // filename without the "-0000i-of-0000N.gguf" suffix
+	Index  int    // 1-based
+	Count  int
+}
+
+// ParseShard reports whether filename (a base name or path) is a part of a
+// split model, and which one.
+func ParseShard(filename string) (Shard, bool) {
+	m := shardPattern.FindStringSubmatch(filename)
+	if m == nil {
+		return Shard{}, false
+	}
+	index, _ := strconv.Atoi(m[2])
+	count, _ := strconv.Atoi(m[3])
+	if index < 1 || count < 1 || index > count {
+		return Shard{}, false
+	}
+	return Shard{Prefix: m[1], Index: index, Count: count}, true
+}
+
+// Name returns the filename of part i (1-based) of the split model.
+func (s Shard) Name(i int) string {
+	return fmt.Sprintf("%s-%05d-of-%05d.gguf", s.Prefix, i, s.Count)
+}
+
+// FirstShard returns the path of the first part if path is a shard of a
+// split model, and path unchanged otherwise. llama.cpp loads split models
+// from their first part.
+func FirstShard(path string) string {
+	s, ok := ParseShard(filepath.Base(path))
+	if !ok || s.Index == 1 {
+		return path
+	}
+	return filepath.Join(filepath.Dir(path), s.Name(1))
+}
@@ -0,0 +1,54 @@
+package gguf
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	tests := []struct {
+		name string
+		want Shard
+		ok   bool
+	}{
+		{"mixtral-8x7b.Q8_0-00001-of-00003.gguf", Shard{"mixtral-8x7b.Q8_0", 1, 3}, true},
+		{"mixtral-8x7b.Q8_0-00003-of-00003.gguf", Shard{"mixtral-8x7b.Q8_0", 3, 3}, true},
+		{"a-b-00002-of-00010.gguf", Shard{"a-b", 2, 10}, true},
+		{"mixtral-8x7b.Q8_0.gguf", Shard{}, false},
+		{"model-00004-of-00003.gguf", Shard{}, false},
+		{"model-00000-of-00003.gguf", Shard{}, false},
+		{"model-0001-of-0003.gguf", Shard{}, false},
+		{"model-00001-of-00003.bin", Shard{}, false},
+		{"-00001-of-00003.gguf", Shard{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseShard(tt.name)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseShard(%q) = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestShardName(t *testing.T) {
+	s := Shard{Prefix: "llama.Q4_K_M", Index: 2, Count: 12}
+	if got, want := s.Name(7), "llama.Q4_K_M-00007-of-00012.gguf"; got != want {
+		t.Errorf("Name(7) = %q, want %q", got, want)
+	}
+	if got, ok := ParseShard(s.Name(12)); !ok || got.Index != 12 || got.Prefix != s.Prefix {
+		t.Errorf("ParseShard(Name(12)) = %+v, %v", got, ok)
+	}
+}
+
+func TestFirstShard(t *testing.T) {
+	dir := filepath.Join("models", "repo")
+	tests := []struct{ path, want string }{
+		{filepath.Join(dir, "m-00002-of-00003.gguf"), filepath.Join(dir, "m-00001-of-00003.gguf")},
+		{filepath.Join(dir, "m-00001-of-00003.gguf"), filepath.Join(dir, "m-00001-of-00003.gguf")},
+		{filepath.Join(dir, "m.Q4_0.gguf"), filepath.Join(dir, "m.Q4_0.gguf")},
+	}
+	for _, tt := range tests {
+		if got := FirstShard(tt.path); got != tt.want {
+			t.Errorf("FirstShard(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
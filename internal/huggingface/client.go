@@ -6,8 +6,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"sort"
 	"strings"
+
+	"github.com/llmgw/llmgw/internal/gguf"
 )
 
 const (
@@ -31,8 +34,39 @@ type ModelInfo struct {
 
 // FileInfo describes one file in a model repo.
 type FileInfo struct {
-	Filename string `json:"rfilename"`
-	Size     int64  `json:"size"`
+	Filename string   `json:"rfilename"`
+	Size     int64    `json:"size"`
+	LFS      *LFSInfo `json:"lfs,omitempty"`
+}
+
+// LFSInfo is the Git LFS metadata of a large file.
+type LFSInfo struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// SHA256 returns the file's hex SHA-256 digest, or "" if it is not stored in LFS.
+func (f *FileInfo) SHA256() string {
+	if f.LFS == nil {
+		return ""
+	}
+	return f.LFS.SHA256
+}
+
+// GGUFModel is one downloadable model variant: a single .gguf file, or all
+// parts of a split model ("name-00001-of-00003.gguf", ...).
+type GGUFModel struct {
+	// Filename is the file, or the first part, to pass to llama.cpp.
+	Filename string
+	// Files lists every file of the variant, in part order.
+	Files []FileInfo
+	// Size is the total size of Files.
+	Size int64
+}
+
+// Sharded reports whether the model is split into several files.
+func (m *GGUFModel) Sharded() bool {
+	return len(m.Files) > 1
 }
 
 // SearchResult is one item from a model search.
@@ -48,9 +82,10 @@ func NewClient(token string) *Client {
 	return &Client{http: &http.Client{}, token: token}
 }
 
-// GetModelInfo fetches metadata for the given repo (e.g. "TheBloke/TinyLlama-1.1B-Chat-v1.0-GGUF").
+// GetModelInfo fetches metadata for the given repo (e.g. "TheBloke/TinyLlama-1.1B-Chat-v1.0-GGUF"),
+// including file sizes and LFS checksums.
 func (c *Client) GetModelInfo(repoID string) (*ModelInfo, error) {
-	u := fmt.Sprintf("%s/models/%s", apiURL, repoID)
+	u := fmt.Sprintf("%s/models/%s?blobs=true", apiURL, repoID)
 	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
 		return nil, err
@@ -77,20 +112,53 @@ func (c *Client) GetModelInfo(repoID string) (*ModelInfo, error) {
 	return &info, nil
 }
 
-// FindGGUFFiles returns all .gguf files in the model repo.
-func (c *Client) FindGGUFFiles(info *ModelInfo) []FileInfo {
-	var out []FileInfo
+// FindGGUFFiles returns the GGUF model variants in the repo. The parts of a
+// split model are grouped into one variant; groups with missing parts are
+// skipped.
+func (c *Client) FindGGUFFiles(info *ModelInfo) []GGUFModel {
+	var out []GGUFModel
+	groups := make(map[string]map[int]FileInfo)
+	counts := make(map[string]int)
+	var order []string
+
 	for _, f := range info.Siblings {
-		if strings.HasSuffix(strings.ToLower(f.Filename), ".gguf") {
-			out = append(out, f)
+		if !strings.HasSuffix(strings.ToLower(f.Filename), ".gguf") {
+			continue
 		}
+		s, ok := gguf.ParseShard(path.Base(f.Filename))
+		if !ok {
+			out = append(out, GGUFModel{Filename: f.Filename, Files: []FileInfo{f}, Size: f.Size})
+			continue
+		}
+		key := path.Join(path.Dir(f.Filename), s.Prefix)
+		if groups[key] == nil {
+			groups[key] = make(map[int]FileInfo)
+			counts[key] = s.Count
+			order = append(order, key)
+		}
+		groups[key][s.Index] = f
+	}
+
+	for _, key := range order {
+		parts := groups[key]
+		if len(parts) != counts[key] {
+			continue
+		}
+		m := GGUFModel{Filename: parts[1].Filename}
+		for i := 1; i <= counts[key]; i++ {
+			m.Files = append(m.Files, parts[i])
+			m.Size += parts[i].Size
+		}
+		out = append(out, m)
 	}
 	return out
 }
 
-// SelectBestGGUF picks the best quantization from available GGUF files.
+// SelectBestGGUF picks the best quantization from available GGUF models.
 // Preferred order: Q4_K_M > Q4_K_S > Q5_K_M > Q5_K_S > Q4_0 > Q8_0 > smallest.
-func (c *Client) SelectBestGGUF(files []FileInfo, preferred string) *FileInfo {
+// When maxSize is positive and no preference is given, the largest model of
+// at most maxSize bytes is picked instead, if any is that small.
+func (c *Client) SelectBestGGUF(files []GGUFModel, preferred string, maxSize int64) *GGUFModel {
 	if len(files) == 0 {
 		return nil
 	}
@@ -102,6 +170,16 @@ func (c *Client) SelectBestGGUF(files []FileInfo, preferred string) *FileInfo {
 				return &files[i]
 			}
 		}
+	} else if maxSize > 0 {
+		var best *GGUFModel
+		for i := range files {
+			if files[i].Size > 0 && files[i].Size <= maxSize && (best == nil || files[i].Size > best.Size) {
+				best = &files[i]
+			}
+		}
+		if best != nil {
+			return best
+		}
 	}
 
 	// Priority-based selection
@@ -114,7 +192,7 @@ func (c *Client) SelectBestGGUF(files []FileInfo, preferred string) *FileInfo {
 		}
 	}
 
-	// Fallback: pick the smallest file
+	// Fallback: pick the smallest model
 	sort.Slice(files, func(i, j int) bool { return files[i].Size < files[j].Size })
 	return &files[0]
 }
@@ -0,0 +1,304 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Default is the registry used by the package-level constructors.
+var Default = NewRegistry()
+
+// collector is anything that can render itself in exposition format.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds a set of metrics and renders them in the Prometheus text
+// exposition format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register adds c, replacing any existing metric with the same name.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.collectors {
+		if r.collectors[i].name() == c.name() {
+			r.collectors[i] = c
+			return
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText renders every metric in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	cs := make([]collector, len(r.collectors))
+	copy(cs, r.collectors)
+	r.mu.Unlock()
+
+	sort.Slice(cs, func(i, j int) bool { return cs[i].name() < cs[j].name() })
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// Handler serves the default registry. The metrics are rendered before any
+// of them is sent, so that a slow scraper does not hold their locks and
+// stall the requests updating them.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	Default.WriteText(&buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// ------- counters and gauges -------
+
+// Vec is a counter or gauge partitioned by label values.
+type Vec struct {
+	kind   string
+	n      string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter registers a counter in the default registry.
+func NewCounter(name, help string, labels ...string) *Vec {
+	return newVec("counter", name, help, labels)
+}
+
+// NewGauge registers a gauge in the default registry.
+func NewGauge(name, help string, labels ...string) *Vec {
+	return newVec("gauge", name, help, labels)
+}
+
+func newVec(kind, name, help string, labels []string) *Vec {
+	v := &Vec{kind: kind, n: name, help: help, labels: labels, values: make(map[string]float64)}
+	if len(labels) == 0 {
+		// Unlabelled metrics are always exported, starting at zero.
+		v.values[""] = 0
+	}
+	Default.register(v)
+	return v
+}
+
+// Inc adds one to the series with the given label values.
+func (v *Vec) Inc(labelValues ...string) { v.Add(1, labelValues...) }
+
+// Dec subtracts one from the series with the given label values.
+func (v *Vec) Dec(labelValues ...string) { v.Add(-1, labelValues...) }
+
+// Add adds delta to the series with the given label values.
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	k := labelKey(v.labels, labelValues)
+	v.mu.Lock()
+	v.values[k] += delta
+	v.mu.Unlock()
+}
+
+// Set sets the series with the given label values.
+func (v *Vec) Set(val float64, labelValues ...string) {
+	k := labelKey(v.labels, labelValues)
+	v.mu.Lock()
+	v.values[k] = val
+	v.mu.Unlock()
+}
+
+func (v *Vec) name() string { return v.n }
+
+func (v *Vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	writeHeader(w, v.n, v.help, v.kind)
+	for _, k := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", v.n, k, formatFloat(v.values[k]))
+	}
+}
+
+// Sample is one labelled value reported by a function metric.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// funcMetric is a counter or gauge whose samples are computed at scrape time.
+type funcMetric struct {
+	kind   string
+	n      string
+	help   string
+	labels []string
+	fn     func() []Sample
+}
+
+// NewGaugeFunc registers a gauge computed by fn on every scrape.
+func NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	Default.register(&funcMetric{kind: "gauge", n: name, help: help, labels: labels, fn: fn})
+}
+
+// NewCounterFunc registers a counter computed by fn on every scrape.
+func NewCounterFunc(name, help string, labels []string, fn func() []Sample) {
+	Default.register(&funcMetric{kind: "counter", n: name, help: help, labels: labels, fn: fn})
+}
+
+func (g *funcMetric) name() string { return g.n }
+
+func (g *funcMetric) write(w io.Writer) {
+	writeHeader(w, g.n, g.help, g.kind)
+	for _, s := range g.fn() {
+		fmt.Fprintf(w, "%s%s %s\n", g.n, labelKey(g.labels, s.LabelValues), formatFloat(s.Value))
+	}
+}
+
+// ------- histograms -------
+
+// Histogram counts observations into cumulative buckets, by label values.
+type Histogram struct {
+	n       string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histSeries
+}
+
+type histSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram in the default registry.
+// If buckets is nil, DefaultBuckets is used.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{n: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histSeries)}
+	Default.register(h)
+	return h
+}
+
+// Observe records one value in the series with the given label values.
+func (h *Histogram) Observe(val float64, labelValues ...string) {
+	k := labelKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[k]
+	if !ok {
+		s = &histSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	for i, b := range h.buckets {
+		if val <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += val
+	s.count++
+}
+
+func (h *Histogram) name() string { return h.n }
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.n, h.help, "histogram")
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := h.series[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.n, withLabel(k, "le", formatFloat(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.n, withLabel(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.n, k, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.n, k, s.count)
+	}
+}
+
+// ------- formatting helpers -------
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// labelKey renders label pairs as `{a="x",b="y"}`; it doubles as the series key.
+func labelKey(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escape(v))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLabel appends one more label pair to a rendered label set.
+func withLabel(key, name, value string) string {
+	pair := name + `="` + value + `"`
+	if key == "" {
+		return "{" + pair + "}"
+	}
+	return key[:len(key)-1] + "," + pair + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVecText(t *testing.T) {
+	v := NewCounter("test_requests_total", "Requests served.", "model", "status")
+	v.Inc("m1", "200")
+	v.Inc("m1", "200")
+	v.Add(3, "m2", "500")
+	v.Inc(`quo"te`, "200")
+
+	var buf bytes.Buffer
+	v.write(&buf)
+	want := `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{model="m1",status="200"} 2
+test_requests_total{model="m2",status="500"} 3
+test_requests_total{model="quo\"te",status="200"} 1
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	g := NewGauge("test_loaded", "Models loaded.")
+	buf.Reset()
+	g.write(&buf)
+	if !strings.HasSuffix(buf.String(), "\ntest_loaded 0\n") {
+		t.Errorf("unlabelled gauge not exported at zero:\n%s", buf.String())
+	}
+}
+
+func TestHistogramText(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Request duration.", []float64{0.1, 1, 10}, "model")
+	for _, v := range []float64{0.05, 0.5, 0.5, 5, 50} {
+		h.Observe(v, "m1")
+	}
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	want := `# HELP test_duration_seconds Request duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{model="m1",le="0.1"} 1
+test_duration_seconds_bucket{model="m1",le="1"} 3
+test_duration_seconds_bucket{model="m1",le="10"} 4
+test_duration_seconds_bucket{model="m1",le="+Inf"} 5
+test_duration_seconds_sum{model="m1"} 56.05
+test_duration_seconds_count{model="m1"} 5
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	NewCounterFunc("test_func_total", "Computed at scrape time.", []string{"model"}, func() []Sample {
+		return []Sample{{LabelValues: []string{"m1"}, Value: 7}}
+	})
+
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "\ntest_func_total{model=\"m1\"} 7\n") {
+		t.Errorf("function metric missing:\n%s", w.Body.String())
+	}
+}
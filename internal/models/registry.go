@@ -1,13 +1,19 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/downloader"
+	"github.com/llmgw/llmgw/internal/gguf"
+	"github.com/llmgw/llmgw/internal/huggingface"
 )
 
 // Built-in short-name aliases for popular GGUF model repos.
@@ -30,14 +36,110 @@ var Aliases = map[string]string{
 	"gemma":       "google/gemma-2b-it-GGUF",
 }
 
-// Entry represents a locally cached model.
+// registryVersion is the current models.json format. Version 1 was a bare
+// array holding at most one entry per repo.
+const registryVersion = 2
+
+// Entry represents one locally cached model file. A repo may have several
+// entries, one per downloaded quantization.
 type Entry struct {
 	ID         string    `json:"id"`
 	RepoID     string    `json:"repo_id"`
 	Filename   string    `json:"filename"`
 	FilePath   string    `json:"file_path"`
 	SizeBytes  int64     `json:"size_bytes"`
+	SHA256     string    `json:"sha256,omitempty"`
 	Downloaded time.Time `json:"downloaded"`
+
+	// Parts lists every file of a split model, first part first; FilePath
+	// is the first part and SizeBytes their total. It is empty for
+	// single-file models.
+	Parts []Part `json:"parts,omitempty"`
+
+	// Read from the GGUF header; see Inspect.
+	Arch          string `json:"arch,omitempty"`
+	Quantization  string `json:"quantization,omitempty"`
+	ContextLength int    `json:"context_length,omitempty"`
+	Params        uint64 `json:"params,omitempty"`
+}
+
+// Part is one file of a cached model.
+type Part struct {
+	Filename  string `json:"filename"`
+	FilePath  string `json:"file_path"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256,omitempty"`
+}
+
+// Files returns every file of the model: its parts, or the single file.
+func (e *Entry) Files() []Part {
+	if len(e.Parts) > 0 {
+		return e.Parts
+	}
+	return []Part{{Filename: e.Filename, FilePath: e.FilePath, SizeBytes: e.SizeBytes, SHA256: e.SHA256}}
+}
+
+// Complete reports whether every file of the model is on disk.
+func (e *Entry) Complete() bool {
+	for _, p := range e.Files() {
+		if _, err := os.Stat(p.FilePath); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Inspect reads the model's GGUF header and records its architecture,
+// quantization, trained context length and parameter count on e.
+func (e *Entry) Inspect() (*gguf.File, error) {
+	f, err := gguf.ReadModel(e.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	e.Arch = f.Architecture()
+	e.Quantization = f.FileType()
+	e.ContextLength = f.ContextLength()
+	e.Params = f.Params
+	return f, nil
+}
+
+// Quant returns the entry's quantization label, e.g. "Q4_K_M": the one
+// recorded in its header, or else the one in its filename.
+func (e *Entry) Quant() string {
+	if e.Quantization != "" {
+		return e.Quantization
+	}
+	return QuantFromFilename(e.Filename)
+}
+
+// IsQuant reports whether the entry's file is of quantization quant. The
+// match is case-insensitive on the filename, so "Q4_K" matches Q4_K_M too.
+func (e *Entry) IsQuant(quant string) bool {
+	return strings.Contains(strings.ToLower(e.Filename), strings.ToLower(quant)) ||
+		strings.EqualFold(e.Quantization, quant)
+}
+
+// hasQuant reports whether the entry's file is of exactly quantization
+// quant, going by its header or its filename.
+func (e *Entry) hasQuant(quant string) bool {
+	return strings.EqualFold(e.Quant(), quant) || strings.EqualFold(QuantFromFilename(e.Filename), quant)
+}
+
+// QuantFromFilename extracts the quantization label, e.g. "Q4_K_M", from a
+// GGUF filename, or returns "".
+func QuantFromFilename(name string) string {
+	name = filepath.Base(name)
+	if s, ok := gguf.ParseShard(name); ok {
+		name = s.Prefix + ".gguf"
+	}
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if i := strings.LastIndexAny(base, ".-"); i >= 0 {
+		q := strings.ToUpper(base[i+1:])
+		if strings.HasPrefix(q, "Q") || strings.HasPrefix(q, "F") || strings.HasPrefix(q, "IQ") || strings.HasPrefix(q, "BF") {
+			return q
+		}
+	}
+	return ""
 }
 
 // Registry manages the local model cache.
@@ -47,6 +149,12 @@ type Registry struct {
 	entries []Entry
 }
 
+// registryFile is the on-disk format of models.json.
+type registryFile struct {
+	Version int     `json:"version"`
+	Models  []Entry `json:"models"`
+}
+
 // NewRegistry initialises the registry and loads existing entries.
 func NewRegistry(cfg *config.Config) *Registry {
 	r := &Registry{
@@ -66,21 +174,49 @@ func ResolveAlias(name string) string {
 	return name
 }
 
-// Find returns a cached entry by repo ID, or nil.
-func (r *Registry) Find(repoID string) *Entry {
+// SplitRef splits a model reference of the form "repo:quant" into its repo
+// (with aliases resolved) and quantization. The quant is "" if absent.
+func SplitRef(ref string) (repoID, quant string) {
+	repo, quant, _ := strings.Cut(ref, ":")
+	return ResolveAlias(repo), quant
+}
+
+// Find returns a cached entry for repoID, or nil. When quant is set, only a
+// file of that quantization matches; otherwise the most recently downloaded
+// variant is returned.
+func (r *Registry) Find(repoID, quant string) *Entry {
+	var best *Entry
 	for i := range r.entries {
-		if r.entries[i].RepoID == repoID {
-			return &r.entries[i]
+		e := &r.entries[i]
+		if e.RepoID != repoID {
+			continue
+		}
+		if quant != "" && !e.IsQuant(quant) {
+			continue
+		}
+		if best == nil || e.Downloaded.After(best.Downloaded) {
+			best = e
+		}
+	}
+	return best
+}
+
+// Variants returns every cached file of repoID.
+func (r *Registry) Variants(repoID string) []Entry {
+	var out []Entry
+	for _, e := range r.entries {
+		if e.RepoID == repoID {
+			out = append(out, e)
 		}
 	}
-	return nil
+	return out
 }
 
-// Add registers a newly downloaded model.
+// Add registers a newly downloaded model file, replacing any entry for the
+// same repo and filename.
 func (r *Registry) Add(e Entry) error {
-	// Replace if exists
 	for i := range r.entries {
-		if r.entries[i].RepoID == e.RepoID {
+		if r.entries[i].RepoID == e.RepoID && r.entries[i].Filename == e.Filename {
 			r.entries[i] = e
 			return r.save()
 		}
@@ -94,23 +230,47 @@ func (r *Registry) List() []Entry {
 	return r.entries
 }
 
-// Remove deletes a cached model by ID or repo ID.
-func (r *Registry) Remove(id string) error {
-	for i := range r.entries {
-		if r.entries[i].ID == id || r.entries[i].RepoID == id {
-			// Delete model file
-			if r.entries[i].FilePath != "" {
-				os.Remove(r.entries[i].FilePath)
-			}
-			// Delete model directory (best effort)
-			dir := filepath.Dir(r.entries[i].FilePath)
-			os.Remove(dir)
+// Remove deletes cached model files by ID or by "repo" or "repo:quant"
+// reference. A bare repo removes every variant; a quant must name one
+// exactly, unlike in Find, so that "Q4_K" does not delete Q4_K_M and
+// Q4_K_S alike. It returns the removed entries.
+func (r *Registry) Remove(ref string) ([]Entry, error) {
+	repoID, quant := SplitRef(ref)
 
-			r.entries = append(r.entries[:i], r.entries[i+1:]...)
-			return r.save()
+	var removed, kept []Entry
+	var have []string
+	for _, e := range r.entries {
+		match := e.ID == ref || (e.RepoID == repoID && (quant == "" || e.hasQuant(quant)))
+		if match {
+			removed = append(removed, e)
+		} else {
+			kept = append(kept, e)
+		}
+		if e.RepoID == repoID {
+			have = append(have, e.Quant())
+		}
+	}
+	if len(removed) == 0 {
+		if quant != "" && len(have) > 0 {
+			return nil, fmt.Errorf("no %s variant of %s is cached (have: %s)", quant, repoID, strings.Join(have, ", "))
+		}
+		return nil, fmt.Errorf("model %q not found", ref)
+	}
+
+	for _, e := range removed {
+		for _, p := range e.Files() {
+			if p.FilePath == "" {
+				continue
+			}
+			os.Remove(p.FilePath)
+			// Delete model directories once their last file is gone (best effort)
+			for dir := filepath.Dir(p.FilePath); dir != r.cfg.ModelsDir && os.Remove(dir) == nil; {
+				dir = filepath.Dir(dir)
+			}
 		}
 	}
-	return fmt.Errorf("model %q not found", id)
+	r.entries = kept
+	return removed, r.save()
 }
 
 func (r *Registry) load() {
@@ -118,11 +278,114 @@ func (r *Registry) load() {
 	if err != nil {
 		return
 	}
-	json.Unmarshal(data, &r.entries)
+
+	var f registryFile
+	if json.Unmarshal(data, &f) == nil && f.Version >= registryVersion {
+		r.entries = f.Models
+		return
+	}
+
+	// Version 1: a bare array with one entry per repo.
+	if json.Unmarshal(data, &r.entries) != nil {
+		return
+	}
+	r.migrate()
+}
+
+// migrate upgrades a version 1 registry. Re-downloading a repo in another
+// quantization used to replace its entry and leave the old file behind, so
+// those orphaned files are registered again.
+func (r *Registry) migrate() {
+	for _, e := range append([]Entry(nil), r.entries...) {
+		files, _ := filepath.Glob(filepath.Join(filepath.Dir(e.FilePath), "*.gguf"))
+		sort.Strings(files)
+		for _, path := range files {
+			name := filepath.Base(path)
+			if _, shard := gguf.ParseShard(name); shard || r.hasFile(e.RepoID, name) {
+				// Split models were never downloaded whole before version 2.
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			r.entries = append(r.entries, Entry{
+				ID:         e.RepoID + "/" + name,
+				RepoID:     e.RepoID,
+				Filename:   name,
+				FilePath:   path,
+				SizeBytes:  info.Size(),
+				Downloaded: info.ModTime(),
+			})
+		}
+	}
+	r.save()
+}
+
+// Download fetches every file of model m from repoID on HuggingFace into
+// the model cache and registers it. Progress goes to progress, or to a
+// terminal progress bar when it is nil. Cancelling ctx stops the download.
+func (r *Registry) Download(ctx context.Context, hf *huggingface.Client, repoID string, m *huggingface.GGUFModel, progress downloader.ProgressFunc) (*Entry, error) {
+	dir := r.cfg.ModelDir(repoID)
+	files := make([]downloader.File, len(m.Files))
+	for i, f := range m.Files {
+		files[i] = downloader.File{
+			URL:    hf.DownloadURL(repoID, f.Filename),
+			Path:   filepath.Join(dir, filepath.FromSlash(f.Filename)),
+			Label:  filepath.Base(f.Filename),
+			Size:   f.Size,
+			SHA256: f.SHA256(),
+		}
+	}
+
+	sums, err := downloader.DownloadGroup(ctx, files, filepath.Base(m.Filename), progress)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]Part, len(files))
+	for i, f := range files {
+		sum := sums[i]
+		if sum == "" {
+			// Already on disk, so not re-hashed; record the published checksum.
+			sum = f.SHA256
+		}
+		parts[i] = Part{Filename: m.Files[i].Filename, FilePath: f.Path, SizeBytes: f.Size, SHA256: sum}
+	}
+
+	e := Entry{
+		ID:         repoID + "/" + m.Filename,
+		RepoID:     repoID,
+		Filename:   m.Filename,
+		FilePath:   parts[0].FilePath,
+		SizeBytes:  m.Size,
+		Downloaded: time.Now(),
+	}
+	if m.Sharded() {
+		e.Parts = parts
+	} else {
+		e.SHA256 = parts[0].SHA256
+	}
+	// Metadata is informational; a header we cannot parse is left to
+	// llama.cpp to report.
+	e.Inspect()
+	if err := r.Add(e); err != nil {
+		return nil, fmt.Errorf("registering model: %w", err)
+	}
+	return &e, nil
+}
+
+func (r *Registry) hasFile(repoID, filename string) bool {
+	for _, e := range r.entries {
+		if e.RepoID == repoID && e.Filename == filename {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *Registry) save() error {
-	data, err := json.MarshalIndent(r.entries, "", "  ")
+	data, err := json.MarshalIndent(registryFile{Version: registryVersion, Models: r.entries}, "", "  ")
 	if err != nil {
 		return err
 	}
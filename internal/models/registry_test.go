@@ -0,0 +1,181 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	home := t.TempDir()
+	return &config.Config{HomeDir: home, ModelsDir: filepath.Join(home, "models")}
+}
+
+// cache writes a placeholder file for each filename of repo and registers it.
+func cache(t *testing.T, r *Registry, repo string, filenames ...string) {
+	t.Helper()
+	for _, name := range filenames {
+		path := filepath.Join(r.cfg.ModelDir(repo), name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("gguf"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := r.Add(Entry{ID: repo + "/" + name, RepoID: repo, Filename: name, FilePath: path, SizeBytes: 4, Downloaded: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func filenames(entries []Entry) string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Filename)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func TestRemoveQuantExact(t *testing.T) {
+	r := NewRegistry(testConfig(t))
+	cache(t, r, "org/m", "m.Q4_K_M.gguf", "m.Q4_K_S.gguf", "m.F16.gguf", "m.BF16.gguf")
+
+	for _, ref := range []string{"org/m:Q4_K", "org/m:F1", "org/m:Q8_0"} {
+		if removed, err := r.Remove(ref); err == nil {
+			t.Errorf("Remove(%s) removed %s, want an error", ref, filenames(removed))
+		}
+	}
+	if got := filenames(r.Variants("org/m")); got != "m.BF16.gguf m.F16.gguf m.Q4_K_M.gguf m.Q4_K_S.gguf" {
+		t.Fatalf("variants after failed removals: %s", got)
+	}
+
+	removed, err := r.Remove("org/m:f16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filenames(removed); got != "m.F16.gguf" {
+		t.Errorf("Remove(org/m:f16) removed %s, want only m.F16.gguf", got)
+	}
+	if _, err := os.Stat(removed[0].FilePath); !os.IsNotExist(err) {
+		t.Errorf("removed file still on disk")
+	}
+	if _, err := os.Stat(r.Find("org/m", "BF16").FilePath); err != nil {
+		t.Errorf("BF16 file deleted along with F16: %v", err)
+	}
+
+	removed, err = r.Remove("org/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 3 || len(r.List()) != 0 {
+		t.Errorf("bare repo removed %d entries and left %d, want 3 and 0", len(removed), len(r.List()))
+	}
+	if _, err := os.Stat(r.cfg.ModelDir("org/m")); !os.IsNotExist(err) {
+		t.Errorf("empty model directory left behind")
+	}
+}
+
+func TestFindQuantLoose(t *testing.T) {
+	r := NewRegistry(testConfig(t))
+	cache(t, r, "org/m", "m.Q4_K_M.gguf")
+	if e := r.Find("org/m", "q4_k"); e == nil || e.Filename != "m.Q4_K_M.gguf" {
+		t.Errorf("Find(org/m, q4_k) = %v, want m.Q4_K_M.gguf", e)
+	}
+	if e := r.Find("org/m", "Q8_0"); e != nil {
+		t.Errorf("Find(org/m, Q8_0) = %s, want nil", e.Filename)
+	}
+}
+
+func TestMigrateVersion1(t *testing.T) {
+	cfg := testConfig(t)
+	dir := cfg.ModelDir("org/m")
+	os.MkdirAll(dir, 0755)
+	for _, name := range []string{"m.Q4_K_M.gguf", "m.Q8_0.gguf", "big-00001-of-00002.gguf", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("gguf"), 0644)
+	}
+	// Version 1 kept one entry per repo: the Q8_0 download replaced the
+	// Q4_K_M entry and orphaned its file.
+	v1 := []Entry{{ID: "org/m/m.Q8_0.gguf", RepoID: "org/m", Filename: "m.Q8_0.gguf",
+		FilePath: filepath.Join(dir, "m.Q8_0.gguf"), SizeBytes: 4}}
+	data, _ := json.Marshal(v1)
+	os.WriteFile(filepath.Join(cfg.HomeDir, "models.json"), data, 0644)
+
+	r := NewRegistry(cfg)
+	if got := filenames(r.Variants("org/m")); got != "m.Q4_K_M.gguf m.Q8_0.gguf" {
+		t.Errorf("variants after migration: %s, want m.Q4_K_M.gguf m.Q8_0.gguf", got)
+	}
+	if e := r.Find("org/m", "Q4_K_M"); e == nil || e.SizeBytes != 4 || e.ID != "org/m/m.Q4_K_M.gguf" {
+		t.Errorf("orphaned file registered as %+v", e)
+	}
+
+	var f registryFile
+	data, _ = os.ReadFile(filepath.Join(cfg.HomeDir, "models.json"))
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != registryVersion || len(f.Models) != 2 {
+		t.Errorf("models.json not rewritten as version %d: %s", registryVersion, data)
+	}
+
+	// A version 2 file is read as it is.
+	if got := filenames(NewRegistry(cfg).List()); got != "m.Q4_K_M.gguf m.Q8_0.gguf" {
+		t.Errorf("reloaded: %s", got)
+	}
+}
+
+func TestQuantFromFilename(t *testing.T) {
+	for name, want := range map[string]string{
+		"tinyllama-1.1b-chat-v1.0.Q4_K_M.gguf":          "Q4_K_M",
+		"Llama-3-70B-Instruct-IQ2_XS.gguf":              "IQ2_XS",
+		"model.f16.gguf":                                "F16",
+		"Qwen2-72B.Q8_0-00002-of-00003.gguf":            "Q8_0",
+		"sub/dir/Mixtral-8x7B.BF16-00001-of-00004.gguf": "BF16",
+		"model.gguf": "",
+	} {
+		if got := QuantFromFilename(name); got != want {
+			t.Errorf("QuantFromFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSplitModel(t *testing.T) {
+	r := NewRegistry(testConfig(t))
+	repo := "org/big-GGUF"
+	dir := r.cfg.ModelDir(repo)
+	os.MkdirAll(dir, 0755)
+	var parts []Part
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("big.Q8_0-%05d-of-00003.gguf", i)
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("gguf"), 0644)
+		parts = append(parts, Part{Filename: name, FilePath: path, SizeBytes: 4})
+	}
+	e := Entry{ID: repo + "/" + parts[0].Filename, RepoID: repo, Filename: parts[0].Filename,
+		FilePath: parts[0].FilePath, SizeBytes: 12, Parts: parts}
+	if err := r.Add(e); err != nil {
+		t.Fatal(err)
+	}
+
+	found := r.Find(repo, "Q8_0")
+	if found == nil || found.Quant() != "Q8_0" || len(found.Files()) != 3 || !found.Complete() {
+		t.Fatalf("Find = %+v, want the complete three-part Q8_0 entry", found)
+	}
+	os.Remove(parts[1].FilePath)
+	if found.Complete() {
+		t.Errorf("Complete with a part missing")
+	}
+
+	if _, err := r.Remove(repo + ":Q8_0"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range parts {
+		if _, err := os.Stat(p.FilePath); !os.IsNotExist(err) {
+			t.Errorf("%s left after Remove", p.Filename)
+		}
+	}
+}
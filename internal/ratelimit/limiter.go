@@ -0,0 +1,221 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+// flushInterval is how often changed token usage is written to usage.json.
+const flushInterval = 5 * time.Second
+
+// Limiter enforces per-client requests-per-minute and tokens-per-day limits.
+// Usage is persisted to usage.json so quotas survive a restart. Writes are
+// batched: the file is rewritten every flushInterval when usage has changed,
+// and by Close.
+type Limiter struct {
+	path    string
+	mu      sync.Mutex
+	clients map[string]*usage
+	dirty   bool // usage changed since the last save
+
+	done    chan struct{}
+	flushed chan struct{} // closed when the flush loop has returned
+	once    sync.Once
+}
+
+// usage is the persisted counter state for one client.
+type usage struct {
+	MinuteStart time.Time `json:"minute_start"`
+	Requests    int       `json:"requests"`
+	Day         string    `json:"day"`
+	Tokens      int       `json:"tokens"`
+}
+
+// Decision is the outcome of a limit check, with the values needed for the
+// x-ratelimit-* response headers. Zero limits mean "unlimited".
+type Decision struct {
+	Allowed bool
+	// Exceeded names the limit that was hit: "requests" or "tokens".
+	Exceeded string
+
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration
+
+	LimitTokens     int
+	RemainingTokens int
+	ResetTokens     time.Duration
+}
+
+// RetryAfter returns how long the client should wait before retrying.
+func (d Decision) RetryAfter() time.Duration {
+	if d.Exceeded == "tokens" {
+		return d.ResetTokens
+	}
+	return d.ResetRequests
+}
+
+// New creates a limiter, loads persisted usage and starts saving it in the
+// background. Close must be called to save the last of it.
+func New(cfg *config.Config) *Limiter {
+	l := &Limiter{
+		path:    filepath.Join(cfg.HomeDir, "usage.json"),
+		clients: make(map[string]*usage),
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	l.load()
+	go l.flushLoop()
+	return l
+}
+
+// Close stops the background saves and writes any usage not yet saved.
+func (l *Limiter) Close() error {
+	l.once.Do(func() { close(l.done) })
+	<-l.flushed
+	return l.flush()
+}
+
+// Allow checks client against the given limits and, if allowed, counts the
+// request. A limit of zero disables that check.
+func (l *Limiter) Allow(client string, rpm, tpd int) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	u := l.current(client, now)
+
+	d := Decision{
+		Allowed:       true,
+		LimitRequests: rpm,
+		LimitTokens:   tpd,
+		ResetRequests: u.MinuteStart.Add(time.Minute).Sub(now),
+		ResetTokens:   nextDay(now).Sub(now),
+	}
+
+	if rpm > 0 && u.Requests >= rpm {
+		d.Allowed, d.Exceeded = false, "requests"
+	} else if tpd > 0 && u.Tokens >= tpd {
+		d.Allowed, d.Exceeded = false, "tokens"
+	}
+	if d.Allowed {
+		u.Requests++
+	}
+
+	d.RemainingRequests = max(rpm-u.Requests, 0)
+	d.RemainingTokens = max(tpd-u.Tokens, 0)
+	return d
+}
+
+// AddTokens records tokens consumed by client. The new total is saved by the
+// next flush.
+func (l *Limiter) AddTokens(client string, n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u := l.current(client, time.Now())
+	u.Tokens += n
+	l.dirty = true
+}
+
+// ------- internal helpers -------
+
+// current returns client's counters, rolling over expired windows.
+// Must be called with l.mu held.
+func (l *Limiter) current(client string, now time.Time) *usage {
+	u, ok := l.clients[client]
+	if !ok {
+		u = &usage{}
+		l.clients[client] = u
+	}
+	if now.Sub(u.MinuteStart) >= time.Minute {
+		u.MinuteStart = now.Truncate(time.Minute)
+		u.Requests = 0
+	}
+	if day := now.Format("2006-01-02"); u.Day != day {
+		u.Day = day
+		u.Tokens = 0
+	}
+	return u
+}
+
+func nextDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+}
+
+func (l *Limiter) load() {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &l.clients)
+	if l.clients == nil {
+		l.clients = make(map[string]*usage)
+	}
+}
+
+func (l *Limiter) flushLoop() {
+	defer close(l.flushed)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.flush()
+		}
+	}
+}
+
+// flush writes usage.json if usage has changed since the last write,
+// dropping clients with no usage today. The file is written outside l.mu so
+// that requests are not held up by the disk; only the flush loop, and Close
+// once it has returned, call flush.
+func (l *Limiter) flush() error {
+	l.mu.Lock()
+	if !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+	today := time.Now().Format("2006-01-02")
+	for k, u := range l.clients {
+		if u.Day != today {
+			delete(l.clients, k)
+		}
+	}
+	data, err := json.MarshalIndent(l.clients, "", "  ")
+	l.dirty = false
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := l.write(data); err != nil {
+		l.mu.Lock()
+		l.dirty = true // try again at the next flush
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write replaces usage.json with data, through a temporary file so that a
+// crash never leaves a partial one.
+func (l *Limiter) write(data []byte) error {
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/llmgw/llmgw/internal/config"
+)
+
+func newLimiter(t *testing.T) (*Limiter, *config.Config) {
+	t.Helper()
+	cfg := &config.Config{HomeDir: t.TempDir()}
+	l := New(cfg)
+	t.Cleanup(func() { l.Close() })
+	return l, cfg
+}
+
+func TestAllowRequests(t *testing.T) {
+	l, _ := newLimiter(t)
+
+	for i := 1; i <= 3; i++ {
+		d := l.Allow("a", 3, 0)
+		if !d.Allowed || d.RemainingRequests != 3-i {
+			t.Fatalf("request %d: allowed %v, %d remaining", i, d.Allowed, d.RemainingRequests)
+		}
+	}
+	d := l.Allow("a", 3, 0)
+	if d.Allowed || d.Exceeded != "requests" || d.RemainingRequests != 0 {
+		t.Fatalf("request 4: allowed %v, exceeded %q, %d remaining", d.Allowed, d.Exceeded, d.RemainingRequests)
+	}
+	if d.RetryAfter() <= 0 || d.RetryAfter() > time.Minute {
+		t.Errorf("RetryAfter = %v, want within the minute", d.RetryAfter())
+	}
+	if d := l.Allow("b", 3, 0); !d.Allowed {
+		t.Errorf("client b was limited by client a's requests")
+	}
+
+	// A new minute starts the count again.
+	l.mu.Lock()
+	l.clients["a"].MinuteStart = time.Now().Add(-time.Minute)
+	l.mu.Unlock()
+	if d := l.Allow("a", 3, 0); !d.Allowed || d.RemainingRequests != 2 {
+		t.Errorf("after a minute: allowed %v, %d remaining", d.Allowed, d.RemainingRequests)
+	}
+}
+
+func TestAllowTokens(t *testing.T) {
+	l, _ := newLimiter(t)
+
+	if d := l.Allow("a", 0, 100); !d.Allowed || d.RemainingTokens != 100 {
+		t.Fatalf("first request: allowed %v, %d tokens remaining", d.Allowed, d.RemainingTokens)
+	}
+	l.AddTokens("a", 60)
+	if d := l.Allow("a", 0, 100); !d.Allowed || d.RemainingTokens != 40 {
+		t.Fatalf("after 60 tokens: allowed %v, %d tokens remaining", d.Allowed, d.RemainingTokens)
+	}
+	l.AddTokens("a", 60)
+	d := l.Allow("a", 0, 100)
+	if d.Allowed || d.Exceeded != "tokens" || d.RemainingTokens != 0 {
+		t.Fatalf("after 120 tokens: allowed %v, exceeded %q, %d remaining", d.Allowed, d.Exceeded, d.RemainingTokens)
+	}
+	if d.RetryAfter() != d.ResetTokens || d.ResetTokens > 24*time.Hour {
+		t.Errorf("RetryAfter = %v, ResetTokens = %v", d.RetryAfter(), d.ResetTokens)
+	}
+
+	// A new day resets the tokens.
+	l.mu.Lock()
+	l.clients["a"].Day = "2000-01-01"
+	l.mu.Unlock()
+	if d := l.Allow("a", 0, 100); !d.Allowed || d.RemainingTokens != 100 {
+		t.Errorf("next day: allowed %v, %d tokens remaining", d.Allowed, d.RemainingTokens)
+	}
+}
+
+func TestUsagePersisted(t *testing.T) {
+	l, cfg := newLimiter(t)
+	l.Allow("a", 0, 100)
+	l.AddTokens("a", 70)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l2 := New(cfg)
+	defer l2.Close()
+	if d := l2.Allow("a", 0, 100); d.RemainingTokens != 30 {
+		t.Errorf("after a restart: %d tokens remaining, want 30", d.RemainingTokens)
+	}
+}
+
+func TestFlushOnlyWhenChanged(t *testing.T) {
+	l, _ := newLimiter(t)
+	l.Allow("a", 10, 0)
+	if err := l.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if l.dirty {
+		t.Errorf("dirty after flush")
+	}
+	l.AddTokens("a", 0)
+	if l.dirty {
+		t.Errorf("dirty after adding no tokens")
+	}
+	l.AddTokens("a", 5)
+	if !l.dirty {
+		t.Errorf("not dirty after adding tokens")
+	}
+}
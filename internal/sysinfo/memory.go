@@ -0,0 +1,73 @@
+// Package sysinfo reports facts about the host the gateway runs on.
+package sysinfo
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported is returned where memory figures are unavailable, i.e. on
+// systems without /proc/meminfo.
+var ErrUnsupported = errors.New("memory information is not available on this system")
+
+// Memory describes system RAM in bytes.
+type Memory struct {
+	Total int64
+	// Available is what can be allocated without swapping, including
+	// reclaimable page cache.
+	Available int64
+}
+
+// ReadMemory reads the current memory figures from /proc/meminfo.
+func ReadMemory() (Memory, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Memory{}, ErrUnsupported
+		}
+		return Memory{}, err
+	}
+	defer f.Close()
+
+	var m Memory
+	var free, cached, buffers int64
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// Lines look like "MemAvailable:   12345678 kB".
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		n <<= 10
+		switch strings.TrimSuffix(fields[0], ":") {
+		case "MemTotal":
+			m.Total = n
+		case "MemAvailable":
+			m.Available = n
+		case "MemFree":
+			free = n
+		case "Cached":
+			cached = n
+		case "Buffers":
+			buffers = n
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Memory{}, err
+	}
+	if m.Total == 0 {
+		return Memory{}, ErrUnsupported
+	}
+	if m.Available == 0 {
+		// Kernels before 3.14 do not report MemAvailable.
+		m.Available = free + cached + buffers
+	}
+	return m, nil
+}
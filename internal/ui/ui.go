@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 // ANSI color codes
@@ -57,19 +58,42 @@ func Detail(format string, args ...interface{}) {
 	fmt.Printf("      %s%s%s\n", Dim, fmt.Sprintf(format, args...), Reset)
 }
 
+// ServedModel is a model listed in the ready banner.
+type ServedModel struct {
+	Name    string
+	Context int // context window in tokens
+}
+
 // ServerReady prints the ready banner with endpoint info.
-func ServerReady(port int, model string) {
+func ServerReady(port int, models ...ServedModel) {
 	fmt.Println()
 	fmt.Printf("%s%s╔══════════════════════════════════════════════╗%s\n", Bold, Green, Reset)
 	fmt.Printf("%s%s║         🚀 LLM Gateway is READY!             ║%s\n", Bold, Green, Reset)
 	fmt.Printf("%s%s╚══════════════════════════════════════════════╝%s\n", Bold, Green, Reset)
 	fmt.Println()
-	fmt.Printf("  %sModel:%s  %s\n", Bold, Reset, model)
+	model := ""
+	if len(models) > 0 {
+		model = models[0].Name
+	}
+	if len(models) > 1 {
+		fmt.Printf("  %sModels:%s\n", Bold, Reset)
+		for _, m := range models {
+			fmt.Printf("    • %s %s(%d-token context)%s\n", m.Name, Dim, m.Context, Reset)
+		}
+	} else {
+		fmt.Printf("  %sModel:%s  %s\n", Bold, Reset, model)
+		if len(models) == 1 {
+			fmt.Printf("  %sContext:%s %d tokens\n", Bold, Reset, models[0].Context)
+		}
+	}
 	fmt.Printf("  %sAPI:%s    http://localhost:%d/v1\n", Bold, Reset, port)
 	fmt.Println()
 	fmt.Printf("  %sEndpoints:%s\n", Bold, Reset)
 	fmt.Printf("    %sPOST%s /v1/chat/completions\n", Cyan, Reset)
 	fmt.Printf("    %sPOST%s /v1/completions\n", Cyan, Reset)
+	fmt.Printf("    %sPOST%s /v1/embeddings\n", Cyan, Reset)
+	fmt.Printf("    %sPOST%s /v1/messages  (Anthropic)\n", Cyan, Reset)
+	fmt.Printf("    %sPOST%s /api/chat     (Ollama)\n", Cyan, Reset)
 	fmt.Printf("    %sGET %s /v1/models\n", Cyan, Reset)
 	fmt.Printf("    %sGET %s /health\n", Cyan, Reset)
 	fmt.Println()
@@ -82,17 +106,47 @@ func ServerReady(port int, model string) {
 	fmt.Println()
 }
 
+// Prompt prints an input prompt, leaving the cursor on the same line.
+func Prompt(s string) {
+	fmt.Printf("%s%s%s%s ", Bold, Green, s, Reset)
+}
+
+// ChatStats prints the statistics line shown after a chat reply.
+// firstToken is the time until the first token arrived and elapsed the
+// time for the whole reply.
+func ChatStats(promptTokens, completionTokens int, firstToken, elapsed time.Duration) {
+	parts := []string{fmt.Sprintf("%d tokens", completionTokens)}
+	if gen := (elapsed - firstToken).Seconds(); completionTokens > 1 && gen > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f tokens/s", float64(completionTokens-1)/gen))
+	}
+	parts = append(parts, fmt.Sprintf("%.2fs to first token", firstToken.Seconds()))
+	if promptTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d prompt tokens", promptTokens))
+	}
+	fmt.Printf("%s  %s%s\n", Dim, strings.Join(parts, " · "), Reset)
+}
+
 // ProgressBar is a simple terminal progress bar.
 type ProgressBar struct {
 	total   int64
 	current int64
 	width   int
 	label   string
+	base    int64 // bytes already present when the bar started
+	started time.Time
 }
 
 // NewProgressBar creates a progress bar.
 func NewProgressBar(total int64, label string) *ProgressBar {
-	return &ProgressBar{total: total, width: 40, label: label}
+	return &ProgressBar{total: total, width: 40, label: label, started: time.Now()}
+}
+
+// Resume starts the bar at offset bytes, e.g. for a resumed download.
+// Bytes before offset are not counted in the transfer rate.
+func (p *ProgressBar) Resume(offset int64) {
+	p.base = offset
+	p.started = time.Now()
+	p.Update(offset)
 }
 
 // Update redraws the progress bar.
@@ -109,9 +163,18 @@ func (p *ProgressBar) Update(current int64) {
 	}
 	bar := strings.Repeat("█", filled) + strings.Repeat("░", p.width-filled)
 	sz := FormatBytes(current) + "/" + FormatBytes(p.total)
+	if elapsed := time.Since(p.started).Seconds(); elapsed >= 1 && current > p.base {
+		sz += "  " + FormatBytes(int64(float64(current-p.base)/elapsed)) + "/s"
+	}
 	fmt.Fprintf(os.Stderr, "\r  %s %s[%s%s%s]%s %.1f%% %s  ", p.label, Reset, Cyan, bar, Reset, Reset, pct, sz)
 }
 
+// Interrupt ends the current line so messages can be printed below the bar.
+// The next Update redraws it.
+func (p *ProgressBar) Interrupt() {
+	fmt.Fprintln(os.Stderr)
+}
+
 // Finish completes the progress bar.
 func (p *ProgressBar) Finish() {
 	if p.total > 0 {
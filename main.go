@@ -1,21 +1,36 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/llmgw/llmgw/internal/api"
+	"github.com/llmgw/llmgw/internal/auth"
 	"github.com/llmgw/llmgw/internal/backend"
+	"github.com/llmgw/llmgw/internal/chat"
 	"github.com/llmgw/llmgw/internal/config"
+	"github.com/llmgw/llmgw/internal/daemon"
 	"github.com/llmgw/llmgw/internal/downloader"
+	"github.com/llmgw/llmgw/internal/gguf"
 	"github.com/llmgw/llmgw/internal/huggingface"
 	"github.com/llmgw/llmgw/internal/models"
+	"github.com/llmgw/llmgw/internal/sysinfo"
 	"github.com/llmgw/llmgw/internal/ui"
 )
 
@@ -28,14 +43,36 @@ func main() {
 	switch os.Args[1] {
 	case "run":
 		cmdRun(os.Args[2:])
+	case "serve":
+		cmdServe(os.Args[2:])
+	case "chat":
+		cmdChat(os.Args[2:])
+	case "ps":
+		cmdPs()
+	case "status":
+		cmdStatus()
+	case "stop":
+		cmdStop(os.Args[2:])
 	case "search":
 		cmdSearch(os.Args[2:])
 	case "list":
 		cmdList()
 	case "remove":
 		cmdRemove(os.Args[2:])
+	case "show":
+		cmdShow(os.Args[2:])
+	case "verify":
+		cmdVerify(os.Args[2:])
+	case "logs":
+		cmdLogs(os.Args[2:])
 	case "aliases":
 		cmdAliases()
+	case "keys":
+		cmdKeys(os.Args[2:])
+	case "backend":
+		cmdBackend(os.Args[2:])
+	case "config":
+		cmdConfig(os.Args[2:])
 	case "version":
 		fmt.Printf("llmgw %s\n", config.Version)
 	case "help", "--help", "-h":
@@ -51,11 +88,11 @@ func main() {
 
 func cmdRun(args []string) {
 	fs := flag.NewFlagSet("run", flag.ExitOnError)
-	port := fs.Int("port", config.DefaultPort, "API port")
-	ctx := fs.Int("context", config.DefaultCtx, "Context window size")
-	quant := fs.String("quant", "", "Preferred quantization (e.g. Q4_K_M)")
-	verbose := fs.Bool("verbose", false, "Show backend output")
-	token := fs.String("token", os.Getenv("HF_TOKEN"), "HuggingFace token")
+	fs.String("quant", "", "Preferred quantization (e.g. Q4_K_M)")
+	fs.String("token", "", "HuggingFace token (default: $HF_TOKEN)")
+	fit := fs.Bool("fit", false, "Download the largest quantization that fits in available memory")
+	force := fs.Bool("force", false, "Start even if the model looks too large for available memory")
+	gatewayFlags(fs)
 	fs.Parse(args)
 
 	if fs.NArg() < 1 {
@@ -68,40 +105,98 @@ func cmdRun(args []string) {
 	modelArg := fs.Arg(0)
 
 	// Setup
-	cfg := config.New()
-	cfg.Port = *port
-	cfg.CtxSize = *ctx
-	cfg.Verbose = *verbose
-	cfg.Quant = *quant
-
+	cfg := loadGatewayConfig(fs)
 	if err := cfg.EnsureDirs(); err != nil {
 		ui.Error("Failed to create directories: %v", err)
 		os.Exit(1)
 	}
+	checkPortFree(cfg)
 
 	ui.Banner()
+	if fs.Lookup("d").Value.String() == "true" {
+		detach(cfg, "llmgw stop "+modelArg)
+	}
+	if cfg.Profile != "" {
+		ui.Info("Using profile %q", cfg.Profile)
+	}
+
+	m := prepareModel(cfg, modelArg, *fit)
+	cfg = m.cfg
+	cfg.Force = *force
+
+	// 5. Ensure backend
+	ui.Step(3, 3, "Preparing inference backend...")
+	if err := backend.New(cfg).EnsureBackend(); err != nil {
+		ui.Error("Backend setup failed: %v", err)
+		os.Exit(1)
+	}
+	pool := backend.NewPool(cfg)
+	tracker := trackGateway(cfg, pool, []string{m.repoID})
+	mgr := pool.Add(m.repoID, m.entry.FilePath, m.entry.SizeBytes)
+	if cfg.CtxSize == 0 {
+		ui.Detail("Context: %d tokens (auto)", mgr.ContextSize())
+	}
+
+	srv := api.NewServer(cfg, pool)
+	shutdown := handleShutdown(cfg, srv, pool, tracker)
+
+	// 6. Start backend and wait for it to be ready
+	ui.Info("Loading model into memory (this may take a moment)...")
+	if err := pool.StartAll(); err != nil {
+		shutdown.exitIfStarted()
+		ui.Error("Backend failed to start: %v", err)
+		explainLoadError(err)
+		pool.StopAll()
+		tracker.Remove()
+		os.Exit(1)
+	}
+
+	// 7. Start API server
+	ui.ServerReady(cfg.Port, ui.ServedModel{Name: m.repoID, Context: mgr.ContextSize()})
+
+	err := srv.ListenAndServe()
+	shutdown.exitIfStarted()
+	ui.Error("Server error: %v", err)
+	pool.StopAll()
+	tracker.Remove()
+	os.Exit(1)
+}
+
+// preparedModel is a locally cached model that is ready to load.
+type preparedModel struct {
+	cfg    *config.Config // with the model's overrides
+	repoID string
+	entry  *models.Entry
+}
 
-	// 1. Resolve model name
-	repoID := models.ResolveAlias(modelArg)
-	if repoID != modelArg {
-		ui.Info("Resolved alias %q → %s", modelArg, repoID)
+// prepareModel resolves modelArg and downloads the model unless it is
+// cached. It exits on failure. Whether the model fits in memory is checked
+// by the pool when it loads the model.
+func prepareModel(cfg *config.Config, modelArg string, fit bool) *preparedModel {
+	// 1. Resolve model name; "repo:quant" selects a quantization
+	repoID, refQuant := models.SplitRef(modelArg)
+	if name, _, _ := strings.Cut(modelArg, ":"); repoID != name {
+		ui.Info("Resolved alias %q → %s", name, repoID)
+	}
+	cfg = cfg.ForModel(repoID)
+	if refQuant != "" && !strings.HasPrefix(cfg.Source("quant"), config.SourceFlag) {
+		cfg.Quant = refQuant
 	}
 
 	registry := models.NewRegistry(cfg)
 
 	// 2. Check local cache
-	var modelPath string
-	if entry := registry.Find(repoID); entry != nil {
-		if _, err := os.Stat(entry.FilePath); err == nil {
-			ui.Success("Model found in cache: %s", entry.Filename)
-			modelPath = entry.FilePath
-		}
+	entry := registry.Find(repoID, cfg.Quant)
+	if entry != nil && entry.Complete() {
+		ui.Success("Model found in cache: %s", entry.Filename)
+	} else {
+		entry = nil
 	}
 
 	// 3. Download model if needed
-	if modelPath == "" {
+	if entry == nil {
 		ui.Step(1, 3, "Fetching model info from HuggingFace...")
-		hf := huggingface.NewClient(*token)
+		hf := huggingface.NewClient(cfg.HFToken)
 
 		info, err := hf.GetModelInfo(repoID)
 		if err != nil {
@@ -117,7 +212,18 @@ func cmdRun(args []string) {
 			os.Exit(1)
 		}
 
-		selected := hf.SelectBestGGUF(ggufFiles, cfg.Quant)
+		var maxSize int64
+		if fit {
+			mem, err := sysinfo.ReadMemory()
+			if err != nil {
+				ui.Warn("Cannot pick a quantization by memory: %v", err)
+			} else {
+				// Leave a quarter for the KV cache and runtime; the check
+				// before loading does the exact accounting.
+				maxSize = mem.Available * 3 / 4
+			}
+		}
+		selected := hf.SelectBestGGUF(ggufFiles, cfg.Quant, maxSize)
 		if selected == nil {
 			ui.Error("Could not select a GGUF file")
 			os.Exit(1)
@@ -127,76 +233,751 @@ func cmdRun(args []string) {
 		if selected.Size > 0 {
 			ui.Detail("Size: %s", ui.FormatBytes(selected.Size))
 		}
+		if selected.Sharded() {
+			ui.Detail("Split into %d parts", len(selected.Files))
+		}
 
 		ui.Step(2, 3, "Downloading model...")
-		dlURL := hf.DownloadURL(repoID, selected.Filename)
-		modelDir := cfg.ModelDir(repoID)
-		destPath := filepath.Join(modelDir, selected.Filename)
-
-		if err := downloader.DownloadFile(dlURL, destPath, selected.Filename); err != nil {
+		entry, err = registry.Download(context.Background(), hf, repoID, selected, nil)
+		if err != nil {
 			ui.Error("Download failed: %v", err)
 			os.Exit(1)
 		}
 
-		// Register in cache
-		registry.Add(models.Entry{
-			ID:         repoID + "/" + selected.Filename,
-			RepoID:     repoID,
-			Filename:   selected.Filename,
-			FilePath:   destPath,
-			SizeBytes:  selected.Size,
-			Downloaded: time.Now(),
-		})
-
 		ui.Success("Model downloaded")
-		modelPath = destPath
 	}
 
-	// 4. Ensure backend
-	ui.Step(3, 3, "Preparing inference backend...")
-	mgr := backend.New(cfg)
-	if err := mgr.EnsureBackend(); err != nil {
+	return &preparedModel{cfg: cfg, repoID: repoID, entry: entry}
+}
+
+// explainLoadError suggests what to do about a model that failed to load
+// because it looks too large for the memory available.
+func explainLoadError(err error) {
+	if errors.Is(err, backend.ErrNoMemory) {
+		ui.Detail("Try a smaller quantization (-quant Q4_K_M, or -fit) or a smaller -context")
+		ui.Detail("Pass -force to start anyway")
+	}
+}
+
+// ──────────────────────────────────── serve ──────────────────────────────────
+
+func cmdServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.String("mem-budget", "", "Max total size of loaded models (e.g. 16GB)")
+	fs.Duration("idle-ttl", 0, "Unload models idle for this long (e.g. 15m)")
+	preload := fs.Bool("preload", false, "Load all models at startup instead of on first use")
+	force := fs.Bool("force", false, "Load models even if they look too large for available memory")
+	gatewayFlags(fs)
+	fs.Parse(args)
+
+	cfg := loadGatewayConfig(fs)
+	cfg.Force = *force
+	if err := cfg.EnsureDirs(); err != nil {
+		ui.Error("Failed to create directories: %v", err)
+		os.Exit(1)
+	}
+	checkPortFree(cfg)
+
+	ui.Banner()
+	if fs.Lookup("d").Value.String() == "true" {
+		detach(cfg, fmt.Sprintf("llmgw stop %d", cfg.Port))
+	}
+	if cfg.Profile != "" {
+		ui.Info("Using profile %q", cfg.Profile)
+	}
+
+	registry := models.NewRegistry(cfg)
+
+	// Serve the named models, or everything in the cache when none are given.
+	// Each repo is served once, from its most recent variant unless a
+	// "repo:quant" argument picks one; the pool has one backend per repo, so
+	// naming a repo twice is an error.
+	var entries []models.Entry
+	if fs.NArg() == 0 {
+		seen := make(map[string]bool)
+		for _, e := range registry.List() {
+			if !seen[e.RepoID] {
+				seen[e.RepoID] = true
+				entries = append(entries, *registry.Find(e.RepoID, ""))
+			}
+		}
+	} else {
+		given := make(map[string]string) // repo → argument naming it
+		for _, arg := range fs.Args() {
+			entry := registry.Find(models.SplitRef(arg))
+			if entry == nil {
+				ui.Error("Model %q is not cached", arg)
+				ui.Detail("Download it first with: llmgw run %s", arg)
+				os.Exit(1)
+			}
+			if prev, ok := given[entry.RepoID]; ok {
+				ui.Error("%s is named twice (%s and %s); one variant of a repo can be served at a time", entry.RepoID, prev, arg)
+				ui.Detail("Serve the other from a second gateway with -port")
+				os.Exit(1)
+			}
+			given[entry.RepoID] = arg
+			entries = append(entries, *entry)
+		}
+	}
+
+	ready := entries[:0]
+	for _, e := range entries {
+		if !e.Complete() {
+			ui.Warn("Skipping %s: model files are missing", e.RepoID)
+			continue
+		}
+		ready = append(ready, e)
+	}
+	if len(ready) == 0 {
+		ui.Error("No cached models to serve")
+		ui.Detail("Download one with: llmgw run <model>")
+		os.Exit(1)
+	}
+
+	// The backend must be installed before the pool copies cfg, since
+	// installing it may pick the active llama.cpp version.
+	ui.Step(1, 2, "Preparing inference backend...")
+	if err := backend.New(cfg).EnsureBackend(); err != nil {
 		ui.Error("Backend setup failed: %v", err)
 		os.Exit(1)
 	}
 
-	// 5. Start backend
-	ui.Info("Loading model into memory...")
-	if err := mgr.Start(modelPath); err != nil {
-		ui.Error("Failed to start backend: %v", err)
+	pool := backend.NewPool(cfg)
+	var ids []string
+	for _, e := range ready {
+		ids = append(ids, e.RepoID)
+	}
+	tracker := trackGateway(cfg, pool, ids)
+	for _, e := range ready {
+		pool.Add(e.RepoID, e.FilePath, e.SizeBytes)
+	}
+
+	srv := api.NewServer(cfg, pool)
+	shutdown := handleShutdown(cfg, srv, pool, tracker)
+
+	if cfg.BackendPort != 0 {
+		// Otherwise each backend gets a free port when it is loaded.
+		for _, id := range ids {
+			ui.Detail("%s → %s", id, pool.Get(id).BackendURL())
+		}
+	}
+	if cfg.MemoryBudget > 0 {
+		ui.Detail("Memory budget: %s", ui.FormatBytes(cfg.MemoryBudget))
+	}
+	if cfg.IdleTTL > 0 {
+		ui.Detail("Idle models unload after %v", cfg.IdleTTL)
+	}
+
+	if *preload {
+		ui.Step(2, 2, "Loading %d model(s) into memory...", len(ids))
+		if err := pool.StartAll(); err != nil {
+			shutdown.exitIfStarted()
+			ui.Error("Backend failed to start: %v", err)
+			explainLoadError(err)
+			pool.StopAll()
+			tracker.Remove()
+			os.Exit(1)
+		}
+	} else {
+		ui.Step(2, 2, "Models will be loaded on first request")
+	}
+
+	served := make([]ui.ServedModel, len(ids))
+	for i, id := range ids {
+		served[i] = ui.ServedModel{Name: id, Context: pool.Get(id).ContextSize()}
+	}
+	ui.ServerReady(cfg.Port, served...)
+
+	err := srv.ListenAndServe()
+	shutdown.exitIfStarted()
+	ui.Error("Server error: %v", err)
+	pool.StopAll()
+	tracker.Remove()
+	os.Exit(1)
+}
+
+// gatewayShutdown tracks the graceful shutdown of run or serve.
+type gatewayShutdown struct {
+	started chan struct{} // closed on the first signal
+	done    chan struct{} // closed once the gateway has stopped
+}
+
+// handleShutdown shuts the gateway down on SIGINT, SIGTERM or SIGHUP: srv
+// stops accepting connections and gives the requests in flight up to
+// cfg.DrainTimeout to finish, then the backends are asked to exit. A second
+// signal kills everything at once.
+func handleShutdown(cfg *config.Config, srv *api.Server, pool *backend.Pool, tracker *daemon.Tracker) *gatewayShutdown {
+	g := &gatewayShutdown{started: make(chan struct{}), done: make(chan struct{})}
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		<-sigCh
+		close(g.started)
+		fmt.Println()
+		go func() {
+			<-sigCh
+			fmt.Println()
+			ui.Warn("Forced exit")
+			pool.Kill()
+			tracker.Remove()
+			os.Exit(1)
+		}()
+
+		if n := srv.InFlight(); n > 0 {
+			ui.Info("Shutting down: waiting up to %v for %d request(s) in flight (Ctrl+C again to force)...", cfg.DrainTimeout, n)
+		} else {
+			ui.Info("Shutting down...")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+		if err := srv.Shutdown(ctx); err != nil {
+			ui.Warn("Drain timeout reached; closed the connections still open")
+		}
+		cancel()
+
+		pool.StopAll()
+		tracker.Remove()
+		close(g.done)
+	}()
+	return g
+}
+
+// exitIfStarted returns at once if no shutdown is under way. Otherwise it
+// waits for the shutdown to finish and exits: errors from the server or
+// backends are then expected.
+func (g *gatewayShutdown) exitIfStarted() {
+	select {
+	case <-g.started:
+		<-g.done
+		os.Exit(0)
+	default:
+	}
+}
+
+// gatewayFlags registers the flags shared by run and serve. Each flag named
+// after a setting (with "-" for "_") overrides the config file and
+// environment; see loadGatewayConfig.
+func gatewayFlags(fs *flag.FlagSet) {
+	fs.Bool("d", false, "Run in the background (see llmgw ps, status, stop)")
+	fs.String("profile", "", "Config file profile to use (or LLMGW_PROFILE)")
+	fs.Int("port", config.DefaultPort, "API port")
+	fs.String("context", "auto", "Context window size in tokens, or \"auto\" for the model's own")
+	fs.Bool("verbose", false, "Show backend output")
+	fs.String("cors-origin", "", "Comma-separated origins allowed by CORS, or \"*\" for any (default: none)")
+	fs.Bool("no-auth", false, "Serve without API keys even if some have been created")
+	fs.Bool("allow-pull", false, "Let clients download models with /api/pull")
+	fs.Int("rpm", 0, "Requests per minute per client (0 = unlimited)")
+	fs.Int("tpd", 0, "Tokens per day per client (0 = unlimited)")
+	fs.String("audit-log", "", "Audit log path (default: ~/.llmgw/logs/audit.jsonl, \"off\" to disable)")
+	fs.Bool("audit-bodies", false, "Store full prompts and completions in the audit log")
+	fs.String("audit-redact", "", "Comma-separated extra regexes to redact from the audit log")
+	fs.String("audit-max-size", "100MB", "Rotate the audit log past this size")
+	fs.Duration("audit-max-age", 7*24*time.Hour, "Rotate the audit log after this long")
+	fs.Int("audit-max-backups", 5, "Rotated audit logs to keep")
+	fs.Int("connections", 4, "Parallel connections per model download (1 = single stream)")
+	fs.String("backend-bin", "", "llama-server binary to use instead of a downloaded release (or LLMGW_BACKEND_BIN)")
+	fs.Duration("drain-timeout", 30*time.Second, "On shutdown, wait this long for requests in flight")
+}
+
+// loadGatewayConfig loads the configuration for run or serve: the config
+// file, the -profile profile and the environment, then the flags given on
+// the command line. It exits on invalid values.
+func loadGatewayConfig(fs *flag.FlagSet) *config.Config {
+	cfg := loadConfig(fs.Lookup("profile").Value.String())
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		key := strings.ReplaceAll(f.Name, "-", "_")
+		if err == nil && config.IsSetting(key) {
+			err = cfg.Set(key, f.Value.String())
+		}
+	})
+	if err != nil {
+		ui.Error("%v", err)
+		os.Exit(1)
+	}
+
+	if cfg.BackendBin != "" {
+		// Fail before any model download; the binary itself is checked
+		// when the backend is prepared.
+		if _, err := os.Stat(cfg.BackendBin); err != nil {
+			ui.Error("Invalid llama-server binary: %v", err)
+			os.Exit(1)
+		}
+	}
+	downloader.Concurrency = cfg.DownloadConnections
+	return cfg
+}
+
+// loadConfig loads the config file, the named profile ("" for none) and the
+// environment, exiting with the error if any value is invalid.
+func loadConfig(profile string) *config.Config {
+	cfg, err := config.Load(profile)
+	if err != nil {
+		ui.Error("Invalid configuration: %v", err)
+		os.Exit(1)
+	}
+	cfg.ResolveModelNames(models.ResolveAlias)
+	return cfg
+}
+
+// ──────────────────────────────────── chat ───────────────────────────────────
+
+func cmdChat(args []string) {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	url := fs.String("url", "", "Chat through the gateway at this URL (e.g. http://localhost:8080)")
+	key := fs.String("key", os.Getenv("LLMGW_API_KEY"), "Gateway API key (default: $LLMGW_API_KEY)")
+	system := fs.String("system", "", "System prompt")
+	temperature := fs.String("temperature", "", "Sampling temperature (default: the model's)")
+	fs.String("profile", "", "Config file profile to use (or LLMGW_PROFILE)")
+	fs.String("context", "auto", "Context window size in tokens, or \"auto\" for the model's own")
+	fs.String("quant", "", "Preferred quantization (e.g. Q4_K_M)")
+	fs.String("token", "", "HuggingFace token (default: $HF_TOKEN)")
+	fs.Bool("verbose", false, "Show backend output")
+	fs.Int("connections", 4, "Parallel connections per model download (1 = single stream)")
+	fs.String("backend-bin", "", "llama-server binary to use instead of a downloaded release (or LLMGW_BACKEND_BIN)")
+	fit := fs.Bool("fit", false, "Download the largest quantization that fits in available memory")
+	force := fs.Bool("force", false, "Start even if the model looks too large for available memory")
+	fs.Parse(args)
+
+	session := &chat.Session{System: *system}
+	if *temperature != "" {
+		t, err := strconv.ParseFloat(*temperature, 64)
+		if err != nil || t < 0 || t > 2 {
+			ui.Error("Invalid -temperature %q: want a number between 0 and 2", *temperature)
+			os.Exit(1)
+		}
+		session.Temperature = &t
+	}
+
+	repl := &chat.REPL{Session: session}
+	if *url != "" {
+		connectGateway(repl, strings.TrimRight(*url, "/"), *key, fs.Arg(0))
+		if err := repl.Run(os.Stdin); err != nil {
+			ui.Error("%v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if fs.NArg() < 1 {
+		ui.Error("Usage: llmgw chat <model> [flags]")
+		ui.Detail("Example: llmgw chat tinyllama")
+		ui.Detail("Example: llmgw chat -url http://localhost:8080")
 		os.Exit(1)
 	}
 
-	// Graceful shutdown
+	cfg := loadGatewayConfig(fs)
+	if err := cfg.EnsureDirs(); err != nil {
+		ui.Error("Failed to create directories: %v", err)
+		os.Exit(1)
+	}
+
+	ui.Banner()
+	if cfg.Profile != "" {
+		ui.Info("Using profile %q", cfg.Profile)
+	}
+
+	cfg.Force = *force
+	m := prepareModel(cfg, fs.Arg(0), *fit)
+
+	ui.Step(3, 3, "Preparing inference backend...")
+	if err := backend.New(m.cfg).EnsureBackend(); err != nil {
+		ui.Error("Backend setup failed: %v", err)
+		os.Exit(1)
+	}
+	// Keep the backend EnsureBackend settled on for models loaded later.
+	cfg.BackendBin = m.cfg.BackendBin
+	cfg.BackendVersion = m.cfg.BackendVersion
+
+	b := &chatBackend{cfg: cfg}
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigCh
 		fmt.Println()
-		ui.Info("Shutting down...")
-		mgr.Stop()
-		os.Exit(0)
+		b.stop()
+		os.Exit(1)
 	}()
 
-	// 6. Wait for backend ready
-	ui.Info("Waiting for model to load (this may take a moment)...")
-	if err := mgr.WaitReady(5 * time.Minute); err != nil {
+	ui.Info("Loading model into memory (this may take a moment)...")
+	client, err := b.load(m.repoID, m.entry.FilePath, m.entry.SizeBytes)
+	if err != nil {
 		ui.Error("Backend failed to start: %v", err)
-		mgr.Stop()
+		explainLoadError(err)
+		b.stop()
 		os.Exit(1)
 	}
+	fmt.Println()
 
-	// 7. Start API server
-	ui.ServerReady(cfg.Port, repoID)
+	// From here on Ctrl+C belongs to the chat, which uses it to stop replies.
+	signal.Reset(syscall.SIGINT)
+
+	repl.Client = client
+	session.Model = m.repoID
+	repl.SwitchModel = func(name string) (*chat.Client, string, error) {
+		registry := models.NewRegistry(cfg)
+		repoID, quant := models.SplitRef(name)
+		entry := registry.Find(repoID, quant)
+		if entry == nil || !entry.Complete() {
+			return nil, "", fmt.Errorf("not cached; download it first with: llmgw run %s", name)
+		}
+		client, err := b.load(entry.RepoID, entry.FilePath, entry.SizeBytes)
+		return client, entry.RepoID, err
+	}
+
+	err = repl.Run(os.Stdin)
+	b.stop()
+	if err != nil {
+		ui.Error("%v", err)
+		os.Exit(1)
+	}
+}
+
+// connectGateway points repl at the gateway at baseURL, chatting with model
+// or, if that is "", the first model the gateway serves. It exits if the
+// gateway cannot be reached or does not serve the model.
+func connectGateway(repl *chat.REPL, baseURL, key, model string) {
+	client := &chat.Client{BaseURL: baseURL, APIKey: key}
+	ids, err := client.Models()
+	if err != nil {
+		ui.Error("Cannot reach gateway at %s: %v", baseURL, err)
+		os.Exit(1)
+	}
+	if len(ids) == 0 {
+		ui.Error("Gateway at %s serves no models", baseURL)
+		os.Exit(1)
+	}
+
+	find := func(name string) (string, error) {
+		for _, candidate := range []string{name, models.ResolveAlias(name)} {
+			if slices.Contains(ids, candidate) {
+				return candidate, nil
+			}
+		}
+		return "", fmt.Errorf("not served by the gateway (have: %s)", strings.Join(ids, ", "))
+	}
+
+	repl.Client = client
+	repl.Session.Model = ids[0]
+	if model != "" {
+		if repl.Session.Model, err = find(model); err != nil {
+			ui.Error("Model %q is %v", model, err)
+			os.Exit(1)
+		}
+	}
+	repl.SwitchModel = func(name string) (*chat.Client, string, error) {
+		id, err := find(name)
+		return client, id, err
+	}
+	ui.Success("Connected to %s", baseURL)
+}
+
+// chatBackend runs the llama-server for a local chat, one model at a time.
+type chatBackend struct {
+	cfg  *config.Config
+	mu   sync.Mutex
+	pool *backend.Pool
+}
+
+// load stops the current model, if any, and starts repoID. If it fails to
+// start, the previous model is reloaded.
+func (b *chatBackend) load(repoID, path string, size int64) (*chat.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev := b.pool
+	if prev != nil {
+		prev.StopAll()
+	}
+	pool := backend.NewPool(b.cfg)
+	mgr := pool.Add(repoID, path, size)
+	if err := pool.StartAll(); err != nil {
+		pool.StopAll()
+		if prev != nil {
+			if err := prev.StartAll(); err != nil {
+				ui.Warn("Could not reload the previous model: %v", err)
+			}
+		}
+		return nil, err
+	}
+	b.pool = pool
+	return &chat.Client{BaseURL: mgr.BackendURL()}, nil
+}
+
+func (b *chatBackend) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pool != nil {
+		b.pool.StopAll()
+	}
+}
+
+// ───────────────────────────────── background ────────────────────────────────
+
+// checkPortFree exits if cfg.Port is taken, by another gateway or any other
+// process, so that run and serve fail before downloading anything.
+func checkPortFree(cfg *config.Config) {
+	if s := daemon.Lookup(cfg.RunDir, cfg.Port); s != nil {
+		ui.Error("A gateway is already running on port %d (pid %d)", s.Port, s.PID)
+		ui.Detail("Stop it with: llmgw stop %d, or pick another -port", s.Port)
+		os.Exit(1)
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		ui.Error("Port %d is not available: %v", cfg.Port, err)
+		ui.Detail("Pick another with -port")
+		os.Exit(1)
+	}
+	l.Close()
+}
+
+// trackGateway records the gateway in cfg.RunDir for ps, status and stop,
+// and has pool report its llama-server processes there. It must be called
+// before models are added to the pool.
+func trackGateway(cfg *config.Config, pool *backend.Pool, ids []string) *daemon.Tracker {
+	tracker, err := daemon.Register(cfg.RunDir, daemon.State{
+		Port:       cfg.Port,
+		Models:     ids,
+		StartedAt:  time.Now(),
+		BackendBin: cfg.BackendBinaryPath(),
+		LogPath:    os.Getenv(daemon.EnvLog),
+	})
+	if err != nil {
+		ui.Error("%v", err)
+		os.Exit(1)
+	}
+	pool.OnProcess(tracker.SetBackend)
+	return tracker
+}
+
+// detach reruns the current command in the background without -d, waits
+// until its gateway answers on cfg.Port and exits. stopHint is the command
+// that stops it.
+func detach(cfg *config.Config, stopHint string) {
+	exe, err := os.Executable()
+	if err != nil {
+		ui.Error("Cannot run in the background: %v", err)
+		os.Exit(1)
+	}
+	var args []string
+	for _, arg := range os.Args[1:] {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && name == "d" {
+			continue
+		}
+		args = append(args, arg)
+	}
+
+	logPath := cfg.GatewayLogPath(cfg.Port)
+	var offset int64
+	if info, err := os.Stat(logPath); err == nil {
+		offset = info.Size()
+	}
+	proc, err := daemon.Start(exe, args, logPath)
+	if err != nil {
+		ui.Error("Cannot run in the background: %v", err)
+		os.Exit(1)
+	}
+	ui.Info("Starting in the background (pid %d)...", proc.Pid)
+	ui.Detail("Output: %s", logPath)
+
+	exited := make(chan string, 1)
+	go func() {
+		state, err := proc.Wait()
+		if err != nil {
+			exited <- err.Error()
+			return
+		}
+		exited <- state.String()
+	}()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case status := <-exited:
+			ui.Error("The gateway exited during startup (%s)", status)
+			if data, err := os.ReadFile(logPath); err == nil && int64(len(data)) > offset {
+				lines := strings.Split(strings.TrimRight(string(data[offset:]), "\n"), "\n")
+				for _, line := range lines[max(len(lines)-10, 0):] {
+					ui.Detail("%s", line)
+				}
+			}
+			os.Exit(1)
+		case <-ticker.C:
+			s := daemon.Lookup(cfg.RunDir, cfg.Port)
+			if s == nil || s.PID != proc.Pid {
+				continue
+			}
+			if status, _ := gatewayHealth(cfg.Port); status == "unreachable" {
+				continue
+			}
+			ui.Success("Gateway running on http://localhost:%d (pid %d)", cfg.Port, proc.Pid)
+			ui.Detail("Stop it with: %s", stopHint)
+			os.Exit(0)
+		}
+	}
+}
+
+// gatewayHealth queries the gateway on port and returns its overall status,
+// or "unreachable", and the status of each model.
+func gatewayHealth(port int) (string, map[string]string) {
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/health", port))
+	if err != nil {
+		return "unreachable", nil
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Status string            `json:"status"`
+		Models map[string]string `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil || health.Status == "" {
+		return fmt.Sprintf("HTTP %d", resp.StatusCode), nil
+	}
+	return health.Status, health.Models
+}
+
+// runningGateways returns the live gateways, reporting any that died
+// without cleaning up after themselves.
+func runningGateways(cfg *config.Config) []*daemon.State {
+	live, stale, err := daemon.Scan(cfg.RunDir)
+	if err != nil {
+		ui.Error("Cannot read %s: %v", cfg.RunDir, err)
+		os.Exit(1)
+	}
+	for _, s := range stale {
+		ui.Warn("Cleaned up after gateway on port %d (pid %d), which is no longer running", s.Port, s.PID)
+		for _, pid := range s.Orphans {
+			ui.Detail("Killed orphaned llama-server (pid %d)", pid)
+		}
+	}
+	return live
+}
+
+func cmdPs() {
+	cfg := loadConfig("")
+	gateways := runningGateways(cfg)
+	if len(gateways) == 0 {
+		ui.Info("No gateways running. Start one with: llmgw run -d <model>")
+		return
+	}
+
+	fmt.Printf("  %-6s %-8s %-10s %-11s %-10s %s\n", "PORT", "PID", "UPTIME", "STATUS", "MODE", "MODELS")
+	fmt.Printf("  %s\n", strings.Repeat("─", 90))
+	for _, s := range gateways {
+		status, _ := gatewayHealth(s.Port)
+		mode := "foreground"
+		if s.Detached() {
+			mode = "background"
+		}
+		fmt.Printf("  %-6d %-8d %-10s %-11s %-10s %s\n",
+			s.Port, s.PID, formatUptime(time.Since(s.StartedAt)), status, mode, strings.Join(s.Models, ", "))
+	}
+}
+
+func cmdStatus() {
+	cfg := loadConfig("")
+	gateways := runningGateways(cfg)
+	if len(gateways) == 0 {
+		ui.Info("No gateways running")
+		return
+	}
+
+	for i, s := range gateways {
+		if i > 0 {
+			fmt.Println()
+		}
+		status, modelStatus := gatewayHealth(s.Port)
+		switch status {
+		case "ok":
+			ui.Success("Gateway on http://localhost:%d: %s", s.Port, status)
+		case "unreachable":
+			ui.Error("Gateway on http://localhost:%d: %s", s.Port, status)
+		default:
+			ui.Warn("Gateway on http://localhost:%d: %s", s.Port, status)
+		}
+		ui.Detail("PID:      %d", s.PID)
+		ui.Detail("Started:  %s (up %s)", s.StartedAt.Format(time.DateTime), formatUptime(time.Since(s.StartedAt)))
+		if s.Detached() {
+			ui.Detail("Output:   %s", s.LogPath)
+		}
+		for _, id := range s.Models {
+			state := modelStatus[id]
+			if state == "" {
+				state = "unknown"
+			}
+			if pid, ok := s.Backends[id]; ok {
+				state += fmt.Sprintf(", llama-server pid %d", pid)
+			}
+			ui.Detail("Model:    %s (%s)", id, state)
+		}
+	}
+}
+
+func cmdStop(args []string) {
+	cfg := loadConfig("")
+	gateways := runningGateways(cfg)
+	if len(gateways) == 0 {
+		ui.Info("No gateways running")
+		return
+	}
+
+	var targets []*daemon.State
+	switch {
+	case len(args) == 0:
+		if len(gateways) > 1 {
+			ui.Error("%d gateways are running; name a model, a port or \"all\"", len(gateways))
+			for _, s := range gateways {
+				ui.Detail("port %d: %s", s.Port, strings.Join(s.Models, ", "))
+			}
+			os.Exit(1)
+		}
+		targets = gateways
+	case args[0] == "all":
+		targets = gateways
+	default:
+		port, _ := strconv.Atoi(args[0])
+		repoID, _ := models.SplitRef(args[0])
+		for _, s := range gateways {
+			if s.Port == port || s.Serves(repoID) || s.Serves(args[0]) {
+				targets = append(targets, s)
+			}
+		}
+		if len(targets) == 0 {
+			ui.Error("No running gateway serves %s", args[0])
+			ui.Detail("See what is running with: llmgw ps")
+			os.Exit(1)
+		}
+	}
 
-	srv := api.NewServer(cfg.Port, mgr.BackendURL(), repoID)
-	if err := srv.ListenAndServe(); err != nil {
-		ui.Error("Server error: %v", err)
-		mgr.Stop()
+	// Leave the gateway time to drain requests and stop its backends.
+	timeout := cfg.DrainTimeout + backend.StopGrace + 5*time.Second
+	failed := false
+	for _, s := range targets {
+		if err := s.Stop(timeout); err != nil {
+			ui.Error("Could not stop gateway on port %d: %v", s.Port, err)
+			failed = true
+			continue
+		}
+		ui.Success("Stopped gateway on port %d (pid %d)", s.Port, s.PID)
+		for _, pid := range s.Orphans {
+			ui.Detail("Killed leftover llama-server (pid %d)", pid)
+		}
+	}
+	if failed {
 		os.Exit(1)
 	}
 }
 
+// formatUptime formats d to the second, e.g. "3h4m5s".
+func formatUptime(d time.Duration) string {
+	return d.Truncate(time.Second).String()
+}
+
 // ──────────────────────────────────── search ─────────────────────────────────
 
 func cmdSearch(args []string) {
@@ -234,7 +1015,7 @@ func cmdSearch(args []string) {
 // ──────────────────────────────────── list ───────────────────────────────────
 
 func cmdList() {
-	cfg := config.New()
+	cfg := loadConfig("")
 	registry := models.NewRegistry(cfg)
 	entries := registry.List()
 
@@ -245,34 +1026,337 @@ func cmdList() {
 		return
 	}
 
-	fmt.Printf("  %-45s %-30s %10s\n", "REPO", "FILE", "SIZE")
-	fmt.Printf("  %s\n", strings.Repeat("─", 88))
 	for _, e := range entries {
-		fmt.Printf("  %-45s %-30s %10s\n",
-			truncate(e.RepoID, 45),
-			truncate(e.Filename, 30),
+		// Models downloaded before header metadata was recorded.
+		if e.Arch == "" && e.Complete() {
+			if _, err := e.Inspect(); err == nil {
+				registry.Add(e)
+			}
+		}
+	}
+	entries = registry.List()
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].RepoID < entries[j].RepoID })
+
+	fmt.Printf("  %-40s %-10s %-8s %7s %-28s %10s\n", "REPO", "ARCH", "QUANT", "CTX", "FILE", "SIZE")
+	fmt.Printf("  %s\n", strings.Repeat("─", 108))
+	for _, e := range entries {
+		ctx := "-"
+		if e.ContextLength > 0 {
+			ctx = strconv.Itoa(e.ContextLength)
+		}
+		fmt.Printf("  %-40s %-10s %-8s %7s %-28s %10s\n",
+			truncate(e.RepoID, 40),
+			truncate(e.Arch, 10),
+			e.Quant(),
+			ctx,
+			truncate(e.Filename, 28),
 			ui.FormatBytes(e.SizeBytes))
 	}
 	fmt.Println()
+	ui.Detail("Use repo:quant to pick a variant, e.g. llmgw run tinyllama:Q5_K_M")
+}
+
+// ──────────────────────────────────── show ───────────────────────────────────
+
+func cmdShow(args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	all := fs.Bool("metadata", false, "Print every metadata key")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		ui.Error("Usage: llmgw show [-metadata] <model>[:quant] | <file.gguf>")
+		os.Exit(1)
+	}
+	ref := fs.Arg(0)
+
+	var (
+		f     *gguf.File
+		err   error
+		title string
+		size  int64
+	)
+	if info, statErr := os.Stat(ref); statErr == nil && !info.IsDir() {
+		f, err = gguf.ReadModel(ref)
+		title, size = ref, info.Size()
+	} else {
+		cfg := loadConfig("")
+		registry := models.NewRegistry(cfg)
+		e := registry.Find(models.SplitRef(ref))
+		if e == nil {
+			ui.Error("Model %q is not cached", ref)
+			ui.Detail("Download it with: llmgw run %s", ref)
+			os.Exit(1)
+		}
+		f, err = e.Inspect()
+		if err == nil {
+			registry.Add(*e)
+		}
+		title, size = e.RepoID+" ("+e.Filename+")", e.SizeBytes
+	}
+	if err != nil {
+		ui.Error("Could not read model header: %v", err)
+		os.Exit(1)
+	}
+
+	row := func(label, value string) {
+		if value != "" && value != "0" {
+			fmt.Printf("  %s%-16s%s %s\n", ui.Bold, label, ui.Reset, value)
+		}
+	}
+	num := func(key string) string {
+		return strconv.FormatUint(f.ArchUint(key), 10)
+	}
+
+	fmt.Println()
+	row("Model", title)
+	row("Name", f.Name())
+	row("Architecture", f.Architecture())
+	row("Parameters", formatParams(f.Params))
+	row("Quantization", f.FileType())
+	row("Context length", num("context_length"))
+	row("Embedding size", num("embedding_length"))
+	row("Layers", num("block_count"))
+	row("Attention heads", num("attention.head_count"))
+	row("KV heads", num("attention.head_count_kv"))
+	row("Tokenizer", f.Tokenizer())
+	row("Vocabulary", strconv.Itoa(f.ArrayLen("tokenizer.ggml.tokens")))
+	row("Tensors", strconv.FormatUint(f.TensorCount, 10))
+	row("Size", ui.FormatBytes(size))
+	row("GGUF version", strconv.Itoa(int(f.Version)))
+
+	if tmpl := f.ChatTemplate(); tmpl != "" {
+		fmt.Println()
+		fmt.Printf("  %sChat template%s\n", ui.Bold, ui.Reset)
+		for _, line := range strings.Split(strings.TrimRight(tmpl, "\n"), "\n") {
+			fmt.Printf("    %s%s%s\n", ui.Dim, line, ui.Reset)
+		}
+	}
+
+	if *all {
+		fmt.Println()
+		fmt.Printf("  %sMetadata%s\n", ui.Bold, ui.Reset)
+		for _, key := range f.Keys {
+			var value string
+			switch v := f.Metadata[key].(type) {
+			case gguf.Array:
+				value = fmt.Sprintf("[%d items]", v.Len)
+			case string:
+				value = strconv.Quote(truncate(v, 60))
+			default:
+				value = fmt.Sprint(v)
+			}
+			fmt.Printf("    %-44s %s\n", key, value)
+		}
+	}
+	fmt.Println()
+}
+
+// formatParams formats a parameter count the way model cards do, e.g. "1.1B".
+func formatParams(n uint64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.0fM", float64(n)/1e6)
+	case n > 0:
+		return strconv.FormatUint(n, 10)
+	}
+	return ""
+}
+
+// ──────────────────────────────────── verify ─────────────────────────────────
+
+func cmdVerify(args []string) {
+	cfg := loadConfig("")
+	registry := models.NewRegistry(cfg)
+
+	entries := registry.List()
+	if len(args) > 0 {
+		repoID, quant := models.SplitRef(args[0])
+		entries = nil
+		for _, e := range registry.Variants(repoID) {
+			if quant == "" || e.IsQuant(quant) {
+				entries = append(entries, e)
+			}
+		}
+		if len(entries) == 0 {
+			ui.Error("Model %q is not cached", args[0])
+			os.Exit(1)
+		}
+	}
+	if len(entries) == 0 {
+		ui.Info("No models cached.")
+		return
+	}
+
+	hf := huggingface.NewClient(cfg.HFToken)
+	failed := 0
+	for _, e := range entries {
+		ui.Info("Verifying %s (%s)", e.RepoID, e.Filename)
+
+		var info *huggingface.ModelInfo
+		parts := e.Files()
+		fetched, corrupt := false, false
+		for i := range parts {
+			p := &parts[i]
+			if p.SHA256 == "" {
+				// Models downloaded before checksums were recorded.
+				if info == nil {
+					info, _ = hf.GetModelInfo(e.RepoID)
+				}
+				p.SHA256 = lookupSHA256(info, p.Filename)
+				if p.SHA256 == "" {
+					ui.Warn("%s: no reference checksum available; skipping", filepath.Base(p.Filename))
+					continue
+				}
+				fetched = true
+			}
+			if err := verifyPart(*p); err != nil {
+				ui.Error("%s: %v", filepath.Base(p.Filename), err)
+				corrupt = true
+				continue
+			}
+			ui.Success("%s: OK (sha256 %s)", filepath.Base(p.Filename), p.SHA256)
+		}
+
+		if corrupt {
+			failed++
+			// Name the variant, so that only the corrupt one is removed.
+			ref := e.RepoID
+			if q := e.Quant(); q != "" {
+				ref += ":" + q
+			}
+			ui.Detail("Re-download with: llmgw remove %s && llmgw run %s", ref, ref)
+			continue
+		}
+		if fetched {
+			if len(e.Parts) > 0 {
+				e.Parts = parts
+			} else {
+				e.SHA256 = parts[0].SHA256
+			}
+			registry.Add(e)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// verifyPart re-hashes one cached file and compares it with its checksum.
+func verifyPart(p models.Part) error {
+	info, err := os.Stat(p.FilePath)
+	if err != nil {
+		return fmt.Errorf("missing file: %w", err)
+	}
+	bar := ui.NewProgressBar(info.Size(), filepath.Base(p.Filename))
+	sum, err := downloader.SHA256File(p.FilePath, func(done, _ int64) { bar.Update(done) })
+	bar.Finish()
+	if err != nil {
+		return fmt.Errorf("could not read file: %w", err)
+	}
+	if !strings.EqualFold(sum, p.SHA256) {
+		return fmt.Errorf("corrupt: expected sha256 %s, got %s", p.SHA256, sum)
+	}
+	return nil
+}
+
+// lookupSHA256 returns a file's checksum from the HuggingFace LFS metadata,
+// or "" if it is unavailable.
+func lookupSHA256(info *huggingface.ModelInfo, filename string) string {
+	if info == nil {
+		return ""
+	}
+	for i := range info.Siblings {
+		if info.Siblings[i].Filename == filename {
+			return info.Siblings[i].SHA256()
+		}
+	}
+	return ""
+}
+
+// ──────────────────────────────────── logs ───────────────────────────────────
+
+func cmdLogs(args []string) {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	lines := fs.Int("n", 100, "Number of lines to show")
+	follow := fs.Bool("f", false, "Keep printing new output")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		ui.Error("Usage: llmgw logs [-n lines] [-f] <model>")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig("")
+	repoID, _ := models.SplitRef(fs.Arg(0))
+	path := cfg.BackendLogPath(repoID)
+
+	data, err := os.ReadFile(path)
+	if err != nil && !(*follow && os.IsNotExist(err)) {
+		ui.Error("No backend log for %s: %v", repoID, err)
+		ui.Detail("Logs are written once the model has been served")
+		os.Exit(1)
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	if text != "" {
+		all := strings.Split(text, "\n")
+		for _, line := range all[max(len(all)-*lines, 0):] {
+			fmt.Println(line)
+		}
+	}
+	if *follow {
+		followFile(path, int64(len(data)))
+	}
+}
+
+// followFile prints what is appended to path after offset until
+// interrupted, starting over when the file is rotated or truncated.
+func followFile(path string, offset int64) {
+	var prev os.FileInfo
+	for ; ; time.Sleep(500 * time.Millisecond) {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if (prev != nil && !os.SameFile(prev, info)) || info.Size() < offset {
+			offset = 0
+		}
+		prev = info
+		if info.Size() == offset {
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		f.Seek(offset, io.SeekStart)
+		n, _ := io.Copy(os.Stdout, f)
+		offset += n
+		f.Close()
+	}
 }
 
 // ──────────────────────────────────── remove ─────────────────────────────────
 
 func cmdRemove(args []string) {
 	if len(args) == 0 {
-		ui.Error("Usage: llmgw remove <model-id>")
+		ui.Error("Usage: llmgw remove <model>[:quant]")
 		os.Exit(1)
 	}
 
-	cfg := config.New()
+	cfg := loadConfig("")
 	registry := models.NewRegistry(cfg)
 
-	target := models.ResolveAlias(args[0])
-	if err := registry.Remove(target); err != nil {
+	removed, err := registry.Remove(args[0])
+	if err != nil {
 		ui.Error("%v", err)
 		os.Exit(1)
 	}
-	ui.Success("Removed %s", target)
+	for _, e := range removed {
+		ui.Success("Removed %s (%s)", e.RepoID, e.Filename)
+	}
 }
 
 // ──────────────────────────────────── aliases ────────────────────────────────
@@ -288,6 +1372,402 @@ func cmdAliases() {
 	ui.Detail("Use an alias: llmgw run tinyllama")
 }
 
+// ──────────────────────────────────── keys ─────────────────────────────────────
+
+func cmdKeys(args []string) {
+	if len(args) == 0 {
+		ui.Error("Usage: llmgw keys create|list|revoke")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig("")
+	if err := cfg.EnsureDirs(); err != nil {
+		ui.Error("Failed to create directories: %v", err)
+		os.Exit(1)
+	}
+	store := auth.NewStore(cfg)
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ExitOnError)
+		name := fs.String("name", "", "Human-readable key name")
+		modelScope := fs.String("models", "", "Comma-separated models the key may use (default: all)")
+		endpointScope := fs.String("endpoints", "", "Comma-separated endpoint paths the key may call (default: all)")
+		rpm := fs.Int("rpm", 0, "Requests per minute for this key (default: gateway -rpm)")
+		tpd := fs.Int("tpd", 0, "Tokens per day for this key (default: gateway -tpd)")
+		fs.Parse(args[1:])
+
+		var scoped []string
+		for _, m := range splitList(*modelScope) {
+			scoped = append(scoped, models.ResolveAlias(m))
+		}
+
+		secret, key, err := store.Create(auth.Key{
+			Name:      *name,
+			Models:    scoped,
+			Endpoints: splitList(*endpointScope),
+			RPM:       *rpm,
+			TPD:       *tpd,
+		})
+		if err != nil {
+			ui.Error("Failed to create key: %v", err)
+			os.Exit(1)
+		}
+		ui.Success("Created key %s", key.ID)
+		fmt.Println()
+		fmt.Printf("  %s\n", secret)
+		fmt.Println()
+		ui.Warn("Store this key now — it cannot be shown again.")
+
+	case "list":
+		keys := store.List()
+		ui.Banner()
+		if len(keys) == 0 {
+			if store.Enabled() {
+				ui.Warn("No API keys. Authentication stays on, so every request is rejected.")
+				ui.Detail("Create one with: llmgw keys create -name <name>, or run the gateway with -no-auth")
+				return
+			}
+			ui.Info("No API keys. Authentication is disabled until one is created.")
+			ui.Detail("Create one with: llmgw keys create -name <name>")
+			return
+		}
+		fmt.Printf("  %-14s %-16s %-16s %-24s %s\n", "ID", "NAME", "PREFIX", "MODELS", "ENDPOINTS")
+		fmt.Printf("  %s\n", strings.Repeat("─", 88))
+		for _, k := range keys {
+			fmt.Printf("  %-14s %-16s %-16s %-24s %s\n",
+				k.ID,
+				truncate(k.Name, 16),
+				k.Prefix+"…",
+				truncate(scopeString(k.Models), 24),
+				scopeString(k.Endpoints))
+		}
+		fmt.Println()
+
+	case "revoke":
+		if len(args) < 2 {
+			ui.Error("Usage: llmgw keys revoke <id|name>")
+			os.Exit(1)
+		}
+		n, err := store.Revoke(args[1])
+		if err != nil {
+			ui.Error("%v", err)
+			os.Exit(1)
+		}
+		if n > 1 {
+			ui.Success("Revoked %d keys named %s", n, args[1])
+		} else {
+			ui.Success("Revoked %s", args[1])
+		}
+		if len(store.List()) == 0 {
+			ui.Warn("No API keys left. Authentication stays on, so every request is rejected.")
+			ui.Detail("Create a key, or run the gateway with -no-auth to serve without one")
+		}
+
+	default:
+		ui.Error("Unknown keys command: %s", args[0])
+		ui.Detail("Usage: llmgw keys create|list|revoke")
+		os.Exit(1)
+	}
+}
+
+func scopeString(scopes []string) string {
+	if len(scopes) == 0 {
+		return "all"
+	}
+	return strings.Join(scopes, ",")
+}
+
+// ─────────────────────────────────── backend ───────────────────────────────────
+
+func cmdBackend(args []string) {
+	if len(args) == 0 {
+		ui.Error("Usage: llmgw backend list|install <tag>|use <tag|path>|update")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig("")
+	if err := cfg.EnsureDirs(); err != nil {
+		ui.Error("Failed to create directories: %v", err)
+		os.Exit(1)
+	}
+	mgr := backend.New(cfg)
+
+	switch args[0] {
+	case "list":
+		versions, err := mgr.Installed()
+		if err != nil {
+			ui.Error("Failed to list llama.cpp versions: %v", err)
+			os.Exit(1)
+		}
+		ui.Banner()
+		if cfg.BackendBin != "" {
+			ui.Info("Using external llama-server: %s", cfg.BackendBin)
+			ui.Detail("Go back to downloaded releases with: llmgw backend use <tag>")
+			fmt.Println()
+		}
+		legacy := false
+		if cfg.BackendVersion == "" {
+			_, err := os.Stat(filepath.Join(cfg.BinDir, config.BackendBinaryName()))
+			legacy = err == nil
+		}
+		if len(versions) == 0 && !legacy {
+			ui.Info("No llama.cpp versions installed.")
+			if cfg.BackendBin == "" {
+				if path := backend.FindOnPath(); path != "" {
+					ui.Detail("llama-server on PATH will be used: %s", path)
+				}
+			}
+			ui.Detail("Install the latest with: llmgw backend update")
+			return
+		}
+		fmt.Printf("  %-2s %-16s %-18s %s\n", "", "VERSION", "INSTALLED", "PATH")
+		fmt.Printf("  %s\n", strings.Repeat("─", 88))
+		if legacy {
+			active := "*"
+			if cfg.BackendBin != "" {
+				active = ""
+			}
+			fmt.Printf("  %-2s %-16s %-18s %s\n", active, "(unversioned)", "", filepath.Join(cfg.BinDir, config.BackendBinaryName()))
+		}
+		for _, v := range versions {
+			active := ""
+			if v.Tag == cfg.BackendVersion && cfg.BackendBin == "" {
+				active = "*"
+			}
+			fmt.Printf("  %-2s %-16s %-18s %s\n", active, v.Tag, v.InstalledAt.Format("2006-01-02 15:04"), v.Path)
+		}
+		fmt.Println()
+		if cfg.BackendVersion != "" && !mgr.IsInstalled(cfg.BackendVersion) {
+			ui.Warn("Active version %s is not installed; it will be downloaded on next run.", cfg.BackendVersion)
+		}
+
+	case "install":
+		if len(args) < 2 {
+			ui.Error("Usage: llmgw backend install <tag>")
+			os.Exit(1)
+		}
+		tag := args[1]
+		if tag == "latest" {
+			tag = ""
+		}
+		tag, err := mgr.Install(tag)
+		if err != nil {
+			ui.Error("%v", err)
+			os.Exit(1)
+		}
+		ui.Success("llama.cpp %s installed", tag)
+		if cfg.BackendVersion == "" {
+			if err := cfg.SetBackendVersion(tag); err != nil {
+				ui.Error("Failed to save active version: %v", err)
+				os.Exit(1)
+			}
+			ui.Detail("Now using llama.cpp %s", tag)
+		} else if tag != cfg.BackendVersion {
+			ui.Detail("Switch to it with: llmgw backend use %s", tag)
+		}
+
+	case "use":
+		if len(args) < 2 {
+			ui.Error("Usage: llmgw backend use <tag|path>")
+			os.Exit(1)
+		}
+		// A path selects an external binary, such as a local build.
+		if strings.ContainsAny(args[1], `/\`) {
+			path, err := filepath.Abs(args[1])
+			if err == nil {
+				_, err = backend.CheckBinary(path)
+			}
+			if err != nil {
+				ui.Error("%v", err)
+				os.Exit(1)
+			}
+			if err := cfg.SetBackendBin(path); err != nil {
+				ui.Error("Failed to save backend binary: %v", err)
+				os.Exit(1)
+			}
+			ui.Success("Now using %s", path)
+			ui.Detail("Restart running gateways to pick it up.")
+			return
+		}
+		tag := args[1]
+		if !mgr.IsInstalled(tag) {
+			ui.Error("llama.cpp %s is not installed", tag)
+			ui.Detail("Install it with: llmgw backend install %s", tag)
+			os.Exit(1)
+		}
+		err := cfg.SetBackendVersion(tag)
+		if err == nil {
+			err = cfg.SetBackendBin("")
+		}
+		if err != nil {
+			ui.Error("Failed to save active version: %v", err)
+			os.Exit(1)
+		}
+		ui.Success("Now using llama.cpp %s", tag)
+		ui.Detail("Restart running gateways to pick it up.")
+
+	case "update":
+		tag, err := mgr.Install("")
+		if err != nil {
+			ui.Error("%v", err)
+			os.Exit(1)
+		}
+		if tag == cfg.BackendVersion {
+			ui.Success("llama.cpp %s is the latest release", tag)
+			return
+		}
+		previous := cfg.BackendVersion
+		if err := cfg.SetBackendVersion(tag); err != nil {
+			ui.Error("Failed to save active version: %v", err)
+			os.Exit(1)
+		}
+		if previous == "" {
+			ui.Success("Now using llama.cpp %s", tag)
+		} else {
+			ui.Success("Updated llama.cpp %s → %s", previous, tag)
+			ui.Detail("Switch back with: llmgw backend use %s", previous)
+		}
+		if cfg.BackendBin != "" {
+			ui.Warn("The external llama-server %s is still used instead.", cfg.BackendBin)
+			ui.Detail("Switch with: llmgw backend use %s", tag)
+		}
+
+	default:
+		ui.Error("Unknown backend command: %s", args[0])
+		ui.Detail("Usage: llmgw backend list|install <tag>|use <tag|path>|update")
+		os.Exit(1)
+	}
+}
+
+// ──────────────────────────────────── config ───────────────────────────────────
+
+func cmdConfig(args []string) {
+	if len(args) == 0 {
+		ui.Error("Usage: llmgw config get|set|show")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	profile := fs.String("profile", "", "Profile to read or change")
+	model := fs.String("model", "", "Model whose overrides to change (for set)")
+	fs.Parse(args[1:])
+
+	switch args[0] {
+	case "show":
+		cfg := loadConfig(*profile)
+		profiles, _ := cfg.Profiles()
+
+		ui.Banner()
+		path := cfg.SettingsPath()
+		if _, err := os.Stat(path); err != nil {
+			path += " (not created yet)"
+		}
+		fmt.Printf("  %-14s %s\n", "Config file:", path)
+		if cfg.Profile != "" {
+			fmt.Printf("  %-14s %s\n", "Profile:", cfg.Profile)
+		}
+		if len(profiles) > 0 {
+			fmt.Printf("  %-14s %s\n", "Profiles:", strings.Join(profiles, ", "))
+		}
+		fmt.Println()
+
+		fmt.Printf("  %-16s %-42s %s\n", "KEY", "VALUE", "SOURCE")
+		fmt.Printf("  %s\n", strings.Repeat("─", 88))
+		for _, key := range config.Keys() {
+			value, _ := cfg.Get(key)
+			if key == "token" && value != "" {
+				value = value[:min(4, len(value))] + "…"
+			}
+			fmt.Printf("  %-16s %-42s %s\n", key, truncate(value, 42), cfg.Source(key))
+		}
+		fmt.Println()
+
+		if len(cfg.Models) > 0 {
+			names := make([]string, 0, len(cfg.Models))
+			for name := range cfg.Models {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fmt.Printf("  %-42s %s\n", "MODEL", "OVERRIDES")
+			fmt.Printf("  %s\n", strings.Repeat("─", 88))
+			for _, name := range names {
+				fmt.Printf("  %-42s %s\n", truncate(name, 42), cfg.Models[name])
+			}
+			fmt.Println()
+		}
+
+	case "get":
+		if fs.NArg() != 1 {
+			ui.Error("Usage: llmgw config get [-profile name] <key>")
+			os.Exit(1)
+		}
+		cfg := loadConfig(*profile)
+		value, err := cfg.Get(fs.Arg(0))
+		if err != nil {
+			ui.Error("%v", err)
+			os.Exit(1)
+		}
+		fmt.Println(value)
+
+	case "set":
+		if fs.NArg() != 2 {
+			ui.Error("Usage: llmgw config set [-profile name] [-model name] <key> <value>")
+			ui.Detail("An empty value (\"\") removes the setting.")
+			fmt.Println()
+			for _, key := range config.Keys() {
+				fmt.Printf("    %-16s %s\n", key, config.Help(key))
+			}
+			fmt.Println()
+			ui.Detail("Model overrides (-model): %s", strings.Join(config.ModelFields, ", "))
+			os.Exit(1)
+		}
+		key, value := fs.Arg(0), fs.Arg(1)
+		cfg := config.New()
+
+		var err error
+		if *model != "" {
+			if !slices.Contains(config.ModelFields, key) {
+				ui.Error("Unknown model setting %q", key)
+				ui.Detail("Model overrides: %s", strings.Join(config.ModelFields, ", "))
+				os.Exit(1)
+			}
+			err = cfg.SaveModelSetting(*profile, *model, key, value)
+		} else {
+			err = cfg.SaveSetting(*profile, key, value)
+		}
+		if err != nil {
+			ui.Error("%v", err)
+			os.Exit(1)
+		}
+
+		var scope []string
+		if *model != "" {
+			scope = append(scope, "model "+*model)
+		}
+		if *profile != "" {
+			scope = append(scope, "profile "+*profile)
+		}
+		where := ""
+		if len(scope) > 0 {
+			where = " (" + strings.Join(scope, ", ") + ")"
+		}
+		if value == "" {
+			ui.Success("Removed %s%s", key, where)
+		} else {
+			ui.Success("Set %s = %s%s", key, value, where)
+		}
+		if env := config.EnvVar(key); *model == "" && os.Getenv(env) != "" {
+			ui.Warn("%s is set and overrides this value.", env)
+		}
+
+	default:
+		ui.Error("Unknown config command: %s", args[0])
+		ui.Detail("Usage: llmgw config get|set|show")
+		os.Exit(1)
+	}
+}
+
 // ──────────────────────────────────── help ───────────────────────────────────
 
 func printUsage() {
@@ -297,27 +1777,78 @@ func printUsage() {
 	fmt.Println()
 	fmt.Println("  " + ui.Bold + "COMMANDS" + ui.Reset)
 	fmt.Println("    run <model>       Download & serve a model with OpenAI-compatible API")
+	fmt.Println("    serve [models]    Serve several cached models, routed by \"model\"")
+	fmt.Println("    chat [model]      Chat with a model in the terminal")
+	fmt.Println("    ps                List running gateways")
+	fmt.Println("    status            Show each running gateway's health")
+	fmt.Println("    stop [model|all]  Stop running gateways")
 	fmt.Println("    search <query>    Search HuggingFace for GGUF models")
 	fmt.Println("    list              List locally cached models")
+	fmt.Println("    show <model>      Show a model's GGUF metadata and chat template")
 	fmt.Println("    remove <model>    Remove a cached model")
+	fmt.Println("    verify [model]    Check cached models against their SHA-256")
+	fmt.Println("    logs <model>      Show a model's llama-server output (-f to follow)")
 	fmt.Println("    aliases           Show built-in model aliases")
+	fmt.Println("    keys <cmd>        Manage API keys (create, list, revoke)")
+	fmt.Println("    backend <cmd>     Manage llama.cpp versions (list, install, use, update)")
+	fmt.Println("    config <cmd>      Show or change settings (get, set, show)")
 	fmt.Println("    version           Print version")
 	fmt.Println()
 	fmt.Println("  " + ui.Bold + "FLAGS (for run)" + ui.Reset)
+	fmt.Println("    -d                Run in the background")
 	fmt.Println("    -port      int    API port          (default: 8080)")
-	fmt.Println("    -context   int    Context window    (default: 4096)")
+	fmt.Println("    -context   int    Context window    (default: auto, the model's own)")
 	fmt.Println("    -quant     string Preferred quant   (e.g. Q4_K_M)")
 	fmt.Println("    -verbose          Show backend logs")
 	fmt.Println("    -token     string HuggingFace token (or HF_TOKEN env)")
+	fmt.Println("    -cors-origin string Allowed CORS origins, \"*\" for any (default: none)")
+	fmt.Println("    -rpm       int    Requests/minute per client (default: unlimited)")
+	fmt.Println("    -tpd       int    Tokens/day per client     (default: unlimited)")
+	fmt.Println("    -no-auth          Serve without API keys even if some exist")
+	fmt.Println("    -allow-pull       Let clients download models with /api/pull")
+	fmt.Println("    -audit-log string Audit log path    (\"off\" to disable)")
+	fmt.Println("    -audit-bodies     Also log prompts and completions (redacted)")
+	fmt.Println("    -connections int  Parallel connections per download (default: 4)")
+	fmt.Println("    -fit              Download the largest quant that fits in memory")
+	fmt.Println("    -force            Start even if the model may not fit in memory")
+	fmt.Println("    -backend-bin string llama-server to run (or LLMGW_BACKEND_BIN)")
+	fmt.Println("    -drain-timeout dur On shutdown, wait this long for requests (default: 30s)")
+	fmt.Println("    -profile   string Config file profile (or LLMGW_PROFILE)")
+	fmt.Println()
+	fmt.Println("  " + ui.Bold + "FLAGS (for serve)" + ui.Reset)
+	fmt.Println("    -mem-budget string Max size of loaded models (e.g. 16GB)")
+	fmt.Println("    -idle-ttl   dur    Unload models idle this long (e.g. 15m)")
+	fmt.Println("    -preload           Load every model at startup")
+	fmt.Println("    -force             Load models even if they may not fit in memory")
+	fmt.Println()
+	fmt.Println("  " + ui.Bold + "FLAGS (for chat)" + ui.Reset)
+	fmt.Println("    -url         string Chat through a running gateway instead")
+	fmt.Println("    -key         string Gateway API key (or LLMGW_API_KEY)")
+	fmt.Println("    -system      string System prompt")
+	fmt.Println("    -temperature float  Sampling temperature")
 	fmt.Println()
 	fmt.Println("  " + ui.Bold + "EXAMPLES" + ui.Reset)
 	fmt.Println("    llmgw run tinyllama")
 	fmt.Println("    llmgw run TheBloke/Mistral-7B-Instruct-v0.2-GGUF -port 9000")
+	fmt.Println("    llmgw serve tinyllama mistral")
+	fmt.Println("    llmgw chat tinyllama")
+	fmt.Println("    llmgw run -d tinyllama && llmgw ps")
 	fmt.Println("    llmgw search \"code llama\"")
 	fmt.Println("    llmgw list")
 	fmt.Println()
 }
 
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s